@@ -0,0 +1,93 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+// Condition types reported in the status of SpireServer, SpireAgent,
+// SpireServerBackup and SpireServerRestore
+const (
+	// ConditionAvailable is true when every desired SPIRE pod is ready
+	ConditionAvailable = "Available"
+
+	// ConditionProgressing is true while the SPIRE pods are being rolled out
+	ConditionProgressing = "Progressing"
+
+	// ConditionDegraded is true when SPIRE pods are failing or the operator
+	// cannot bring the cluster to the desired state
+	ConditionDegraded = "Degraded"
+
+	// ConditionConfigValid is true when the spec passed the operator's
+	// validation
+	ConditionConfigValid = "ConfigValid"
+
+	// ConditionCleanupBlocked is true while the operator is unable to remove
+	// the cluster-scoped resources it created for a resource being deleted
+	ConditionCleanupBlocked = "CleanupBlocked"
+
+	// ConditionDataStoreReady is true when the database the operator deploys
+	// for a SPIRE server accepts connections
+	ConditionDataStoreReady = "DataStoreReady"
+
+	// ConditionBackupSucceeded is true when the latest backup taken for a
+	// SpireServerBackup succeeded
+	ConditionBackupSucceeded = "BackupSucceeded"
+)
+
+// Condition reasons reported in the status of SpireServer, SpireAgent,
+// SpireServerBackup and SpireServerRestore
+const (
+	ReasonValid            = "Valid"
+	ReasonInvalidSpec      = "InvalidSpec"
+	ReasonServerNotFound   = "ServerNotFound"
+	ReasonReplicasReady    = "ReplicasReady"
+	ReasonReplicasNotReady = "ReplicasNotReady"
+	ReasonRollingOut       = "RollingOut"
+	ReasonRolloutComplete  = "RolloutComplete"
+	ReasonPodsFailing      = "PodsFailing"
+	ReasonAsExpected       = "AsExpected"
+	ReasonReconcileFailed  = "ReconcileFailed"
+	ReasonCleanupFailed    = "CleanupFailed"
+
+	// ReasonServerRefMissing is reported when a SpireAgent without a
+	// serverRef does not share its namespace with exactly one SpireServer
+	ReasonServerRefMissing = "ServerRefMissing"
+
+	// ReasonUnsupportedUpgrade is reported when the requested SPIRE version
+	// is more than one minor version away from the running one
+	ReasonUnsupportedUpgrade = "UnsupportedUpgrade"
+
+	// ReasonWaitingForServer is reported while SPIRE agents wait for their
+	// server to finish upgrading before they are upgraded
+	ReasonWaitingForServer = "WaitingForServer"
+
+	// ReasonDataStoreReady and ReasonDataStoreNotReady are reported on the
+	// DataStoreReady condition of SPIRE servers with a managed datastore
+	ReasonDataStoreReady    = "DataStoreReady"
+	ReasonDataStoreNotReady = "DataStoreNotReady"
+
+	// ReasonBackupSucceeded and ReasonBackupFailed are reported on the
+	// BackupSucceeded condition of SpireServerBackups
+	ReasonBackupSucceeded = "BackupSucceeded"
+	ReasonBackupFailed    = "BackupFailed"
+
+	// ReasonBackupNotFound is reported by SpireServerRestores whose
+	// SpireServerBackup or backup does not exist
+	ReasonBackupNotFound = "BackupNotFound"
+
+	// ReasonServerBusy is reported by SpireServerRestores waiting for another
+	// restore of their SPIRE server to finish
+	ReasonServerBusy = "ServerBusy"
+)
@@ -17,7 +17,9 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -25,26 +27,71 @@ import (
 
 // SpireAgentSpec defines the desired state of SpireAgent
 type SpireAgentSpec struct {
-	// +kubebuilder:validation:Required
+	// SPIRE server the agent connects to, its port, address, trust domain
+	// and node attestors are used to configure the agent
+	ServerRef ServerReference `json:"serverRef"`
 
-	// Trust domain that the SPIRE agent issues identities to
-	TrustDomain string `json:"trustDomain"`
+	// Trust domain that the SPIRE agent issues identities to, it must match the
+	// trust domain of the referenced SPIRE server which is used when it is unset
+	// +optional
+	TrustDomain string `json:"trustDomain,omitempty"`
 
-	// Node attestor plugin the SPIRE agent uses
-	NodeAttestor NodeAttestor `json:"nodeAttestor"`
+	// Node attestor plugin the SPIRE agent uses, defaults to k8s_psat
+	// +optional
+	NodeAttestor NodeAttestor `json:"nodeAttestor,omitempty"`
 
-	// Workload attestor plugins the SPIRE agent uses
+	// Workload attestor plugins the SPIRE agent uses, defaults to k8s
+	// +optional
 	// +kubebuilder:validation:MinItems=1
-	WorkloadAttestors []WorkloadAttestor `json:"workloadAttestors"`
+	WorkloadAttestors []WorkloadAttestor `json:"workloadAttestors,omitempty"`
 
-	// Indicates whether the generated keys are stored on disk or in memory
+	// Indicates whether the generated keys are stored on disk or in memory. Deprecated: use keyManager, which
+	// defaults to this field and takes precedence over it
+	// +optional
 	// +kubebuilder:validation:Enum=disk;memory
-	KeyStorage string `json:"keyStorage"`
+	KeyStorage string `json:"keyStorage,omitempty"`
+
+	// KeyManager plugin the SPIRE agent keeps its private keys with, defaults to memory
+	// +optional
+	KeyManager *AgentKeyManager `json:"keyManager,omitempty"`
+
+	// Repository of the SPIRE agent image, without a tag, defaults to the image the operator is configured with
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Version of SPIRE to run, used as the tag of the image, defaults to the version of the referenced SPIRE
+	// server or else the version the operator is configured with
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.-]+)?$`
+	Version string `json:"version,omitempty"`
+
+	// Pull policy of the SPIRE agent images, defaults to the Kubernetes default for the image tag
+	// +optional
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// Secrets in the namespace of the SpireAgent holding the credentials to pull the SPIRE agent images
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// Compute resources of the SPIRE agent container
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Scheduling of the SPIRE agent pods, tolerations default to tolerating every taint so that each node runs
+	// an agent
+	PodScheduling `json:",inline"`
+}
+
+// ServerReference identifies a SpireServer
+type ServerReference struct {
+	// Name of the SpireServer
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
 
-	// Port on which the SPIRE server listens to agents
-	// +kubebuilder:validation:Minimum=0
-	// +kubebuilder:validation:Maximum=65535
-	ServerPort int `json:"serverPort"`
+	// Namespace of the SpireServer, defaults to the namespace of the SpireAgent
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
 }
 
 type WorkloadAttestor struct {
@@ -52,14 +99,66 @@ type WorkloadAttestor struct {
 	Name string `json:"name"`
 }
 
+// AgentKeyManager configures where a SPIRE agent keeps its private keys. Exactly one of its fields must be set.
+type AgentKeyManager struct {
+	// Keeps the keys in a directory of the node the agent runs on, so that they survive restarts
+	// +optional
+	Disk *AgentDiskKeyManager `json:"disk,omitempty"`
+
+	// Keeps the keys in memory, the agent attests its node again whenever it restarts
+	// +optional
+	Memory *MemoryKeyManager `json:"memory,omitempty"`
+}
+
+// AgentDiskKeyManager keeps the keys of a SPIRE agent in a directory
+type AgentDiskKeyManager struct {
+	// Directory the keys are kept in, relative to the volume of the agent mounted on /run/spire/data, defaults to
+	// the root of the volume
+	// +optional
+	Directory string `json:"directory,omitempty"`
+}
+
 // SpireAgentStatus defines the observed state of SpireAgent
 type SpireAgentStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// Generation of the SpireAgent last processed by the operator
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Number of nodes that should be running a SPIRE agent pod
+	// +optional
+	DesiredNumberScheduled int32 `json:"desiredNumberScheduled,omitempty"`
+
+	// Number of nodes running a SPIRE agent pod
+	// +optional
+	CurrentNumberScheduled int32 `json:"currentNumberScheduled,omitempty"`
+
+	// Number of nodes running a ready SPIRE agent pod
+	// +optional
+	NumberReady int32 `json:"numberReady,omitempty"`
+
+	// Version of SPIRE every agent pod runs, it is only updated once a rollout completes
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Version of SPIRE the agent is being moved to
+	// +optional
+	TargetVersion string `json:"targetVersion,omitempty"`
+
+	// Latest observations of the SPIRE agent's state
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.status.desiredNumberScheduled`
+//+kubebuilder:printcolumn:name="Scheduled",type=integer,JSONPath=`.status.currentNumberScheduled`
+//+kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.numberReady`
+//+kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.version`
+//+kubebuilder:printcolumn:name="Available",type=string,JSONPath=`.status.conditions[?(@.type=="Available")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // SpireAgent is the Schema for the spireagents API
 type SpireAgent struct {
@@ -79,6 +178,16 @@ type SpireAgentList struct {
 	Items           []SpireAgent `json:"items"`
 }
 
+// ServerKey returns the namespaced name of the SpireServer the agent connects to.
+func (r *SpireAgent) ServerKey() types.NamespacedName {
+	namespace := r.Spec.ServerRef.Namespace
+	if namespace == "" {
+		namespace = r.Namespace
+	}
+
+	return types.NamespacedName{Name: r.Spec.ServerRef.Name, Namespace: namespace}
+}
+
 func init() {
 	SchemeBuilder.Register(&SpireAgent{}, &SpireAgentList{})
 }
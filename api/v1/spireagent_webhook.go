@@ -0,0 +1,294 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var spireagentlog = logf.Log.WithName("spireagent-resource")
+
+func (r *SpireAgent) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithValidator(&spireAgentValidator{client: mgr.GetClient()}).
+		Complete()
+}
+
+// Defaults applied to the SpireAgent spec by the defaulting webhook
+const (
+	DefaultAgentKeyStorage  = "memory"
+	DefaultWorkloadAttestor = "k8s"
+	DefaultTPMDevicePath    = "/dev/tpmrm0"
+)
+
+//+kubebuilder:webhook:path=/mutate-spire-hpe-com-v1-spireagent,mutating=true,failurePolicy=fail,sideEffects=None,groups=spire.hpe.com,resources=spireagents,verbs=create;update,versions=v1,name=mspireagent.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &SpireAgent{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *SpireAgent) Default() {
+	spireagentlog.V(1).Info("default", "name", r.Name)
+
+	if r.Spec.NodeAttestor.Name == "" {
+		r.Spec.NodeAttestor.Name = DefaultNodeAttestor
+	}
+	switch attestor := &r.Spec.NodeAttestor; attestor.Name {
+	case "tpm_devid":
+		if attestor.TPMDevID == nil {
+			attestor.TPMDevID = &TPMDevIDNodeAttestor{}
+		}
+		if attestor.TPMDevID.DevicePath == "" {
+			attestor.TPMDevID.DevicePath = DefaultTPMDevicePath
+		}
+	case "azure_msi":
+		if attestor.AzureMSI == nil {
+			attestor.AzureMSI = &AzureMSINodeAttestor{}
+		}
+		if attestor.AzureMSI.ResourceID == "" {
+			attestor.AzureMSI.ResourceID = DefaultAzureResourceID
+		}
+	}
+
+	if len(r.Spec.WorkloadAttestors) == 0 {
+		r.Spec.WorkloadAttestors = []WorkloadAttestor{{Name: DefaultWorkloadAttestor}}
+	}
+
+	// agents created before keyManager keep the backend of keyStorage
+	if r.Spec.KeyManager == nil {
+		keyStorage := r.Spec.KeyStorage
+		if keyStorage == "" {
+			keyStorage = DefaultAgentKeyStorage
+		}
+		r.Spec.KeyManager = &AgentKeyManager{}
+		if keyStorage == "disk" {
+			r.Spec.KeyManager.Disk = &AgentDiskKeyManager{}
+		} else {
+			r.Spec.KeyManager.Memory = &MemoryKeyManager{}
+		}
+	}
+
+	// workloads on tainted nodes need an agent too
+	if len(r.Spec.Tolerations) == 0 {
+		r.Spec.Tolerations = []corev1.Toleration{{Operator: corev1.TolerationOpExists}}
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-spire-hpe-com-v1-spireagent,mutating=false,failurePolicy=fail,sideEffects=None,groups=spire.hpe.com,resources=spireagents,verbs=create;update,versions=v1,name=vspireagent.kb.io,admissionReviewVersions=v1
+
+// spireAgentValidator validates SpireAgents against the SpireServer they
+// connect to, which requires a client unlike webhook.Validator.
+type spireAgentValidator struct {
+	client client.Reader
+}
+
+var _ webhook.CustomValidator = &spireAgentValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *spireAgentValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	agent, ok := obj.(*SpireAgent)
+	if !ok {
+		return nil, fmt.Errorf("expected a SpireAgent but got a %T", obj)
+	}
+	spireagentlog.Info("validate create", "name", agent.Name)
+
+	return v.validate(ctx, agent)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *spireAgentValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	agent, ok := newObj.(*SpireAgent)
+	if !ok {
+		return nil, fmt.Errorf("expected a SpireAgent but got a %T", newObj)
+	}
+	oldAgent, ok := oldObj.(*SpireAgent)
+	if !ok {
+		return nil, fmt.Errorf("expected a SpireAgent but got a %T", oldObj)
+	}
+	spireagentlog.Info("validate update", "name", agent.Name)
+
+	// the operator adds and removes its finalizer with updates, which must go
+	// through even when the agent no longer matches its server
+	if !agent.DeletionTimestamp.IsZero() || agent.specUnchanged(oldAgent) {
+		return nil, nil
+	}
+
+	return v.validate(ctx, agent)
+}
+
+// specUnchanged reports whether the spec of r is the one of old, once old has
+// been through the defaulting webhook as r has.
+func (r *SpireAgent) specUnchanged(old *SpireAgent) bool {
+	defaulted := old.DeepCopy()
+	defaulted.Default()
+
+	return equality.Semantic.DeepEqual(r.Spec, old.Spec) || equality.Semantic.DeepEqual(r.Spec, defaulted.Spec)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *spireAgentValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *spireAgentValidator) validate(ctx context.Context, agent *SpireAgent) (admission.Warnings, error) {
+	if err := agent.ValidateSpec(); err != nil {
+		return nil, err
+	}
+
+	// the server may be created after the agent, the agent is only deployed
+	// once it exists
+	server := &SpireServer{}
+	if err := v.client.Get(ctx, agent.ServerKey(), server); err != nil {
+		if apierrors.IsNotFound(err) {
+			return admission.Warnings{fmt.Sprintf("SPIRE server %s does not exist yet", agent.ServerKey())}, nil
+		}
+
+		return nil, apierrors.NewInternalError(fmt.Errorf("failed to get SPIRE server: %w", err))
+	}
+
+	return nil, agent.ValidateServerCompatibility(server)
+}
+
+// ValidateSpec checks the rules of the SpireAgent spec that cannot be
+// expressed in its OpenAPI schema and do not depend on other resources.
+func (r *SpireAgent) ValidateSpec() error {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if r.Spec.TrustDomain != "" {
+		if err := validateTrustDomain(specPath.Child("trustDomain"), r.Spec.TrustDomain); err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
+
+	if err := validateImage(specPath.Child("image"), r.Spec.Image); err != nil {
+		allErrs = append(allErrs, err)
+	}
+
+	allErrs = append(allErrs, validateResources(specPath.Child("resources"), r.Spec.Resources)...)
+
+	if keyManager := r.Spec.KeyManager; keyManager != nil {
+		keyManagerPath := specPath.Child("keyManager")
+		if (keyManager.Disk == nil) == (keyManager.Memory == nil) {
+			allErrs = append(allErrs, field.Invalid(keyManagerPath, "", "exactly one of disk and memory must be set"))
+		}
+		if disk := keyManager.Disk; disk != nil && disk.Directory != "" {
+			if err := validateDataPath(keyManagerPath.Child("disk", "directory"), disk.Directory); err != nil {
+				allErrs = append(allErrs, err)
+			}
+		}
+	}
+
+	if r.Spec.NodeAttestor.Kubernetes != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("nodeAttestor", "kubernetes"),
+			"is taken from the node attestor of the SPIRE server"))
+	}
+	allErrs = append(allErrs, validateNodeAttestorSettings(specPath.Child("nodeAttestor"), r.Spec.NodeAttestor, true)...)
+
+	seen := map[string]bool{}
+	for i, attestor := range r.Spec.WorkloadAttestors {
+		if seen[attestor.Name] {
+			allErrs = append(allErrs, field.Duplicate(specPath.Child("workloadAttestors").Index(i).Child("name"),
+				attestor.Name))
+		}
+		seen[attestor.Name] = true
+	}
+
+	return r.invalid(allErrs)
+}
+
+// ValidateServerCompatibility checks that the referenced SPIRE server issues
+// identities in the trust domain of the agent and supports its node attestor.
+func (r *SpireAgent) ValidateServerCompatibility(server *SpireServer) error {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if r.Spec.TrustDomain != "" && server.Spec.TrustDomain != r.Spec.TrustDomain {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("trustDomain"), r.Spec.TrustDomain,
+			fmt.Sprintf("does not match the trust domain %s of SPIRE server %s", server.Spec.TrustDomain, server.Name)))
+	}
+
+	supported := false
+	for _, attestor := range server.Spec.NodeAttestors {
+		if attestor.Name == r.Spec.NodeAttestor.Name {
+			supported = true
+		}
+	}
+	if !supported {
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("nodeAttestor", "name"), r.Spec.NodeAttestor.Name,
+			nodeAttestorNames(server.Spec.NodeAttestors)))
+	}
+
+	// azure_msi agents must request their tokens for a resource the server expects
+	if attestor := server.NodeAttestor("azure_msi"); attestor != nil && r.Spec.NodeAttestor.Name == "azure_msi" {
+		resourceID := DefaultAzureResourceID
+		if r.Spec.NodeAttestor.AzureMSI != nil && r.Spec.NodeAttestor.AzureMSI.ResourceID != "" {
+			resourceID = r.Spec.NodeAttestor.AzureMSI.ResourceID
+		}
+		if !azureResourceTrusted(attestor.AzureMSI, resourceID) {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("nodeAttestor", "azureMSI", "resourceID"), resourceID,
+				fmt.Sprintf("is not the resource of any tenant of SPIRE server %s", server.Name)))
+		}
+	}
+
+	return r.invalid(allErrs)
+}
+
+func (r *SpireAgent) invalid(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("SpireAgent").GroupKind(), r.Name, allErrs)
+}
+
+func nodeAttestorNames(attestors []NodeAttestor) []string {
+	names := make([]string, 0, len(attestors))
+	for _, attestor := range attestors {
+		names = append(names, attestor.Name)
+	}
+
+	return names
+}
+
+// azureResourceTrusted reports whether the azure_msi attestor of a SPIRE
+// server accepts tokens issued for resourceID.
+func azureResourceTrusted(settings *AzureMSINodeAttestor, resourceID string) bool {
+	if settings == nil {
+		return false
+	}
+	for _, tenant := range settings.Tenants {
+		if tenant.ResourceID == resourceID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,224 @@
+package v1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func validSpireAgent() *SpireAgent {
+	return &SpireAgent{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-agent", Namespace: "default"},
+		Spec: SpireAgentSpec{
+			ServerRef:         ServerReference{Name: "spire-server"},
+			TrustDomain:       "example.org",
+			NodeAttestor:      NodeAttestor{Name: "k8s_psat"},
+			WorkloadAttestors: []WorkloadAttestor{{Name: "k8s"}},
+			KeyManager:        &AgentKeyManager{Memory: &MemoryKeyManager{}},
+			PodScheduling: PodScheduling{
+				Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			},
+		},
+	}
+}
+
+func agentValidator(objects ...runtime.Object) *spireAgentValidator {
+	scheme := runtime.NewScheme()
+	_ = AddToScheme(scheme)
+	return &spireAgentValidator{client: fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objects...).Build()}
+}
+
+func TestValidateAgentAcceptsCompatibleServer(t *testing.T) {
+	v := agentValidator(validSpireServer())
+
+	_, err := v.ValidateCreate(context.Background(), validSpireAgent())
+	assert.NoError(t, err)
+}
+
+func TestValidateAgentRejectsInvalidSpecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(a *SpireAgent)
+		message string
+	}{
+		{"invalid trust domain", func(a *SpireAgent) { a.Spec.TrustDomain = "spiffe://example.org" },
+			"spec.trustDomain: Invalid value"},
+		{"duplicate workload attestor", func(a *SpireAgent) {
+			a.Spec.WorkloadAttestors = []WorkloadAttestor{{Name: "k8s"}, {Name: "k8s"}}
+		}, "spec.workloadAttestors[1].name: Duplicate value"},
+		{"other trust domain", func(a *SpireAgent) { a.Spec.TrustDomain = "example.com" },
+			"does not match the trust domain example.org of SPIRE server spire-server"},
+		{"unsupported node attestor", func(a *SpireAgent) { a.Spec.NodeAttestor = NodeAttestor{Name: "join_token"} },
+			`spec.nodeAttestor.name: Unsupported value: "join_token": supported values: "k8s_psat"`},
+		{"kubernetes settings", func(a *SpireAgent) {
+			a.Spec.NodeAttestor.Kubernetes = &KubernetesNodeAttestor{Cluster: "production"}
+		}, "spec.nodeAttestor.kubernetes: Forbidden: is taken from the node attestor of the SPIRE server"},
+		{"x509pop without certificate", func(a *SpireAgent) { a.Spec.NodeAttestor = NodeAttestor{Name: "x509pop"} },
+			"spec.nodeAttestor.x509pop.certificateHostPath: Required value"},
+		{"aws settings", func(a *SpireAgent) {
+			a.Spec.NodeAttestor = NodeAttestor{Name: "aws_iid", AWSIID: &AWSIIDNodeAttestor{AssumeRole: "spire"}}
+		}, "spec.nodeAttestor.awsIID: Forbidden: only applies to the SPIRE server"},
+		{"tpm_devid CA", func(a *SpireAgent) {
+			a.Spec.NodeAttestor = NodeAttestor{Name: "tpm_devid", TPMDevID: &TPMDevIDNodeAttestor{
+				DevIDHostPath:    "/etc/spire-agent/devid",
+				DevIDCASecretRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ca"}, Key: "ca.crt"},
+			}}
+		}, "spec.nodeAttestor.tpmDevID.devIDCASecretRef: Forbidden: only applies to the SPIRE server"},
+		{"request above limit", func(a *SpireAgent) {
+			a.Spec.Resources = corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")},
+				Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+			}
+		}, "spec.resources.requests[cpu]: Invalid value"},
+		{"two key manager backends", func(a *SpireAgent) { a.Spec.KeyManager.Disk = &AgentDiskKeyManager{} },
+			"spec.keyManager: Invalid value: \"\": exactly one of disk and memory must be set"},
+		{"absolute key directory", func(a *SpireAgent) {
+			a.Spec.KeyManager = &AgentKeyManager{Disk: &AgentDiskKeyManager{Directory: "/var/lib/spire"}}
+		}, "spec.keyManager.disk.directory: Invalid value: \"/var/lib/spire\": must be a relative path within the data volume"},
+		{"image with a tag", func(a *SpireAgent) { a.Spec.Image = "ghcr.io/spiffe/spire-agent:1.6.3" },
+			"spec.image: Invalid value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := validSpireAgent()
+			tt.mutate(agent)
+
+			_, err := agentValidator(validSpireServer()).ValidateUpdate(context.Background(), validSpireAgent(), agent)
+			assert.True(t, apierrors.IsInvalid(err))
+			assert.ErrorContains(t, err, tt.message)
+		})
+	}
+}
+
+func TestValidateAgentAllowsFinalizerUpdates(t *testing.T) {
+	// the server no longer offers the node attestor of the agent
+	server := validSpireServer()
+	server.Spec.NodeAttestors[0].Name = "k8s_sat"
+	v := agentValidator(server)
+
+	stored := validSpireAgent()
+	agent := stored.DeepCopy()
+	agent.Finalizers = []string{"spire.hpe.com/cleanup"}
+	_, err := v.ValidateUpdate(context.Background(), stored, agent)
+	assert.NoError(t, err)
+
+	deleted := agent.DeepCopy()
+	deleted.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	deleted.Finalizers = nil
+	deleted.Spec.TrustDomain = "example.com"
+	_, err = v.ValidateUpdate(context.Background(), agent, deleted)
+	assert.NoError(t, err)
+
+	changed := agent.DeepCopy()
+	changed.Spec.WorkloadAttestors = append(changed.Spec.WorkloadAttestors, WorkloadAttestor{Name: "unix"})
+	_, err = v.ValidateUpdate(context.Background(), agent, changed)
+	assert.True(t, apierrors.IsInvalid(err))
+}
+
+func TestValidateAgentAzureResource(t *testing.T) {
+	server := validSpireServer()
+	server.Spec.NodeAttestors = []NodeAttestor{{Name: "azure_msi", AzureMSI: &AzureMSINodeAttestor{
+		Tenants: []AzureTenant{{TenantID: "contoso"}, {TenantID: "fabrikam", ResourceID: "api://spire"}},
+	}}}
+	agent := validSpireAgent()
+	agent.Spec.NodeAttestor = NodeAttestor{Name: "azure_msi"}
+	agent.Default()
+
+	_, err := agentValidator(server).ValidateCreate(context.Background(), agent)
+	assert.NoError(t, err)
+
+	agent.Spec.NodeAttestor.AzureMSI.ResourceID = "api://other"
+	_, err = agentValidator(server).ValidateCreate(context.Background(), agent)
+	assert.True(t, apierrors.IsInvalid(err))
+	assert.ErrorContains(t, err,
+		`spec.nodeAttestor.azureMSI.resourceID: Invalid value: "api://other": is not the resource of any tenant of SPIRE server spire-server`)
+}
+
+func TestValidateAgentWarnsAboutMissingServer(t *testing.T) {
+	server := validSpireServer()
+	server.Namespace = "other"
+
+	warnings, err := agentValidator(server).ValidateCreate(context.Background(), validSpireAgent())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SPIRE server default/spire-server does not exist yet"}, []string(warnings))
+}
+
+func TestValidateAgentFollowsServerNamespace(t *testing.T) {
+	server := validSpireServer()
+	server.Namespace = "spire"
+	server.Spec.NodeAttestors = []NodeAttestor{{Name: "k8s_sat"}}
+	agent := validSpireAgent()
+	agent.Spec.ServerRef.Namespace = "spire"
+
+	_, err := agentValidator(server).ValidateCreate(context.Background(), agent)
+	assert.ErrorContains(t, err, `spec.nodeAttestor.name: Unsupported value: "k8s_psat"`)
+}
+
+func TestValidateAgentAcceptsUnsetTrustDomain(t *testing.T) {
+	agent := validSpireAgent()
+	agent.Spec.TrustDomain = ""
+
+	_, err := agentValidator(validSpireServer()).ValidateCreate(context.Background(), agent)
+	assert.NoError(t, err)
+}
+
+func TestServerKeyDefaultsToAgentNamespace(t *testing.T) {
+	agent := validSpireAgent()
+	assert.Equal(t, "default/spire-server", agent.ServerKey().String())
+
+	agent.Spec.ServerRef.Namespace = "spire"
+	assert.Equal(t, "spire/spire-server", agent.ServerKey().String())
+}
+
+func TestDefaultAgentMatchesDefaultServer(t *testing.T) {
+	server := &SpireServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-server", Namespace: "default"},
+		Spec:       SpireServerSpec{TrustDomain: "example.org"},
+	}
+	server.Default()
+	agent := &SpireAgent{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-agent", Namespace: "default"},
+		Spec: SpireAgentSpec{
+			ServerRef:   ServerReference{Name: "spire-server"},
+			TrustDomain: "example.org",
+		},
+	}
+
+	agent.Default()
+
+	assert.Equal(t, validSpireAgent().Spec, agent.Spec)
+	_, err := agentValidator(server).ValidateCreate(context.Background(), agent)
+	assert.NoError(t, err)
+}
+
+func TestDefaultAgentKeyManagerFollowsKeyStorage(t *testing.T) {
+	agent := validSpireAgent()
+	agent.Spec.KeyManager = nil
+	agent.Spec.KeyStorage = "disk"
+
+	agent.Default()
+
+	assert.Equal(t, &AgentKeyManager{Disk: &AgentDiskKeyManager{}}, agent.Spec.KeyManager)
+}
+
+func TestDefaultAgentKeepsUserValues(t *testing.T) {
+	agent := validSpireAgent()
+	agent.Spec.NodeAttestor = NodeAttestor{Name: "k8s_sat"}
+	agent.Spec.WorkloadAttestors = []WorkloadAttestor{{Name: "unix"}}
+	agent.Spec.KeyManager = &AgentKeyManager{Disk: &AgentDiskKeyManager{Directory: "keys"}}
+	agent.Spec.Tolerations = []corev1.Toleration{{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists}}
+	expected := agent.Spec.DeepCopy()
+
+	agent.Default()
+
+	assert.Equal(t, *expected, agent.Spec)
+}
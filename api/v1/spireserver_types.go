@@ -17,6 +17,11 @@ limitations under the License.
 package v1
 
 import (
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -28,48 +33,618 @@ type SpireServerSpec struct {
 	// +kubebuilder:validation:Required
 
 	// Trust domain associated with the SPIRE server
+	// +kubebuilder:validation:MinLength=1
 	TrustDomain string `json:"trustDomain"`
 
-	// Port on which the SPIRE server listens to agents
+	// Port on which the SPIRE server listens to agents, defaults to 8081
+	// +optional
 	// +kubebuilder:validation:Minimum=0
 	// +kubebuilder:validation:Maximum=65535
-	Port int `json:"port"`
+	Port int `json:"port,omitempty"`
 
-	// Node attestor plugins the SPIRE server uses
+	// Node attestor plugins the SPIRE server uses, defaults to k8s_psat
+	// +optional
 	// +kubebuilder:validation:MinItems=1
-	NodeAttestors []NodeAttestor `json:"nodeAttestors"`
+	NodeAttestors []NodeAttestor `json:"nodeAttestors,omitempty"`
 
-	// Indicates whether the generated keys are stored on disk or in memory
+	// Indicates whether the generated keys are stored on disk or in memory. Deprecated: use keyManager, which
+	// defaults to this field and takes precedence over it
+	// +optional
 	// +kubebuilder:validation:Enum=disk;memory
-	KeyStorage string `json:"keyStorage"`
+	KeyStorage string `json:"keyStorage,omitempty"`
+
+	// KeyManager plugin the SPIRE server keeps its private keys with, defaults to disk
+	// +optional
+	KeyManager *ServerKeyManager `json:"keyManager,omitempty"`
 
-	// Number of replicas for SPIRE server
+	// Number of replicas for SPIRE server, defaults to 1
+	// +optional
 	// +kubebuilder:validation:Minimum=1
-	Replicas int `json:"replicas"`
+	Replicas int `json:"replicas,omitempty"`
 
-	// Indicates how server data should be stored (sqlite3, mysql, or postgres)
+	// Indicates how server data should be stored (sqlite3, mysql, or postgres), defaults to sqlite3
+	// +optional
 	// +kubebuilder:validation:Enum=sqlite3;postgres;mysql
-	DataStore string `json:"dataStore"`
+	DataStore string `json:"dataStore,omitempty"`
+
+	// Connection string for the datastore, defaults to /run/spire/data/datastore.sqlite3 for sqlite3
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	ConnectionString string `json:"connectionString,omitempty"`
+
+	// Key of a Secret in the namespace of the SpireServer holding the connection string for the datastore,
+	// used instead of connectionString so that credentials are kept out of the SpireServer
+	// +optional
+	ConnectionStringSecretRef *corev1.SecretKeySelector `json:"connectionStringSecretRef,omitempty"`
+
+	// Secret in the namespace of the SpireServer holding the parts of the connection string for a mysql or
+	// postgres datastore, used instead of connectionString so that credentials are kept out of the SpireServer
+	// +optional
+	DataStoreSecretRef *DataStoreSecretReference `json:"dataStoreSecretRef,omitempty"`
+
+	// In-cluster database the operator deploys as the datastore of the SPIRE server, instead of connecting it to
+	// an existing one with connectionString
+	// +optional
+	ManagedDataStore *ManagedDataStore `json:"managedDataStore,omitempty"`
+
+	// Connection settings of a mysql or postgres datastore
+	// +optional
+	DataStoreOptions *DataStoreOptions `json:"dataStoreOptions,omitempty"`
+
+	// Certificate authority of the SPIRE server and default lifetimes of the SVIDs it issues
+	// +optional
+	CA *CertificateAuthority `json:"ca,omitempty"`
+
+	// External certificate authority the CA of the SPIRE server is signed by, the server is its own root when
+	// it is not set
+	// +optional
+	UpstreamAuthority *UpstreamAuthority `json:"upstreamAuthority,omitempty"`
+
+	// Volume of each SPIRE server pod mounted on /run/spire/data, which holds the sqlite3 datastore and the keys
+	// kept on disk, defaults to a PersistentVolumeClaim of 1Gi
+	// +optional
+	Storage *ServerStorage `json:"storage,omitempty"`
+
+	// Repository of the SPIRE server image, without a tag, defaults to the image the operator is configured with
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Version of SPIRE to run, used as the tag of the image, defaults to the version the operator is configured with
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.-]+)?$`
+	Version string `json:"version,omitempty"`
+
+	// Pull policy of the SPIRE server images, defaults to the Kubernetes default for the image tag
+	// +optional
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// Secrets in the namespace of the SpireServer holding the credentials to pull the SPIRE server images
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// Compute resources of the SPIRE server container
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	PodScheduling `json:",inline"`
+}
+
+// PodScheduling controls the nodes the pods of a SPIRE server or agent are scheduled on
+type PodScheduling struct {
+	// Labels of the nodes the pods may be scheduled on
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the pods
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity rules of the pods
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// Priority class of the pods
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// Constraints spreading the pods across topology domains, those without a labelSelector select the pods of
+	// the SpireServer or SpireAgent
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+}
+
+// DataStoreSecretReference selects the keys of a Secret the datastore connection string is built from
+type DataStoreSecretReference struct {
+	// Name of the Secret
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Key holding the host of the database, which may include the port for mysql, defaults to host
+	// +optional
+	HostKey string `json:"hostKey,omitempty"`
+
+	// Key holding the user name, defaults to username
+	// +optional
+	UserKey string `json:"userKey,omitempty"`
+
+	// Key holding the password, defaults to password
+	// +optional
+	PasswordKey string `json:"passwordKey,omitempty"`
+
+	// Key holding the name of the database, defaults to database
+	// +optional
+	DatabaseKey string `json:"databaseKey,omitempty"`
+}
+
+// ManagedDataStore configures the single-replica database the operator deploys for a SPIRE server
+type ManagedDataStore struct {
+	// Database engine, postgres or mysql, defaults to postgres
+	// +optional
+	// +kubebuilder:validation:Enum=postgres;mysql
+	Engine string `json:"engine,omitempty"`
+
+	// Image of the database, including its tag, defaults to postgres:15 or mysql:8.0
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Size of the volume holding the database, defaults to 1Gi
+	// +optional
+	StorageSize *resource.Quantity `json:"storageSize,omitempty"`
+}
+
+// ServerKeyManager configures where a SPIRE server keeps its private keys. Exactly one of its fields must be set.
+type ServerKeyManager struct {
+	// Keeps the keys in a file on the volume of the server pod, so that they survive restarts
+	// +optional
+	Disk *DiskKeyManager `json:"disk,omitempty"`
+
+	// Keeps the keys in memory, new keys are generated whenever the server restarts
+	// +optional
+	Memory *MemoryKeyManager `json:"memory,omitempty"`
+
+	// Keeps the keys in a key management service through a KeyManager plugin of SPIRE
+	// +optional
+	Plugin *PluginKeyManager `json:"plugin,omitempty"`
+}
+
+// DiskKeyManager keeps the keys of a SPIRE server in a file
+type DiskKeyManager struct {
+	// File the keys are kept in, relative to the volume mounted on /run/spire/data, defaults to keys.json
+	// +optional
+	KeysPath string `json:"keysPath,omitempty"`
+}
+
+// MemoryKeyManager keeps keys in memory
+type MemoryKeyManager struct {
+}
+
+// PluginKeyManager configures a KeyManager plugin backed by a key management service
+type PluginKeyManager struct {
+	// Name of the KeyManager plugin
+	// +kubebuilder:validation:Enum=aws_kms;gcp_kms;azure_key_vault
+	Name string `json:"name"`
+
+	// Secret holding the settings of the plugin
+	ConfigSecretRef PluginConfigSecretReference `json:"configSecretRef"`
+}
+
+// PluginConfigSecretReference identifies the keys of a Secret holding the settings of a plugin
+type PluginConfigSecretReference struct {
+	// Name of a Secret in the namespace of the server
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Keys of the Secret, each passed to the plugin as the setting of the same name, such as region or
+	// secret_access_key
+	// +kubebuilder:validation:MinItems=1
+	Keys []string `json:"keys"`
+}
+
+// CertificateAuthority configures the signing keys of a SPIRE server and the certificates and tokens it issues
+type CertificateAuthority struct {
+	// Type of the CA keys, defaults to rsa-2048
+	// +optional
+	// +kubebuilder:validation:Enum=rsa-2048;rsa-4096;ec-p256;ec-p384
+	KeyType string `json:"keyType,omitempty"`
+
+	// Subject of the CA certificates, defaults to the organization SPIFFE in the country US
+	// +optional
+	Subject *CASubject `json:"subject,omitempty"`
+
+	// Lifetime of the CA certificates, such as 24h, SPIRE defaults to 24h
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// Default lifetime of the X.509 SVIDs, SPIRE defaults to 1h
+	// +optional
+	X509SVIDTTL *metav1.Duration `json:"x509SVIDTTL,omitempty"`
+
+	// Default lifetime of the JWT SVIDs, SPIRE defaults to 5m
+	// +optional
+	JWTSVIDTTL *metav1.Duration `json:"jwtSVIDTTL,omitempty"`
+
+	// Issuer claim of the JWT SVIDs, SPIRE leaves it unset by default
+	// +optional
+	JWTIssuer string `json:"jwtIssuer,omitempty"`
+}
+
+// CASubject is the subject of the CA certificates of a SPIRE server
+type CASubject struct {
+	// Countries of the subject
+	// +optional
+	Country []string `json:"country,omitempty"`
+
+	// Organizations of the subject
+	// +optional
+	Organization []string `json:"organization,omitempty"`
+
+	// Common name of the subject
+	// +optional
+	CommonName string `json:"commonName,omitempty"`
+}
+
+// UpstreamAuthority chains the CA of a SPIRE server to an external PKI. Exactly one of its fields must be set.
+type UpstreamAuthority struct {
+	// Signs the CA of the server with a certificate and key read from a Secret
+	// +optional
+	Disk *DiskUpstreamAuthority `json:"disk,omitempty"`
+
+	// Has a cert-manager issuer sign the CA of the server through CertificateRequests created in the namespace of
+	// the server
+	// +optional
+	CertManager *CertManagerUpstreamAuthority `json:"certManager,omitempty"`
+
+	// Has the PKI secrets engine of a Vault server sign the CA of the server, authenticating with the service
+	// account token of the server pods
+	// +optional
+	Vault *VaultUpstreamAuthority `json:"vault,omitempty"`
+}
+
+// DiskUpstreamAuthority identifies the Secret holding the upstream CA
+type DiskUpstreamAuthority struct {
+	// Secret of type kubernetes.io/tls in the namespace of the server holding the certificate and key of the
+	// upstream CA
+	// +kubebuilder:validation:MinLength=1
+	SecretName string `json:"secretName"`
+
+	// Key of the Secret holding the root certificates of the upstream PKI, needed when the upstream CA is an
+	// intermediate CA
+	// +optional
+	BundleKey string `json:"bundleKey,omitempty"`
+}
+
+// CertManagerUpstreamAuthority identifies the cert-manager issuer signing the CA of the server
+type CertManagerUpstreamAuthority struct {
+	// Issuer signing the CA of the server
+	IssuerRef IssuerReference `json:"issuerRef"`
+}
+
+// IssuerReference references a cert-manager issuer
+type IssuerReference struct {
+	// Name of the issuer, an Issuer must be in the namespace of the server
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Kind of the issuer, such as Issuer or ClusterIssuer, SPIRE defaults to Issuer
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// API group of the issuer, SPIRE defaults to cert-manager.io
+	// +optional
+	Group string `json:"group,omitempty"`
+}
+
+// VaultUpstreamAuthority configures the Vault server signing the CA of the server
+type VaultUpstreamAuthority struct {
+	// URL of the Vault server, such as https://vault.vault:8200
+	// +kubebuilder:validation:MinLength=1
+	Address string `json:"address"`
+
+	// Mount point of the PKI secrets engine, SPIRE defaults to pki
+	// +optional
+	PKIMountPoint string `json:"pkiMountPoint,omitempty"`
+
+	// Vault Enterprise namespace of the PKI secrets engine
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Key of a Secret in the namespace of the server holding the CA certificates the Vault server is verified
+	// with, the system roots are used when it is not set
+	// +optional
+	CACertSecretRef *corev1.SecretKeySelector `json:"caCertSecretRef,omitempty"`
+
+	// Kubernetes auth method of Vault the server pods log in with
+	KubernetesAuth VaultKubernetesAuth `json:"kubernetesAuth"`
+}
+
+// VaultKubernetesAuth configures the Kubernetes auth method of Vault
+type VaultKubernetesAuth struct {
+	// Mount point of the auth method, SPIRE defaults to kubernetes
+	// +optional
+	MountPoint string `json:"mountPoint,omitempty"`
+
+	// Vault role bound to the service account of the server
+	// +kubebuilder:validation:MinLength=1
+	RoleName string `json:"roleName"`
+}
+
+// ServerStorage configures the volume holding the data of each SPIRE server pod
+type ServerStorage struct {
+	// Size of the PersistentVolumeClaim of each pod, defaults to 1Gi. Increasing it expands the claims of the
+	// existing pods when their storage class allows it
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+
+	// Storage class of the PersistentVolumeClaims, defaults to the default storage class of the cluster
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// Access modes of the PersistentVolumeClaims, defaults to ReadWriteOnce
+	// +optional
+	// +kubebuilder:validation:items:Enum=ReadWriteOnce;ReadWriteMany;ReadWriteOncePod
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+
+	// Keeps the data in an emptyDir volume instead of a PersistentVolumeClaim, so that it is lost whenever a pod
+	// is deleted
+	// +optional
+	EmptyDir *corev1.EmptyDirVolumeSource `json:"emptyDir,omitempty"`
+}
+
+// DataStoreOptions tune the connections of the SPIRE server to a mysql or postgres datastore
+type DataStoreOptions struct {
+	// TLS settings of the connections to the database
+	// +optional
+	TLS *DataStoreTLS `json:"tls,omitempty"`
+
+	// Maximum number of open connections to the database, SPIRE defaults to 100
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxOpenConns *int `json:"maxOpenConns,omitempty"`
+
+	// Maximum number of idle connections to the database, SPIRE defaults to 2
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxIdleConns *int `json:"maxIdleConns,omitempty"`
+
+	// Maximum amount of time a connection is reused, such as 1h, SPIRE reuses connections forever by default
+	// +optional
+	ConnMaxLifetime *metav1.Duration `json:"connMaxLifetime,omitempty"`
 
-	// Connection string for the datastore
+	// Prevents the SPIRE server from migrating the database schema, which is then left to the operator of the
+	// database
+	// +optional
+	DisableMigration bool `json:"disableMigration,omitempty"`
+
+	// Connection string of a read-only replica of the database, used for reads that tolerate stale data
+	// +optional
 	// +kubebuilder:validation:MinLength=1
-	ConnectionString string `json:"connectionString"`
+	ReadOnlyConnectionString string `json:"readOnlyConnectionString,omitempty"`
+
+	// Key of a Secret in the namespace of the SpireServer holding the connection string of a read-only replica,
+	// instead of readOnlyConnectionString
+	// +optional
+	ReadOnlyConnectionStringSecretRef *corev1.SecretKeySelector `json:"readOnlyConnectionStringSecretRef,omitempty"`
+}
+
+// DataStoreTLS selects the Secrets holding the certificates used to connect to the database over TLS
+type DataStoreTLS struct {
+	// Key of a Secret in the namespace of the SpireServer holding the CA certificates the database server
+	// certificate is verified with
+	// +optional
+	RootCASecretRef *corev1.SecretKeySelector `json:"rootCASecretRef,omitempty"`
+
+	// Secret of type kubernetes.io/tls in the namespace of the SpireServer holding the client certificate and key
+	// the SPIRE server authenticates to the database with
+	// +optional
+	ClientCertSecretName string `json:"clientCertSecretName,omitempty"`
 }
 
 type NodeAttestor struct {
-	// +kubebuilder:validation:Enum=k8s_sat;join_token;k8s_psat
+	// +kubebuilder:validation:Enum=k8s_sat;join_token;k8s_psat;x509pop;tpm_devid;aws_iid;gcp_iit;azure_msi
 	Name string `json:"name"`
+
+	// Settings of the k8s_sat and k8s_psat attestors, set on the SPIRE server and followed by its agents
+	// +optional
+	Kubernetes *KubernetesNodeAttestor `json:"kubernetes,omitempty"`
+
+	// Settings of the x509pop attestor, the CA bundle on the SPIRE server and the certificate on its agents
+	// +optional
+	X509PoP *X509PoPNodeAttestor `json:"x509pop,omitempty"`
+
+	// Settings of the tpm_devid attestor, the CAs on the SPIRE server and the DevID on its agents
+	// +optional
+	TPMDevID *TPMDevIDNodeAttestor `json:"tpmDevID,omitempty"`
+
+	// Settings of the aws_iid attestor, SPIRE server only
+	// +optional
+	AWSIID *AWSIIDNodeAttestor `json:"awsIID,omitempty"`
+
+	// Settings of the gcp_iit attestor, SPIRE server only
+	// +optional
+	GCPIIT *GCPIITNodeAttestor `json:"gcpIIT,omitempty"`
+
+	// Settings of the azure_msi attestor, the tenants on the SPIRE server and the resource on its agents
+	// +optional
+	AzureMSI *AzureMSINodeAttestor `json:"azureMSI,omitempty"`
+}
+
+// KubernetesNodeAttestor configures the attestation of SPIRE agents with the service account tokens of their pods
+type KubernetesNodeAttestor struct {
+	// Name of the cluster the agents run in, part of their SPIFFE IDs, defaults to demo-cluster for k8s_sat and to
+	// cluster for k8s_psat
+	// +optional
+	Cluster string `json:"cluster,omitempty"`
+
+	// Service accounts allowed to attest, as namespace:name, on top of those of the SpireAgents referencing the
+	// server
+	// +optional
+	ServiceAccountAllowList []string `json:"serviceAccountAllowList,omitempty"`
+
+	// Audience of the tokens projected in the agent pods, k8s_psat only, defaults to spire-server
+	// +optional
+	Audience []string `json:"audience,omitempty"`
+
+	// Labels of the nodes of the agents added to their selectors, k8s_psat only
+	// +optional
+	AllowedNodeLabelKeys []string `json:"allowedNodeLabelKeys,omitempty"`
+
+	// Labels of the agent pods added to their selectors, k8s_psat only
+	// +optional
+	AllowedPodLabelKeys []string `json:"allowedPodLabelKeys,omitempty"`
+
+	// File the agents read their token from, defaults to /var/run/secrets/tokens/spire-agent for k8s_psat, where
+	// the operator projects it, and to the token of the service account of the agent pods for k8s_sat
+	// +optional
+	TokenPath string `json:"tokenPath,omitempty"`
+}
+
+// X509PoPNodeAttestor configures the attestation of SPIRE agents with an X.509 certificate they prove to hold the
+// key of
+type X509PoPNodeAttestor struct {
+	// Secret holding the CA certificates the certificates of the agents are verified with, SPIRE server only
+	// +optional
+	CABundleSecretRef *corev1.SecretKeySelector `json:"caBundleSecretRef,omitempty"`
+
+	// Directory of each node holding the certificate of the node, as tls.crt, and its key, as tls.key, which the
+	// agent on the node attests with, SPIRE agents only
+	// +optional
+	CertificateHostPath string `json:"certificateHostPath,omitempty"`
+}
+
+// TPMDevIDNodeAttestor configures the attestation of SPIRE agents with the DevID certificate of the TPM of their
+// nodes
+type TPMDevIDNodeAttestor struct {
+	// Secret holding the CA certificates the DevID certificates are verified with, SPIRE server only
+	// +optional
+	DevIDCASecretRef *corev1.SecretKeySelector `json:"devIDCASecretRef,omitempty"`
+
+	// Secret holding the CA certificates the endorsement certificates of the TPMs are verified with, SPIRE server
+	// only
+	// +optional
+	EndorsementCASecretRef *corev1.SecretKeySelector `json:"endorsementCASecretRef,omitempty"`
+
+	// Directory of each node holding the DevID certificate of its TPM, as tls.crt, and the private key blob loaded
+	// into the TPM, as tls.key, SPIRE agents only
+	// +optional
+	DevIDHostPath string `json:"devIDHostPath,omitempty"`
+
+	// TPM device of the nodes, SPIRE agents only, defaults to /dev/tpmrm0
+	// +optional
+	DevicePath string `json:"devicePath,omitempty"`
+}
+
+// AWSIIDNodeAttestor configures the attestation of SPIRE agents running on EC2 instances with their instance
+// identity documents
+type AWSIIDNodeAttestor struct {
+	// Secret holding the access_key_id and secret_access_key the SPIRE server calls AWS with, it uses the
+	// credentials of its environment otherwise
+	// +optional
+	CredentialsSecretName string `json:"credentialsSecretName,omitempty"`
+
+	// Role assumed by the SPIRE server to describe the instances
+	// +optional
+	AssumeRole string `json:"assumeRole,omitempty"`
+
+	// Accepts instances with block devices mapped since they started
+	// +optional
+	SkipBlockDevice bool `json:"skipBlockDevice,omitempty"`
+
+	// Leaves the instance profile of the instances out of the selectors of the agents
+	// +optional
+	DisableInstanceProfileSelectors bool `json:"disableInstanceProfileSelectors,omitempty"`
+}
+
+// GCPIITNodeAttestor configures the attestation of SPIRE agents running on GCE instances with their instance
+// identity tokens
+type GCPIITNodeAttestor struct {
+	// Projects the instances are accepted from
+	// +kubebuilder:validation:MinItems=1
+	ProjectIDAllowList []string `json:"projectIDAllowList"`
+
+	// Has the SPIRE server read the metadata of the instances, with the credentials of its environment, to add
+	// their labels and metadata to the selectors of the agents
+	// +optional
+	UseInstanceMetadata bool `json:"useInstanceMetadata,omitempty"`
+
+	// Labels of the instances added to the selectors of the agents
+	// +optional
+	AllowedLabelKeys []string `json:"allowedLabelKeys,omitempty"`
+
+	// Metadata of the instances added to the selectors of the agents
+	// +optional
+	AllowedMetadataKeys []string `json:"allowedMetadataKeys,omitempty"`
+}
+
+// AzureMSINodeAttestor configures the attestation of SPIRE agents running on Azure VMs with the tokens of their
+// managed service identities
+type AzureMSINodeAttestor struct {
+	// Tenants the VMs are accepted from, SPIRE server only
+	// +optional
+	Tenants []AzureTenant `json:"tenants,omitempty"`
+
+	// Resource the agents request their tokens for, SPIRE agents only, it must be the resource of one of the tenants
+	// of the SPIRE server and defaults to https://management.azure.com/
+	// +optional
+	ResourceID string `json:"resourceID,omitempty"`
+}
+
+// AzureTenant is a tenant the azure_msi attestor accepts VMs from
+type AzureTenant struct {
+	// ID of the tenant
+	// +kubebuilder:validation:MinLength=1
+	TenantID string `json:"tenantID"`
+
+	// Resource the tokens of the agents are issued for, defaults to https://management.azure.com/
+	// +optional
+	ResourceID string `json:"resourceID,omitempty"`
+
+	// Secret holding the subscription_id, app_id and app_secret the SPIRE server describes the VMs of the tenant
+	// with, it uses its own managed service identity otherwise
+	// +optional
+	CredentialsSecretName string `json:"credentialsSecretName,omitempty"`
 }
 
 // SpireServerStatus defines the observed state of SpireServer
 type SpireServerStatus struct {
 	// Indicates whether the SPIRE server is in an error state (ERROR), initializing (INIT), live (LIVE), or ready (READY)
 	Health string `json:"health"`
+
+	// Generation of the SpireServer last processed by the operator
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Number of SPIRE server replicas desired
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Number of SPIRE server replicas that are ready
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// Version of SPIRE every server pod runs, it is only updated once a rollout completes
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Version of SPIRE the server is being moved to
+	// +optional
+	TargetVersion string `json:"targetVersion,omitempty"`
+
+	// Latest observations of the SPIRE server's state
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Health",type=string,JSONPath=`.status.health`
+//+kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`
+//+kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.status.replicas`
+//+kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.version`
+//+kubebuilder:printcolumn:name="Available",type=string,JSONPath=`.status.conditions[?(@.type=="Available")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // SpireServer is the Schema for the spireservers API
 type SpireServer struct {
@@ -89,6 +664,56 @@ type SpireServerList struct {
 	Items           []SpireServer `json:"items"`
 }
 
+// DataDir is the directory of the SPIRE server pods backed by their volume.
+const DataDir = "/run/spire/data"
+
+// KeysPath returns the file the SPIRE server keeps its keys in, or an empty
+// string when they are not kept on disk.
+func (r *SpireServer) KeysPath() string {
+	keyManager := r.Spec.KeyManager
+	if keyManager == nil {
+		// the spec has not been through the defaulting webhook
+		defaulted := r.DeepCopy()
+		defaulted.Default()
+		keyManager = defaulted.Spec.KeyManager
+	}
+	if keyManager.Disk == nil {
+		return ""
+	}
+
+	return path.Join(DataDir, keyManager.Disk.KeysPath)
+}
+
+// NodeAttestor returns the node attestor of the SPIRE server named name, with
+// its defaults applied, or nil when the server does not enable it.
+func (r *SpireServer) NodeAttestor(name string) *NodeAttestor {
+	for _, attestor := range r.Spec.NodeAttestors {
+		if attestor.Name == name {
+			defaulted := attestor.DeepCopy()
+			defaultNodeAttestor(defaulted)
+			return defaulted
+		}
+	}
+
+	return nil
+}
+
+// SQLitePath returns the file of the sqlite3 database of the SPIRE server,
+// or an empty string when its connection string is not a file in DataDir.
+func (r *SpireServer) SQLitePath() string {
+	if !strings.EqualFold(r.Spec.DataStore, "sqlite3") || r.Spec.ConnectionStringSecretRef != nil {
+		return ""
+	}
+
+	// URIs may carry parameters after the path
+	path, _, _ := strings.Cut(strings.TrimPrefix(r.Spec.ConnectionString, "file:"), "?")
+	if !strings.HasPrefix(path, DataDir+"/") || strings.Contains(path, "..") {
+		return ""
+	}
+
+	return path
+}
+
 func init() {
 	SchemeBuilder.Register(&SpireServer{}, &SpireServerList{})
 }
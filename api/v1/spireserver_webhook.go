@@ -0,0 +1,880 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var spireserverlog = logf.Log.WithName("spireserver-resource")
+
+func (r *SpireServer) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// Defaults applied to the SpireServer spec by the defaulting webhook
+const (
+	DefaultServerPort       = 8081
+	DefaultKeyStorage       = "disk"
+	DefaultDataStore        = "sqlite3"
+	DefaultConnectionString = "/run/spire/data/datastore.sqlite3"
+	DefaultNodeAttestor     = "k8s_psat"
+
+	DefaultK8sSatCluster    = "demo-cluster"
+	DefaultK8sPsatCluster   = "cluster"
+	DefaultK8sPsatAudience  = "spire-server"
+	DefaultK8sSatTokenPath  = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	DefaultK8sPsatTokenPath = "/var/run/secrets/tokens/spire-agent"
+	DefaultKeysPath         = "keys.json"
+	DefaultAzureResourceID  = "https://management.azure.com/"
+
+	DefaultManagedDataStoreEngine = "postgres"
+	DefaultPostgresImage          = "postgres:15"
+	DefaultMySQLImage             = "mysql:8.0"
+	DefaultManagedDataStoreSize   = "1Gi"
+
+	DefaultStorageSize = "1Gi"
+
+	DefaultCAKeyType             = "rsa-2048"
+	DefaultCASubjectCountry      = "US"
+	DefaultCASubjectOrganization = "SPIFFE"
+
+	DefaultDataStoreHostKey     = "host"
+	DefaultDataStoreUserKey     = "username"
+	DefaultDataStorePasswordKey = "password"
+	DefaultDataStoreDatabaseKey = "database"
+)
+
+//+kubebuilder:webhook:path=/mutate-spire-hpe-com-v1-spireserver,mutating=true,failurePolicy=fail,sideEffects=None,groups=spire.hpe.com,resources=spireservers,verbs=create;update,versions=v1,name=mspireserver.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &SpireServer{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *SpireServer) Default() {
+	spireserverlog.V(1).Info("default", "name", r.Name)
+
+	if r.Spec.Port == 0 {
+		r.Spec.Port = DefaultServerPort
+	}
+
+	// servers created before keyManager keep the backend of keyStorage
+	if r.Spec.KeyManager == nil {
+		keyStorage := r.Spec.KeyStorage
+		if keyStorage == "" {
+			keyStorage = DefaultKeyStorage
+		}
+		r.Spec.KeyManager = &ServerKeyManager{}
+		if keyStorage == "memory" {
+			r.Spec.KeyManager.Memory = &MemoryKeyManager{}
+		} else {
+			r.Spec.KeyManager.Disk = &DiskKeyManager{}
+		}
+	}
+	if disk := r.Spec.KeyManager.Disk; disk != nil && disk.KeysPath == "" {
+		disk.KeysPath = DefaultKeysPath
+	}
+
+	if managed := r.Spec.ManagedDataStore; managed != nil {
+		// the engine follows the datastore when only the latter is set
+		if managed.Engine == "" && (r.Spec.DataStore == "postgres" || r.Spec.DataStore == "mysql") {
+			managed.Engine = r.Spec.DataStore
+		}
+		if managed.Engine == "" {
+			managed.Engine = DefaultManagedDataStoreEngine
+		}
+		if managed.Image == "" && managed.Engine == "postgres" {
+			managed.Image = DefaultPostgresImage
+		}
+		if managed.Image == "" && managed.Engine == "mysql" {
+			managed.Image = DefaultMySQLImage
+		}
+		if managed.StorageSize == nil {
+			size := resource.MustParse(DefaultManagedDataStoreSize)
+			managed.StorageSize = &size
+		}
+		if r.Spec.DataStore == "" {
+			r.Spec.DataStore = managed.Engine
+		}
+	}
+
+	if r.Spec.DataStore == "" {
+		r.Spec.DataStore = DefaultDataStore
+	}
+
+	// only the sqlite3 database has a connection string that works everywhere
+	if r.Spec.ConnectionString == "" && r.Spec.ConnectionStringSecretRef == nil && r.Spec.DataStoreSecretRef == nil &&
+		strings.EqualFold(r.Spec.DataStore, "sqlite3") {
+		r.Spec.ConnectionString = DefaultConnectionString
+	}
+
+	if ref := r.Spec.DataStoreSecretRef; ref != nil {
+		if ref.HostKey == "" {
+			ref.HostKey = DefaultDataStoreHostKey
+		}
+		if ref.UserKey == "" {
+			ref.UserKey = DefaultDataStoreUserKey
+		}
+		if ref.PasswordKey == "" {
+			ref.PasswordKey = DefaultDataStorePasswordKey
+		}
+		if ref.DatabaseKey == "" {
+			ref.DatabaseKey = DefaultDataStoreDatabaseKey
+		}
+	}
+
+	if r.Spec.Replicas == 0 {
+		r.Spec.Replicas = 1
+	}
+
+	if r.Spec.CA == nil {
+		r.Spec.CA = &CertificateAuthority{}
+	}
+	if r.Spec.CA.KeyType == "" {
+		r.Spec.CA.KeyType = DefaultCAKeyType
+	}
+	if r.Spec.CA.Subject == nil {
+		r.Spec.CA.Subject = &CASubject{
+			Country:      []string{DefaultCASubjectCountry},
+			Organization: []string{DefaultCASubjectOrganization},
+		}
+	}
+
+	if r.Spec.Storage == nil {
+		r.Spec.Storage = &ServerStorage{}
+	}
+	if storage := r.Spec.Storage; storage.EmptyDir == nil {
+		if storage.Size == nil {
+			size := resource.MustParse(DefaultStorageSize)
+			storage.Size = &size
+		}
+		if len(storage.AccessModes) == 0 {
+			storage.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+		}
+	}
+
+	if len(r.Spec.NodeAttestors) == 0 {
+		r.Spec.NodeAttestors = []NodeAttestor{{Name: DefaultNodeAttestor}}
+	}
+	for i := range r.Spec.NodeAttestors {
+		defaultNodeAttestor(&r.Spec.NodeAttestors[i])
+	}
+}
+
+// defaultNodeAttestor fills the settings of the Kubernetes node attestors, the
+// cluster names being those the operator always used so that the SPIFFE IDs
+// of existing agents are kept, and the resources of the azure_msi tenants.
+func defaultNodeAttestor(attestor *NodeAttestor) {
+	if attestor.Name == "azure_msi" && attestor.AzureMSI != nil {
+		for i := range attestor.AzureMSI.Tenants {
+			if attestor.AzureMSI.Tenants[i].ResourceID == "" {
+				attestor.AzureMSI.Tenants[i].ResourceID = DefaultAzureResourceID
+			}
+		}
+	}
+
+	if attestor.Name != "k8s_sat" && attestor.Name != "k8s_psat" {
+		return
+	}
+
+	if attestor.Kubernetes == nil {
+		attestor.Kubernetes = &KubernetesNodeAttestor{}
+	}
+	settings := attestor.Kubernetes
+
+	if attestor.Name == "k8s_sat" {
+		if settings.Cluster == "" {
+			settings.Cluster = DefaultK8sSatCluster
+		}
+		if settings.TokenPath == "" {
+			settings.TokenPath = DefaultK8sSatTokenPath
+		}
+		return
+	}
+
+	if settings.Cluster == "" {
+		settings.Cluster = DefaultK8sPsatCluster
+	}
+	if len(settings.Audience) == 0 {
+		settings.Audience = []string{DefaultK8sPsatAudience}
+	}
+	if settings.TokenPath == "" {
+		settings.TokenPath = DefaultK8sPsatTokenPath
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-spire-hpe-com-v1-spireserver,mutating=false,failurePolicy=fail,sideEffects=None,groups=spire.hpe.com,resources=spireservers,verbs=create;update,versions=v1,name=vspireserver.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &SpireServer{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *SpireServer) ValidateCreate() (admission.Warnings, error) {
+	spireserverlog.Info("validate create", "name", r.Name)
+
+	return nil, r.ValidateSpec()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *SpireServer) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	spireserverlog.Info("validate update", "name", r.Name)
+
+	oldServer, ok := old.(*SpireServer)
+	if !ok {
+		return nil, fmt.Errorf("expected a SpireServer but got a %T", old)
+	}
+
+	// the operator adds and removes its finalizer with updates, which must go
+	// through even for servers stored before the spec was validated
+	if !r.DeletionTimestamp.IsZero() || r.specUnchanged(oldServer) {
+		return nil, nil
+	}
+
+	if err := r.ValidateSpec(); err != nil {
+		return nil, err
+	}
+
+	return nil, r.ValidateStorageUpdate(oldServer)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *SpireServer) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+// specUnchanged reports whether the spec of r is the one of old, once old has
+// been through the defaulting webhook as r has.
+func (r *SpireServer) specUnchanged(old *SpireServer) bool {
+	defaulted := old.DeepCopy()
+	defaulted.Default()
+
+	return equality.Semantic.DeepEqual(r.Spec, old.Spec) || equality.Semantic.DeepEqual(r.Spec, defaulted.Spec)
+}
+
+// ValidateSpec checks the rules of the SpireServer spec that cannot be
+// expressed in its OpenAPI schema. It is run both at admission time and by
+// the reconciler.
+func (r *SpireServer) ValidateSpec() error {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if err := validateTrustDomain(specPath.Child("trustDomain"), r.Spec.TrustDomain); err != nil {
+		allErrs = append(allErrs, err)
+	}
+
+	if err := validatePort(specPath.Child("port"), r.Spec.Port); err != nil {
+		allErrs = append(allErrs, err)
+	}
+
+	allErrs = append(allErrs, validateNodeAttestors(specPath.Child("nodeAttestors"), r.Spec.NodeAttestors)...)
+
+	if strings.EqualFold(r.Spec.DataStore, "sqlite3") && r.Spec.Replicas > 1 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("replicas"), r.Spec.Replicas,
+			"cannot have more than 1 replica with sqlite3 database"))
+	}
+
+	if r.Spec.ManagedDataStore != nil {
+		allErrs = append(allErrs, r.validateManagedDataStore(specPath)...)
+	} else {
+		allErrs = append(allErrs, r.validateDataStoreCredentials(specPath)...)
+	}
+	allErrs = append(allErrs, r.validateDataStoreOptions(specPath.Child("dataStoreOptions"))...)
+
+	allErrs = append(allErrs, validateCertificateAuthority(specPath.Child("ca"), r.Spec.CA)...)
+	allErrs = append(allErrs, validateServerKeyManager(specPath.Child("keyManager"), r.Spec.KeyManager)...)
+	allErrs = append(allErrs, validateUpstreamAuthority(specPath.Child("upstreamAuthority"), r.Spec.UpstreamAuthority)...)
+	allErrs = append(allErrs, validateStorage(specPath.Child("storage"), r.Spec.Storage)...)
+
+	if err := validateImage(specPath.Child("image"), r.Spec.Image); err != nil {
+		allErrs = append(allErrs, err)
+	}
+
+	allErrs = append(allErrs, validateResources(specPath.Child("resources"), r.Spec.Resources)...)
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("SpireServer").GroupKind(), r.Name, allErrs)
+}
+
+func validateTrustDomain(path *field.Path, trustDomain string) *field.Error {
+	if _, err := spiffeid.TrustDomainFromString(trustDomain); err != nil {
+		return field.Invalid(path, trustDomain, "trust domain is invalid: "+err.Error())
+	}
+
+	return nil
+}
+
+func validatePort(path *field.Path, port int) *field.Error {
+	if port < 1 || port > 65535 {
+		return field.Invalid(path, port, "must be between 1 and 65535")
+	}
+
+	return nil
+}
+
+func validateNodeAttestors(path *field.Path, attestors []NodeAttestor) field.ErrorList {
+	var allErrs field.ErrorList
+	seen := map[string]bool{}
+
+	for i, attestor := range attestors {
+		if seen[attestor.Name] {
+			allErrs = append(allErrs, field.Duplicate(path.Index(i).Child("name"), attestor.Name))
+		}
+		seen[attestor.Name] = true
+
+		allErrs = append(allErrs, validateKubernetesNodeAttestor(path.Index(i), attestor)...)
+		allErrs = append(allErrs, validateNodeAttestorSettings(path.Index(i), attestor, false)...)
+	}
+
+	return allErrs
+}
+
+// validateKubernetesNodeAttestor checks that the Kubernetes settings are only
+// given to the attestors using them.
+func validateKubernetesNodeAttestor(path *field.Path, attestor NodeAttestor) field.ErrorList {
+	var allErrs field.ErrorList
+	settings := attestor.Kubernetes
+	if settings == nil {
+		return nil
+	}
+	path = path.Child("kubernetes")
+
+	if attestor.Name != "k8s_sat" && attestor.Name != "k8s_psat" {
+		return append(allErrs, field.Forbidden(path, "only applies to the k8s_sat and k8s_psat node attestors"))
+	}
+
+	if attestor.Name == "k8s_sat" {
+		psatOnly := []struct {
+			name string
+			set  bool
+		}{
+			{"audience", len(settings.Audience) > 0},
+			{"allowedNodeLabelKeys", len(settings.AllowedNodeLabelKeys) > 0},
+			{"allowedPodLabelKeys", len(settings.AllowedPodLabelKeys) > 0},
+		}
+		for _, setting := range psatOnly {
+			if setting.set {
+				allErrs = append(allErrs, field.Forbidden(path.Child(setting.name),
+					"only applies to the k8s_psat node attestor"))
+			}
+		}
+	}
+
+	for i, serviceAccount := range settings.ServiceAccountAllowList {
+		namespace, name, found := strings.Cut(serviceAccount, ":")
+		if !found || namespace == "" || name == "" {
+			allErrs = append(allErrs, field.Invalid(path.Child("serviceAccountAllowList").Index(i), serviceAccount,
+				"must be a service account as namespace:name"))
+		}
+	}
+
+	if settings.TokenPath != "" && !filepath.IsAbs(settings.TokenPath) {
+		allErrs = append(allErrs, field.Invalid(path.Child("tokenPath"), settings.TokenPath, "must be an absolute path"))
+	}
+
+	return allErrs
+}
+
+// nodeAttestorSetting is a setting of a node attestor that belongs either to
+// the SPIRE server or to its agents.
+type nodeAttestorSetting struct {
+	path     *field.Path
+	set      bool
+	agent    bool
+	required bool
+}
+
+// validateNodeAttestorSettings checks that the settings of the x509pop,
+// tpm_devid and cloud node attestors are only given to the attestors using
+// them, and that the attestor of the SPIRE server, or of an agent when agent
+// is set, has the settings of its own side only.
+func validateNodeAttestorSettings(path *field.Path, attestor NodeAttestor, agent bool) field.ErrorList {
+	var allErrs field.ErrorList
+	owners := []struct {
+		name string
+		path *field.Path
+		set  bool
+	}{
+		{"x509pop", path.Child("x509pop"), attestor.X509PoP != nil},
+		{"tpm_devid", path.Child("tpmDevID"), attestor.TPMDevID != nil},
+		{"aws_iid", path.Child("awsIID"), attestor.AWSIID != nil},
+		{"gcp_iit", path.Child("gcpIIT"), attestor.GCPIIT != nil},
+		{"azure_msi", path.Child("azureMSI"), attestor.AzureMSI != nil},
+	}
+	for _, owner := range owners {
+		if owner.set && attestor.Name != owner.name {
+			allErrs = append(allErrs, field.Forbidden(owner.path,
+				fmt.Sprintf("only applies to the %s node attestor", owner.name)))
+		}
+	}
+	if len(allErrs) > 0 {
+		return allErrs
+	}
+
+	var settings []nodeAttestorSetting
+	switch attestor.Name {
+	case "x509pop":
+		x509pop := attestor.X509PoP
+		if x509pop == nil {
+			x509pop = &X509PoPNodeAttestor{}
+		}
+		path := path.Child("x509pop")
+		settings = []nodeAttestorSetting{
+			{path.Child("caBundleSecretRef"), x509pop.CABundleSecretRef != nil, false, true},
+			{path.Child("certificateHostPath"), x509pop.CertificateHostPath != "", true, true},
+		}
+		if x509pop.CertificateHostPath != "" && !filepath.IsAbs(x509pop.CertificateHostPath) {
+			allErrs = append(allErrs, field.Invalid(path.Child("certificateHostPath"), x509pop.CertificateHostPath,
+				"must be an absolute path"))
+		}
+
+	case "tpm_devid":
+		tpm := attestor.TPMDevID
+		if tpm == nil {
+			tpm = &TPMDevIDNodeAttestor{}
+		}
+		path := path.Child("tpmDevID")
+		settings = []nodeAttestorSetting{
+			{path.Child("devIDCASecretRef"), tpm.DevIDCASecretRef != nil, false, true},
+			{path.Child("endorsementCASecretRef"), tpm.EndorsementCASecretRef != nil, false, true},
+			{path.Child("devIDHostPath"), tpm.DevIDHostPath != "", true, true},
+			{path.Child("devicePath"), tpm.DevicePath != "", true, false},
+		}
+		if tpm.DevIDHostPath != "" && !filepath.IsAbs(tpm.DevIDHostPath) {
+			allErrs = append(allErrs, field.Invalid(path.Child("devIDHostPath"), tpm.DevIDHostPath, "must be an absolute path"))
+		}
+		if tpm.DevicePath != "" && !filepath.IsAbs(tpm.DevicePath) {
+			allErrs = append(allErrs, field.Invalid(path.Child("devicePath"), tpm.DevicePath, "must be an absolute path"))
+		}
+
+	case "aws_iid":
+		settings = []nodeAttestorSetting{{path.Child("awsIID"), attestor.AWSIID != nil, false, false}}
+
+	case "gcp_iit":
+		settings = []nodeAttestorSetting{{path.Child("gcpIIT"), attestor.GCPIIT != nil, false, true}}
+
+	case "azure_msi":
+		azure := attestor.AzureMSI
+		if azure == nil {
+			azure = &AzureMSINodeAttestor{}
+		}
+		path := path.Child("azureMSI")
+		settings = []nodeAttestorSetting{
+			{path.Child("tenants"), len(azure.Tenants) > 0, false, true},
+			{path.Child("resourceID"), azure.ResourceID != "", true, false},
+		}
+		seen := map[string]bool{}
+		for i, tenant := range azure.Tenants {
+			if seen[tenant.TenantID] {
+				allErrs = append(allErrs, field.Duplicate(path.Child("tenants").Index(i).Child("tenantID"), tenant.TenantID))
+			}
+			seen[tenant.TenantID] = true
+		}
+	}
+
+	for _, setting := range settings {
+		switch {
+		case setting.set && setting.agent && !agent:
+			allErrs = append(allErrs, field.Forbidden(setting.path, "only applies to SPIRE agents"))
+		case setting.set && !setting.agent && agent:
+			allErrs = append(allErrs, field.Forbidden(setting.path, "only applies to the SPIRE server"))
+		case !setting.set && setting.required && setting.agent == agent:
+			allErrs = append(allErrs, field.Required(setting.path, ""))
+		}
+	}
+
+	return allErrs
+}
+
+// validateImage checks that the image is only a repository, as its tag is
+// taken from the version.
+func validateImage(path *field.Path, image string) *field.Error {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if strings.Contains(image, "@") || strings.Contains(name, ":") {
+		return field.Invalid(path, image, "must not have a tag or digest, the tag is set from spec.version")
+	}
+
+	return nil
+}
+
+// validateCertificateAuthority checks that the lifetimes are positive and
+// that X.509 SVIDs do not outlive the CA certificates signing them.
+func validateCertificateAuthority(path *field.Path, ca *CertificateAuthority) field.ErrorList {
+	var allErrs field.ErrorList
+	if ca == nil {
+		return nil
+	}
+
+	lifetimes := []struct {
+		path *field.Path
+		ttl  *metav1.Duration
+	}{
+		{path.Child("ttl"), ca.TTL},
+		{path.Child("x509SVIDTTL"), ca.X509SVIDTTL},
+		{path.Child("jwtSVIDTTL"), ca.JWTSVIDTTL},
+	}
+	for _, lifetime := range lifetimes {
+		if lifetime.ttl != nil && lifetime.ttl.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(lifetime.path, lifetime.ttl.Duration.String(),
+				"must be greater than zero"))
+		}
+	}
+
+	if ca.TTL != nil && ca.X509SVIDTTL != nil && ca.X509SVIDTTL.Duration >= ca.TTL.Duration {
+		allErrs = append(allErrs, field.Invalid(path.Child("x509SVIDTTL"), ca.X509SVIDTTL.Duration.String(),
+			"must be shorter than the ttl of the CA, "+ca.TTL.Duration.String()))
+	}
+
+	return allErrs
+}
+
+// validateServerKeyManager checks that a single backend is configured, that
+// the keys stay on the volume of the server, and that the settings of plugins
+// can be rendered in server.conf.
+func validateServerKeyManager(path *field.Path, keyManager *ServerKeyManager) field.ErrorList {
+	var allErrs field.ErrorList
+	if keyManager == nil {
+		return nil
+	}
+
+	backends := 0
+	for _, set := range []bool{keyManager.Disk != nil, keyManager.Memory != nil, keyManager.Plugin != nil} {
+		if set {
+			backends++
+		}
+	}
+	if backends != 1 {
+		allErrs = append(allErrs, field.Invalid(path, "",
+			"exactly one of disk, memory and plugin must be set"))
+	}
+
+	if disk := keyManager.Disk; disk != nil && disk.KeysPath != "" {
+		if err := validateDataPath(path.Child("disk", "keysPath"), disk.KeysPath); err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
+
+	if plugin := keyManager.Plugin; plugin != nil {
+		keysPath := path.Child("plugin", "configSecretRef", "keys")
+		for i, key := range plugin.ConfigSecretRef.Keys {
+			if !pluginSetting.MatchString(key) {
+				allErrs = append(allErrs, field.Invalid(keysPath.Index(i), key,
+					"must be a setting of the plugin, made of lowercase letters, digits and underscores"))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// pluginSetting matches the names of the plugin_data settings of SPIRE plugins
+var pluginSetting = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// validateDataPath checks that a path relative to the data volume of a SPIRE
+// server or agent does not leave it.
+func validateDataPath(path *field.Path, value string) *field.Error {
+	if filepath.IsAbs(value) || value == ".." || strings.HasPrefix(filepath.Clean(value), "../") {
+		return field.Invalid(path, value, "must be a relative path within the data volume")
+	}
+
+	return nil
+}
+
+// validateUpstreamAuthority checks that a single backend is configured, and
+// that Vault is reached over HTTP.
+func validateUpstreamAuthority(path *field.Path, upstream *UpstreamAuthority) field.ErrorList {
+	var allErrs field.ErrorList
+	if upstream == nil {
+		return nil
+	}
+
+	backends := 0
+	for _, set := range []bool{upstream.Disk != nil, upstream.CertManager != nil, upstream.Vault != nil} {
+		if set {
+			backends++
+		}
+	}
+	if backends != 1 {
+		allErrs = append(allErrs, field.Invalid(path, "",
+			"exactly one of disk, certManager and vault must be set"))
+	}
+
+	if vault := upstream.Vault; vault != nil {
+		address, err := url.Parse(vault.Address)
+		if err != nil || (address.Scheme != "http" && address.Scheme != "https") || address.Host == "" {
+			allErrs = append(allErrs, field.Invalid(path.Child("vault", "address"), vault.Address,
+				"must be an http or https URL"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateStorage checks that the settings of a PersistentVolumeClaim are
+// only set when the data is kept in one.
+func validateStorage(path *field.Path, storage *ServerStorage) field.ErrorList {
+	var allErrs field.ErrorList
+	if storage == nil {
+		return nil
+	}
+
+	if storage.EmptyDir != nil {
+		claimFields := []struct {
+			path *field.Path
+			set  bool
+		}{
+			{path.Child("size"), storage.Size != nil},
+			{path.Child("storageClassName"), storage.StorageClassName != nil},
+			{path.Child("accessModes"), len(storage.AccessModes) > 0},
+		}
+		for _, claimField := range claimFields {
+			if claimField.set {
+				allErrs = append(allErrs, field.Forbidden(claimField.path, "may not be set along with emptyDir"))
+			}
+		}
+	}
+
+	if storage.Size != nil && storage.Size.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("size"), storage.Size.String(), "must be greater than zero"))
+	}
+
+	return allErrs
+}
+
+// ValidateStorageUpdate checks that the storage of the SPIRE server, whose
+// spec has been defaulted, is only changed in ways that apply to the
+// PersistentVolumeClaims already created: the claim templates of a StatefulSet
+// cannot be changed, and claims can only be expanded.
+func (r *SpireServer) ValidateStorageUpdate(old *SpireServer) error {
+	var allErrs field.ErrorList
+	path := field.NewPath("spec", "storage")
+
+	// servers created before the storage settings existed have the defaults
+	old = old.DeepCopy()
+	old.Default()
+	oldStorage, storage := old.Spec.Storage, r.Spec.Storage
+	if storage == nil {
+		return nil
+	}
+
+	switch {
+	case (oldStorage.EmptyDir == nil) != (storage.EmptyDir == nil):
+		allErrs = append(allErrs, field.Forbidden(path.Child("emptyDir"), "may not be added or removed once the server is created"))
+	case storage.EmptyDir == nil:
+		if !equality.Semantic.DeepEqual(oldStorage.StorageClassName, storage.StorageClassName) {
+			allErrs = append(allErrs, field.Forbidden(path.Child("storageClassName"),
+				"may not be changed once the server is created"))
+		}
+		if !equality.Semantic.DeepEqual(oldStorage.AccessModes, storage.AccessModes) {
+			allErrs = append(allErrs, field.Forbidden(path.Child("accessModes"),
+				"may not be changed once the server is created"))
+		}
+		if storage.Size != nil && storage.Size.Cmp(*oldStorage.Size) < 0 {
+			allErrs = append(allErrs, field.Forbidden(path.Child("size"),
+				"may not be decreased, volumes can only be expanded"))
+		}
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("SpireServer").GroupKind(), r.Name, allErrs)
+}
+
+// validateResources checks that the requests of a container do not exceed
+// its limits, which would only be reported once the pods fail to be created.
+func validateResources(path *field.Path, resources corev1.ResourceRequirements) field.ErrorList {
+	var allErrs field.ErrorList
+
+	names := make([]string, 0, len(resources.Requests))
+	for name := range resources.Requests {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		request := resources.Requests[corev1.ResourceName(name)]
+		limit, ok := resources.Limits[corev1.ResourceName(name)]
+		if ok && request.Cmp(limit) > 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child("requests").Key(name), request.String(),
+				"must be less than or equal to the "+name+" limit of "+limit.String()))
+		}
+	}
+
+	return allErrs
+}
+
+// validateDataStoreCredentials checks that the connection string is set in
+// exactly one way, either in the spec or from a Secret.
+func (r *SpireServer) validateDataStoreCredentials(specPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	switch {
+	case r.Spec.ConnectionStringSecretRef != nil:
+		if r.Spec.ConnectionString != "" {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("connectionStringSecretRef"),
+				"may not be set along with connectionString"))
+		}
+		if r.Spec.DataStoreSecretRef != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("dataStoreSecretRef"),
+				"may not be set along with connectionStringSecretRef"))
+		}
+	case r.Spec.DataStoreSecretRef != nil:
+		if r.Spec.ConnectionString != "" {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("dataStoreSecretRef"),
+				"may not be set along with connectionString"))
+		}
+		if strings.EqualFold(r.Spec.DataStore, "sqlite3") {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("dataStoreSecretRef"),
+				"is only supported when dataStore is mysql or postgres"))
+		}
+	default:
+		if err := validateConnectionString(specPath.Child("connectionString"), r.Spec.DataStore,
+			r.Spec.ConnectionString); err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
+
+	return allErrs
+}
+
+// validateManagedDataStore checks that the spec leaves the connection to the
+// database to the operator.
+func (r *SpireServer) validateManagedDataStore(specPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	managed := r.Spec.ManagedDataStore
+
+	if !strings.EqualFold(r.Spec.DataStore, managed.Engine) {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("dataStore"), r.Spec.DataStore,
+			"must match managedDataStore.engine "+managed.Engine))
+	}
+
+	if managed.Engine != "postgres" && managed.Engine != "mysql" {
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("managedDataStore", "engine"), managed.Engine,
+			[]string{"postgres", "mysql"}))
+	}
+
+	connectionFields := []struct {
+		path *field.Path
+		set  bool
+	}{
+		{specPath.Child("connectionString"), r.Spec.ConnectionString != ""},
+		{specPath.Child("connectionStringSecretRef"), r.Spec.ConnectionStringSecretRef != nil},
+		{specPath.Child("dataStoreSecretRef"), r.Spec.DataStoreSecretRef != nil},
+		{specPath.Child("dataStoreOptions", "tls"), r.Spec.DataStoreOptions != nil && r.Spec.DataStoreOptions.TLS != nil},
+	}
+	for _, connectionField := range connectionFields {
+		if connectionField.set {
+			allErrs = append(allErrs, field.Forbidden(connectionField.path,
+				"may not be set along with managedDataStore, the operator connects the server to its database"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateDataStoreOptions checks the settings that only apply to mysql and
+// postgres datastores.
+func (r *SpireServer) validateDataStoreOptions(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	options := r.Spec.DataStoreOptions
+	if options == nil {
+		return nil
+	}
+
+	if strings.EqualFold(r.Spec.DataStore, "sqlite3") &&
+		(options.TLS != nil || options.ReadOnlyConnectionString != "" || options.ReadOnlyConnectionStringSecretRef != nil) {
+		allErrs = append(allErrs, field.Forbidden(path,
+			"tls and read-only replicas are only supported when dataStore is mysql or postgres"))
+	}
+
+	// the operator only points postgres to the certificates when it builds the
+	// connection, a connection string must carry the TLS parameters itself
+	if strings.EqualFold(r.Spec.DataStore, "postgres") && options.TLS != nil &&
+		r.Spec.DataStoreSecretRef == nil && r.Spec.ManagedDataStore == nil {
+		allErrs = append(allErrs, field.Forbidden(path.Child("tls"),
+			"is only supported along with dataStoreSecretRef when dataStore is postgres, "+
+				"a connection string must set the TLS parameters itself"))
+	}
+
+	if options.ReadOnlyConnectionString != "" && options.ReadOnlyConnectionStringSecretRef != nil {
+		allErrs = append(allErrs, field.Forbidden(path.Child("readOnlyConnectionStringSecretRef"),
+			"may not be set along with readOnlyConnectionString"))
+	}
+
+	if options.ReadOnlyConnectionString != "" {
+		if err := validateConnectionString(path.Child("readOnlyConnectionString"), r.Spec.DataStore,
+			options.ReadOnlyConnectionString); err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
+
+	if options.ConnMaxLifetime != nil && options.ConnMaxLifetime.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("connMaxLifetime"), options.ConnMaxLifetime.Duration.String(),
+			"must not be negative"))
+	}
+
+	return allErrs
+}
+
+// validateConnectionString checks that the connection string has the shape
+// expected by the datastore: a file path for sqlite3 and a DSN otherwise.
+// The connection string may hold a password, so it is left out of the error.
+func validateConnectionString(path *field.Path, dataStore string, connectionString string) *field.Error {
+	switch strings.ToLower(dataStore) {
+	case "sqlite3":
+		if strings.Contains(connectionString, "://") || strings.Contains(connectionString, "@") {
+			return field.Invalid(path, field.OmitValueType{}, "must be a file path when dataStore is sqlite3")
+		}
+	case "postgres":
+		if !strings.HasPrefix(connectionString, "postgres://") &&
+			!strings.HasPrefix(connectionString, "postgresql://") &&
+			!strings.Contains(connectionString, "=") {
+			return field.Invalid(path, field.OmitValueType{},
+				"must be a postgres:// URL or a key=value DSN when dataStore is postgres")
+		}
+	case "mysql":
+		if strings.Contains(connectionString, "://") || !strings.Contains(connectionString, "/") {
+			return field.Invalid(path, field.OmitValueType{},
+				"must be a DSN such as user:password@tcp(host:3306)/database when dataStore is mysql")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,452 @@
+package v1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func validSpireServer() *SpireServer {
+	return &SpireServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-server", Namespace: "default"},
+		Spec: SpireServerSpec{
+			TrustDomain: "example.org",
+			Port:        8081,
+			NodeAttestors: []NodeAttestor{{
+				Name: "k8s_psat",
+				Kubernetes: &KubernetesNodeAttestor{
+					Cluster:   DefaultK8sPsatCluster,
+					Audience:  []string{DefaultK8sPsatAudience},
+					TokenPath: DefaultK8sPsatTokenPath,
+				},
+			}},
+			KeyManager:       &ServerKeyManager{Disk: &DiskKeyManager{KeysPath: DefaultKeysPath}},
+			Replicas:         1,
+			DataStore:        "sqlite3",
+			ConnectionString: "/run/spire/data/datastore.sqlite3",
+			CA: &CertificateAuthority{
+				KeyType: DefaultCAKeyType,
+				Subject: &CASubject{
+					Country:      []string{DefaultCASubjectCountry},
+					Organization: []string{DefaultCASubjectOrganization},
+				},
+			},
+			Storage: &ServerStorage{
+				Size:        quantity(DefaultStorageSize),
+				AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			},
+		},
+	}
+}
+
+func quantity(value string) *resource.Quantity {
+	q := resource.MustParse(value)
+	return &q
+}
+
+func TestValidateServerAcceptsValidSpec(t *testing.T) {
+	warnings, err := validSpireServer().ValidateCreate()
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+}
+
+func TestValidateServerRejectsInvalidSpecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(s *SpireServer)
+		message string
+	}{
+		{"invalid trust domain", func(s *SpireServer) { s.Spec.TrustDomain = "Example.org" },
+			"spec.trustDomain: Invalid value"},
+		{"port zero", func(s *SpireServer) { s.Spec.Port = 0 },
+			"spec.port: Invalid value: 0: must be between 1 and 65535"},
+		{"duplicate node attestor", func(s *SpireServer) {
+			s.Spec.NodeAttestors = []NodeAttestor{{Name: "k8s_psat"}, {Name: "k8s_psat"}}
+		}, "spec.nodeAttestors[1].name: Duplicate value"},
+		{"audience of k8s_sat", func(s *SpireServer) {
+			s.Spec.NodeAttestors = []NodeAttestor{{Name: "k8s_sat", Kubernetes: &KubernetesNodeAttestor{Audience: []string{"spire"}}}}
+		}, "spec.nodeAttestors[0].kubernetes.audience: Forbidden: only applies to the k8s_psat node attestor"},
+		{"kubernetes settings of join_token", func(s *SpireServer) {
+			s.Spec.NodeAttestors = append(s.Spec.NodeAttestors, NodeAttestor{Name: "join_token", Kubernetes: &KubernetesNodeAttestor{}})
+		}, "spec.nodeAttestors[1].kubernetes: Forbidden: only applies to the k8s_sat and k8s_psat node attestors"},
+		{"service account without namespace", func(s *SpireServer) {
+			s.Spec.NodeAttestors[0].Kubernetes.ServiceAccountAllowList = []string{"spire-agent"}
+		}, "spec.nodeAttestors[0].kubernetes.serviceAccountAllowList[0]: Invalid value: \"spire-agent\": must be a service account as namespace:name"},
+		{"x509pop without CA bundle", func(s *SpireServer) {
+			s.Spec.NodeAttestors = []NodeAttestor{{Name: "x509pop"}}
+		}, "spec.nodeAttestors[0].x509pop.caBundleSecretRef: Required value"},
+		{"x509pop with an agent certificate", func(s *SpireServer) {
+			s.Spec.NodeAttestors = []NodeAttestor{{Name: "x509pop", X509PoP: &X509PoPNodeAttestor{
+				CABundleSecretRef:   &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ca"}, Key: "ca.crt"},
+				CertificateHostPath: "/etc/spire-agent/x509pop",
+			}}}
+		}, "spec.nodeAttestors[0].x509pop.certificateHostPath: Forbidden: only applies to SPIRE agents"},
+		{"gcp settings of aws_iid", func(s *SpireServer) {
+			s.Spec.NodeAttestors = []NodeAttestor{{Name: "aws_iid", GCPIIT: &GCPIITNodeAttestor{ProjectIDAllowList: []string{"edge"}}}}
+		}, "spec.nodeAttestors[0].gcpIIT: Forbidden: only applies to the gcp_iit node attestor"},
+		{"gcp_iit without projects", func(s *SpireServer) { s.Spec.NodeAttestors = []NodeAttestor{{Name: "gcp_iit"}} },
+			"spec.nodeAttestors[0].gcpIIT: Required value"},
+		{"duplicate azure tenant", func(s *SpireServer) {
+			s.Spec.NodeAttestors = []NodeAttestor{{Name: "azure_msi", AzureMSI: &AzureMSINodeAttestor{
+				Tenants: []AzureTenant{{TenantID: "contoso"}, {TenantID: "contoso"}},
+			}}}
+		}, "spec.nodeAttestors[0].azureMSI.tenants[1].tenantID: Duplicate value"},
+		{"relative token path", func(s *SpireServer) { s.Spec.NodeAttestors[0].Kubernetes.TokenPath = "tokens/spire-agent" },
+			"spec.nodeAttestors[0].kubernetes.tokenPath: Invalid value: \"tokens/spire-agent\": must be an absolute path"},
+		{"sqlite3 with several replicas", func(s *SpireServer) { s.Spec.Replicas = 3 },
+			"cannot have more than 1 replica with sqlite3 database"},
+		{"sqlite3 with a DSN", func(s *SpireServer) { s.Spec.ConnectionString = "postgres://spire@db/spire" },
+			"must be a file path when dataStore is sqlite3"},
+		{"postgres with a file path", func(s *SpireServer) {
+			s.Spec.DataStore = "postgres"
+			s.Spec.ConnectionString = "/run/spire/data/datastore.sqlite3"
+		}, "when dataStore is postgres"},
+		{"mysql with a URL", func(s *SpireServer) {
+			s.Spec.DataStore = "mysql"
+			s.Spec.ConnectionString = "postgres://spire@db/spire"
+		}, "when dataStore is mysql"},
+		{"postgres DSN with a password", func(s *SpireServer) {
+			s.Spec.DataStore = "postgres"
+			s.Spec.ConnectionString = "spire:s3cret@db/spire"
+		}, "spec.connectionString: Invalid value: must be a postgres:// URL"},
+		{"connection string along with its secret", func(s *SpireServer) {
+			s.Spec.ConnectionStringSecretRef = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "datastore"}, Key: "dsn"}
+		}, "spec.connectionStringSecretRef: Forbidden: may not be set along with connectionString"},
+		{"both datastore secrets", func(s *SpireServer) {
+			s.Spec.DataStore = "postgres"
+			s.Spec.ConnectionString = ""
+			s.Spec.ConnectionStringSecretRef = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "datastore"}, Key: "dsn"}
+			s.Spec.DataStoreSecretRef = &DataStoreSecretReference{Name: "datastore"}
+		}, "spec.dataStoreSecretRef: Forbidden: may not be set along with connectionStringSecretRef"},
+		{"sqlite3 with datastore secret", func(s *SpireServer) {
+			s.Spec.ConnectionString = ""
+			s.Spec.DataStoreSecretRef = &DataStoreSecretReference{Name: "datastore"}
+		}, "is only supported when dataStore is mysql or postgres"},
+		{"sqlite3 with TLS", func(s *SpireServer) {
+			s.Spec.DataStoreOptions = &DataStoreOptions{TLS: &DataStoreTLS{ClientCertSecretName: "client"}}
+		}, "spec.dataStoreOptions: Forbidden: tls and read-only replicas are only supported"},
+		{"postgres TLS along with a connection string", func(s *SpireServer) {
+			s.Spec.DataStore = "postgres"
+			s.Spec.ConnectionString = "dbname=spire host=postgres"
+			s.Spec.DataStoreOptions = &DataStoreOptions{TLS: &DataStoreTLS{ClientCertSecretName: "client"}}
+		}, "spec.dataStoreOptions.tls: Forbidden: is only supported along with dataStoreSecretRef"},
+		{"read-only replica set twice", func(s *SpireServer) {
+			s.Spec.DataStore = "mysql"
+			s.Spec.ConnectionString = "spire@tcp(mysql:3306)/spire"
+			s.Spec.DataStoreOptions = &DataStoreOptions{
+				ReadOnlyConnectionString: "spire@tcp(replica:3306)/spire",
+				ReadOnlyConnectionStringSecretRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "mysql"}, Key: "replica"},
+			}
+		}, "spec.dataStoreOptions.readOnlyConnectionStringSecretRef: Forbidden"},
+		{"read-only replica of the wrong shape", func(s *SpireServer) {
+			s.Spec.DataStore = "mysql"
+			s.Spec.ConnectionString = "spire@tcp(mysql:3306)/spire"
+			s.Spec.DataStoreOptions = &DataStoreOptions{ReadOnlyConnectionString: "postgres://replica/spire"}
+		}, "spec.dataStoreOptions.readOnlyConnectionString: Invalid value"},
+		{"managed datastore with a connection string", func(s *SpireServer) {
+			s.Spec.DataStore = "postgres"
+			s.Spec.ConnectionString = "dbname=spire host=postgres"
+			s.Spec.ManagedDataStore = &ManagedDataStore{Engine: "postgres"}
+		}, "spec.connectionString: Forbidden: may not be set along with managedDataStore"},
+		{"managed datastore of another engine", func(s *SpireServer) {
+			s.Spec.DataStore = "mysql"
+			s.Spec.ConnectionString = ""
+			s.Spec.ManagedDataStore = &ManagedDataStore{Engine: "postgres"}
+		}, "spec.dataStore: Invalid value: \"mysql\": must match managedDataStore.engine postgres"},
+		{"negative CA ttl", func(s *SpireServer) { s.Spec.CA.TTL = &metav1.Duration{Duration: -time.Hour} },
+			"spec.ca.ttl: Invalid value: \"-1h0m0s\": must be greater than zero"},
+		{"empty JWT SVID ttl", func(s *SpireServer) { s.Spec.CA.JWTSVIDTTL = &metav1.Duration{} },
+			"spec.ca.jwtSVIDTTL: Invalid value: \"0s\": must be greater than zero"},
+		{"X.509 SVIDs outliving the CA", func(s *SpireServer) {
+			s.Spec.CA.TTL = &metav1.Duration{Duration: 24 * time.Hour}
+			s.Spec.CA.X509SVIDTTL = &metav1.Duration{Duration: 48 * time.Hour}
+		}, "spec.ca.x509SVIDTTL: Invalid value: \"48h0m0s\": must be shorter than the ttl of the CA, 24h0m0s"},
+		{"no upstream authority backend", func(s *SpireServer) { s.Spec.UpstreamAuthority = &UpstreamAuthority{} },
+			"spec.upstreamAuthority: Invalid value: \"\": exactly one of disk, certManager and vault must be set"},
+		{"two upstream authority backends", func(s *SpireServer) {
+			s.Spec.UpstreamAuthority = &UpstreamAuthority{
+				Disk:        &DiskUpstreamAuthority{SecretName: "upstream-ca"},
+				CertManager: &CertManagerUpstreamAuthority{IssuerRef: IssuerReference{Name: "corporate-ca"}},
+			}
+		}, "exactly one of disk, certManager and vault must be set"},
+		{"vault address without a scheme", func(s *SpireServer) {
+			s.Spec.UpstreamAuthority = &UpstreamAuthority{Vault: &VaultUpstreamAuthority{
+				Address:        "vault.vault:8200",
+				KubernetesAuth: VaultKubernetesAuth{RoleName: "spire-server"},
+			}}
+		}, "spec.upstreamAuthority.vault.address: Invalid value: \"vault.vault:8200\": must be an http or https URL"},
+		{"no key manager backend", func(s *SpireServer) { s.Spec.KeyManager = &ServerKeyManager{} },
+			"spec.keyManager: Invalid value: \"\": exactly one of disk, memory and plugin must be set"},
+		{"keys outside the data volume", func(s *SpireServer) { s.Spec.KeyManager.Disk.KeysPath = "../keys.json" },
+			"spec.keyManager.disk.keysPath: Invalid value: \"../keys.json\": must be a relative path within the data volume"},
+		{"key manager setting of another case", func(s *SpireServer) {
+			s.Spec.KeyManager = &ServerKeyManager{Plugin: &PluginKeyManager{
+				Name:            "aws_kms",
+				ConfigSecretRef: PluginConfigSecretReference{Name: "aws-kms", Keys: []string{"region", "AWS_REGION"}},
+			}}
+		}, "spec.keyManager.plugin.configSecretRef.keys[1]: Invalid value: \"AWS_REGION\""},
+		{"emptyDir with a size", func(s *SpireServer) {
+			s.Spec.Storage.EmptyDir = &corev1.EmptyDirVolumeSource{}
+		}, "spec.storage.size: Forbidden: may not be set along with emptyDir"},
+		{"empty volume", func(s *SpireServer) { s.Spec.Storage.Size = quantity("0") },
+			"spec.storage.size: Invalid value: \"0\": must be greater than zero"},
+		{"request above limit", func(s *SpireServer) {
+			s.Spec.Resources = corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+				Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+			}
+		}, "spec.resources.requests[memory]: Invalid value: \"1Gi\": must be less than or equal to the memory limit of 512Mi"},
+		{"image with a tag", func(s *SpireServer) { s.Spec.Image = "registry.example.com:5000/spire-server:1.6.3" },
+			"spec.image: Invalid value"},
+		{"image with a digest", func(s *SpireServer) { s.Spec.Image = "ghcr.io/spiffe/spire-server@sha256:abc" },
+			"must not have a tag or digest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := validSpireServer()
+			tt.mutate(server)
+
+			_, err := server.ValidateCreate()
+			assert.True(t, apierrors.IsInvalid(err))
+			assert.ErrorContains(t, err, tt.message)
+		})
+	}
+}
+
+func TestValidateServerAcceptsExternalDatastores(t *testing.T) {
+	server := validSpireServer()
+	server.Spec.Replicas = 3
+	server.Spec.DataStore = "postgres"
+	server.Spec.ConnectionString = "dbname=spire user=spire host=postgres sslmode=disable"
+	assert.NoError(t, server.ValidateSpec())
+
+	server.Spec.DataStore = "mysql"
+	server.Spec.ConnectionString = "spire:password@tcp(mysql:3306)/spire?parseTime=true"
+	assert.NoError(t, server.ValidateSpec())
+}
+
+func TestValidateServerAcceptsDatastoreSecrets(t *testing.T) {
+	server := validSpireServer()
+	server.Spec.Replicas = 3
+	server.Spec.DataStore = "postgres"
+	server.Spec.ConnectionString = ""
+	server.Spec.ConnectionStringSecretRef = &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "datastore"}, Key: "dsn"}
+	assert.NoError(t, server.ValidateSpec())
+
+	server.Spec.DataStore = "mysql"
+	server.Spec.ConnectionStringSecretRef = nil
+	server.Spec.DataStoreSecretRef = &DataStoreSecretReference{Name: "datastore"}
+	assert.NoError(t, server.ValidateSpec())
+}
+
+func TestValidateServerStorageUpdates(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(s *SpireServer)
+		message string
+	}{
+		{"expanded volume", func(s *SpireServer) { s.Spec.Storage.Size = quantity("5Gi") }, ""},
+		{"other labels", func(s *SpireServer) { s.Labels = map[string]string{"team": "identity"} }, ""},
+		{"shrunk volume", func(s *SpireServer) { s.Spec.Storage.Size = quantity("512Mi") },
+			"spec.storage.size: Forbidden: may not be decreased"},
+		{"other storage class", func(s *SpireServer) {
+			class := "fast"
+			s.Spec.Storage.StorageClassName = &class
+		}, "spec.storage.storageClassName: Forbidden: may not be changed once the server is created"},
+		{"other access modes", func(s *SpireServer) {
+			s.Spec.Storage.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}
+		}, "spec.storage.accessModes: Forbidden"},
+		{"moved to emptyDir", func(s *SpireServer) {
+			s.Spec.Storage = &ServerStorage{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+		}, "spec.storage.emptyDir: Forbidden: may not be added or removed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := validSpireServer()
+			tt.mutate(server)
+
+			_, err := server.ValidateUpdate(validSpireServer())
+			if tt.message == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.True(t, apierrors.IsInvalid(err))
+			assert.ErrorContains(t, err, tt.message)
+		})
+	}
+}
+
+func TestValidateServerStorageUpdateOfUndefaultedServer(t *testing.T) {
+	old := validSpireServer()
+	old.Spec.Storage = nil
+
+	_, err := validSpireServer().ValidateUpdate(old)
+	assert.NoError(t, err)
+}
+
+func TestValidateServerAllowsFinalizerUpdates(t *testing.T) {
+	// a server stored before its spec was validated
+	stored := validSpireServer()
+	stored.Spec.TrustDomain = "Example.org"
+	server := stored.DeepCopy()
+	server.Finalizers = []string{"spire.hpe.com/cleanup"}
+
+	_, err := server.ValidateUpdate(stored)
+	assert.NoError(t, err)
+
+	deleted := server.DeepCopy()
+	deleted.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	deleted.Finalizers = nil
+	_, err = deleted.ValidateUpdate(server)
+	assert.NoError(t, err)
+
+	changed := server.DeepCopy()
+	changed.Spec.Replicas = 2
+	_, err = changed.ValidateUpdate(server)
+	assert.True(t, apierrors.IsInvalid(err))
+}
+
+func TestDefaultServerFillsMinimalSpec(t *testing.T) {
+	server := &SpireServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-server", Namespace: "default"},
+		Spec:       SpireServerSpec{TrustDomain: "example.org"},
+	}
+
+	server.Default()
+
+	assert.Equal(t, validSpireServer().Spec, server.Spec)
+	assert.NoError(t, server.ValidateSpec())
+}
+
+func TestDefaultServerKeepsUserValues(t *testing.T) {
+	server := validSpireServer()
+	server.Spec.Port = 9090
+	server.Spec.KeyManager = &ServerKeyManager{Memory: &MemoryKeyManager{}}
+	server.Spec.Replicas = 3
+	server.Spec.DataStore = "postgres"
+	server.Spec.ConnectionString = "dbname=spire host=postgres"
+	server.Spec.NodeAttestors = []NodeAttestor{{Name: "join_token"}}
+	server.Spec.Storage = &ServerStorage{
+		Size:        quantity("5Gi"),
+		AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOncePod},
+	}
+	server.Spec.CA = &CertificateAuthority{
+		KeyType:     "ec-p256",
+		Subject:     &CASubject{Organization: []string{"Example"}, CommonName: "Example CA"},
+		X509SVIDTTL: &metav1.Duration{Duration: 4 * time.Hour},
+	}
+	expected := server.Spec.DeepCopy()
+
+	server.Default()
+
+	assert.Equal(t, *expected, server.Spec)
+}
+
+func TestDefaultServerKubernetesNodeAttestors(t *testing.T) {
+	server := validSpireServer()
+	server.Spec.NodeAttestors = []NodeAttestor{
+		{Name: "k8s_sat"},
+		{Name: "k8s_psat", Kubernetes: &KubernetesNodeAttestor{Cluster: "production"}},
+		{Name: "join_token"},
+	}
+
+	server.Default()
+
+	assert.Equal(t, &KubernetesNodeAttestor{Cluster: DefaultK8sSatCluster, TokenPath: DefaultK8sSatTokenPath},
+		server.Spec.NodeAttestors[0].Kubernetes)
+	assert.Equal(t, &KubernetesNodeAttestor{
+		Cluster:   "production",
+		Audience:  []string{DefaultK8sPsatAudience},
+		TokenPath: DefaultK8sPsatTokenPath,
+	}, server.Spec.NodeAttestors[1].Kubernetes)
+	assert.Nil(t, server.Spec.NodeAttestors[2].Kubernetes)
+}
+
+func TestDefaultServerKeyManagerFollowsKeyStorage(t *testing.T) {
+	server := validSpireServer()
+	server.Spec.KeyManager = nil
+	server.Spec.KeyStorage = "memory"
+
+	server.Default()
+
+	assert.Equal(t, &ServerKeyManager{Memory: &MemoryKeyManager{}}, server.Spec.KeyManager)
+}
+
+func TestDefaultServerLeavesEmptyDirAlone(t *testing.T) {
+	server := validSpireServer()
+	server.Spec.Storage = &ServerStorage{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+
+	server.Default()
+
+	assert.Equal(t, &ServerStorage{EmptyDir: &corev1.EmptyDirVolumeSource{}}, server.Spec.Storage)
+	assert.NoError(t, server.ValidateSpec())
+}
+
+func TestDefaultServerLeavesExternalConnectionStringEmpty(t *testing.T) {
+	server := &SpireServer{Spec: SpireServerSpec{TrustDomain: "example.org", DataStore: "postgres"}}
+
+	server.Default()
+
+	assert.Empty(t, server.Spec.ConnectionString)
+	assert.ErrorContains(t, server.ValidateSpec(), "spec.connectionString")
+}
+
+func TestDefaultServerFillsDatastoreSecretKeys(t *testing.T) {
+	server := &SpireServer{Spec: SpireServerSpec{
+		TrustDomain:        "example.org",
+		DataStore:          "postgres",
+		DataStoreSecretRef: &DataStoreSecretReference{Name: "datastore", PasswordKey: "postgres-password"},
+	}}
+
+	server.Default()
+
+	assert.Empty(t, server.Spec.ConnectionString)
+	assert.Equal(t, &DataStoreSecretReference{
+		Name:        "datastore",
+		HostKey:     "host",
+		UserKey:     "username",
+		PasswordKey: "postgres-password",
+		DatabaseKey: "database",
+	}, server.Spec.DataStoreSecretRef)
+	assert.NoError(t, server.ValidateSpec())
+}
+
+func TestDefaultServerManagedDatastore(t *testing.T) {
+	server := &SpireServer{Spec: SpireServerSpec{
+		TrustDomain:      "example.org",
+		Replicas:         3,
+		ManagedDataStore: &ManagedDataStore{},
+	}}
+
+	server.Default()
+
+	assert.Equal(t, "postgres", server.Spec.DataStore)
+	assert.Empty(t, server.Spec.ConnectionString)
+	assert.Equal(t, "postgres", server.Spec.ManagedDataStore.Engine)
+	assert.Equal(t, "postgres:15", server.Spec.ManagedDataStore.Image)
+	assert.Equal(t, "1Gi", server.Spec.ManagedDataStore.StorageSize.String())
+	assert.NoError(t, server.ValidateSpec())
+
+	server = &SpireServer{Spec: SpireServerSpec{
+		TrustDomain:      "example.org",
+		DataStore:        "mysql",
+		ManagedDataStore: &ManagedDataStore{},
+	}}
+
+	server.Default()
+
+	assert.Equal(t, "mysql", server.Spec.ManagedDataStore.Engine)
+	assert.Equal(t, "mysql:8.0", server.Spec.ManagedDataStore.Image)
+	assert.NoError(t, server.ValidateSpec())
+}
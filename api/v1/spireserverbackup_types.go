@@ -0,0 +1,130 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SpireServerBackupSpec defines the desired state of SpireServerBackup
+type SpireServerBackupSpec struct {
+	// SPIRE server in the namespace of the SpireServerBackup whose datastore, and keys when they are stored
+	// on disk, are backed up
+	ServerRef corev1.LocalObjectReference `json:"serverRef"`
+
+	// Cron schedule backups are taken on, such as "0 3 * * *", a single backup is taken when it is unset
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// Suspends the scheduled backups, a backup that already started is not stopped
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Where the backups are stored
+	Destination BackupDestination `json:"destination"`
+
+	// Number of backups kept at the destination, older ones are deleted, defaults to 7
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Retention int32 `json:"retention,omitempty"`
+
+	// Image the backups are taken and restored with, defaults to an image holding the tools of the datastore
+	// of the SPIRE server
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// BackupDestination is where backups are stored, exactly one of its fields must be set
+type BackupDestination struct {
+	// Volume each backup is written to, in a directory named after the backup
+	// +optional
+	PersistentVolumeClaim *PersistentVolumeClaimDestination `json:"persistentVolumeClaim,omitempty"`
+
+	// Stores each backup in a Secret named after the backup, in the namespace of the SpireServerBackup. A
+	// Secret holds at most 1MiB
+	// +optional
+	Secret *SecretDestination `json:"secret,omitempty"`
+}
+
+// PersistentVolumeClaimDestination identifies the volume backups are written to
+type PersistentVolumeClaimDestination struct {
+	// Name of a PersistentVolumeClaim in the namespace of the SpireServerBackup
+	// +kubebuilder:validation:MinLength=1
+	ClaimName string `json:"claimName"`
+}
+
+// SecretDestination stores backups in Secrets
+type SecretDestination struct {
+}
+
+// SpireServerBackupStatus defines the observed state of SpireServerBackup
+type SpireServerBackupStatus struct {
+	// Generation of the SpireServerBackup last processed by the operator
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Name of the most recent successful backup, which is the name of its directory or Secret
+	// +optional
+	LastBackup string `json:"lastBackup,omitempty"`
+
+	// Time the most recent successful backup completed at
+	// +optional
+	LastBackupTime *metav1.Time `json:"lastBackupTime,omitempty"`
+
+	// Latest observations of the backups
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Server",type=string,JSONPath=`.spec.serverRef.name`
+//+kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+//+kubebuilder:printcolumn:name="Last Backup",type=string,JSONPath=`.status.lastBackup`
+//+kubebuilder:printcolumn:name="Succeeded",type=string,JSONPath=`.status.conditions[?(@.type=="BackupSucceeded")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// SpireServerBackup is the Schema for the spireserverbackups API
+type SpireServerBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SpireServerBackupSpec   `json:"spec,omitempty"`
+	Status SpireServerBackupStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SpireServerBackupList contains a list of SpireServerBackup
+type SpireServerBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SpireServerBackup `json:"items"`
+}
+
+// ServerKey returns the namespaced name of the SpireServer backed up.
+func (r *SpireServerBackup) ServerKey() types.NamespacedName {
+	return types.NamespacedName{Name: r.Spec.ServerRef.Name, Namespace: r.Namespace}
+}
+
+func init() {
+	SchemeBuilder.Register(&SpireServerBackup{}, &SpireServerBackupList{})
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var spireserverbackuplog = logf.Log.WithName("spireserverbackup-resource")
+
+func (r *SpireServerBackup) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithValidator(&spireServerBackupValidator{client: mgr.GetClient()}).
+		Complete()
+}
+
+// DefaultBackupRetention is the number of backups kept by SpireServerBackups
+// that do not set their own
+const DefaultBackupRetention = 7
+
+//+kubebuilder:webhook:path=/mutate-spire-hpe-com-v1-spireserverbackup,mutating=true,failurePolicy=fail,sideEffects=None,groups=spire.hpe.com,resources=spireserverbackups,verbs=create;update,versions=v1,name=mspireserverbackup.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &SpireServerBackup{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *SpireServerBackup) Default() {
+	spireserverbackuplog.V(1).Info("default", "name", r.Name)
+
+	if r.Spec.Retention == 0 {
+		r.Spec.Retention = DefaultBackupRetention
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-spire-hpe-com-v1-spireserverbackup,mutating=false,failurePolicy=fail,sideEffects=None,groups=spire.hpe.com,resources=spireserverbackups,verbs=create;update,versions=v1,name=vspireserverbackup.kb.io,admissionReviewVersions=v1
+
+// spireServerBackupValidator validates SpireServerBackups against the
+// SpireServer they back up, which requires a client unlike webhook.Validator.
+type spireServerBackupValidator struct {
+	client client.Reader
+}
+
+var _ webhook.CustomValidator = &spireServerBackupValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *spireServerBackupValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	backup, ok := obj.(*SpireServerBackup)
+	if !ok {
+		return nil, fmt.Errorf("expected a SpireServerBackup but got a %T", obj)
+	}
+	spireserverbackuplog.Info("validate create", "name", backup.Name)
+
+	return v.validate(ctx, backup)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *spireServerBackupValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	backup, ok := newObj.(*SpireServerBackup)
+	if !ok {
+		return nil, fmt.Errorf("expected a SpireServerBackup but got a %T", newObj)
+	}
+	spireserverbackuplog.Info("validate update", "name", backup.Name)
+
+	return v.validate(ctx, backup)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *spireServerBackupValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *spireServerBackupValidator) validate(ctx context.Context, backup *SpireServerBackup) (admission.Warnings, error) {
+	if err := backup.ValidateSpec(); err != nil {
+		return nil, err
+	}
+
+	// backups of a server created later are taken once it exists
+	server := &SpireServer{}
+	if err := v.client.Get(ctx, backup.ServerKey(), server); err != nil {
+		if apierrors.IsNotFound(err) {
+			return admission.Warnings{fmt.Sprintf("SPIRE server %s does not exist yet", backup.ServerKey())}, nil
+		}
+
+		return nil, apierrors.NewInternalError(fmt.Errorf("failed to get SPIRE server: %w", err))
+	}
+	server.Default()
+
+	return nil, backup.ValidateServer(server)
+}
+
+// ValidateSpec checks the rules of the SpireServerBackup spec that cannot be
+// expressed in its OpenAPI schema and do not depend on other resources.
+func (r *SpireServerBackup) ValidateSpec() error {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	destination := r.Spec.Destination
+	if (destination.PersistentVolumeClaim == nil) == (destination.Secret == nil) {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("destination"), "",
+			"exactly one of persistentVolumeClaim and secret must be set"))
+	}
+
+	if r.Spec.Schedule != "" {
+		if err := validateSchedule(specPath.Child("schedule"), r.Spec.Schedule); err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
+
+	return r.invalid(allErrs)
+}
+
+// ValidateServer checks that the datastore of the SPIRE server, whose spec
+// has been defaulted, can be backed up.
+func (r *SpireServerBackup) ValidateServer(server *SpireServer) error {
+	var allErrs field.ErrorList
+	serverPath := field.NewPath("spec", "serverRef")
+
+	switch {
+	case strings.EqualFold(server.Spec.DataStore, "sqlite3") && server.SQLitePath() == "":
+		allErrs = append(allErrs, field.Invalid(serverPath, server.Name,
+			fmt.Sprintf("the sqlite3 database of the SPIRE server must be a file in %s", DataDir)))
+	case strings.EqualFold(server.Spec.DataStore, "mysql") && server.Spec.DataStoreSecretRef == nil &&
+		server.Spec.ManagedDataStore == nil:
+		allErrs = append(allErrs, field.Invalid(serverPath, server.Name,
+			"the mysql database of the SPIRE server must be reached through dataStoreSecretRef or managedDataStore"))
+	case server.Spec.Storage != nil && server.Spec.Storage.EmptyDir != nil &&
+		(server.SQLitePath() != "" || server.KeysPath() != ""):
+		allErrs = append(allErrs, field.Invalid(serverPath, server.Name,
+			"the data of the SPIRE server must be kept on a PersistentVolumeClaim to be backed up, not in an emptyDir"))
+	case server.KeysPath() != "" && server.Spec.Replicas > 1:
+		// every pod keeps its own keys on its own volume, and backups only
+		// read the volume of the first one
+		allErrs = append(allErrs, field.Invalid(serverPath, server.Name,
+			"the keys of a SPIRE server of several replicas cannot be backed up, its keyManager must not be disk"))
+	}
+
+	return r.invalid(allErrs)
+}
+
+func (r *SpireServerBackup) invalid(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("SpireServerBackup").GroupKind(), r.Name, allErrs)
+}
+
+// validateSchedule checks that the schedule is made of the five fields of a
+// cron expression, or is one of the macros CronJobs accept. The fields
+// themselves are validated when the CronJob is created.
+func validateSchedule(path *field.Path, schedule string) *field.Error {
+	if strings.HasPrefix(schedule, "@") {
+		switch schedule {
+		case "@yearly", "@annually", "@monthly", "@weekly", "@daily", "@midnight", "@hourly":
+			return nil
+		}
+
+		return field.Invalid(path, schedule, "unknown schedule macro")
+	}
+
+	if fields := strings.Fields(schedule); len(fields) != 5 {
+		return field.Invalid(path, schedule, "must be a cron expression of 5 fields")
+	}
+
+	return nil
+}
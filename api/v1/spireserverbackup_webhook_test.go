@@ -0,0 +1,130 @@
+package v1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func validSpireServerBackup() *SpireServerBackup {
+	return &SpireServerBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-backup", Namespace: "default"},
+		Spec: SpireServerBackupSpec{
+			ServerRef: corev1.LocalObjectReference{Name: "spire-server"},
+			Schedule:  "0 3 * * *",
+			Destination: BackupDestination{
+				PersistentVolumeClaim: &PersistentVolumeClaimDestination{ClaimName: "spire-backups"},
+			},
+			Retention: DefaultBackupRetention,
+		},
+	}
+}
+
+func backupValidator(objects ...runtime.Object) *spireServerBackupValidator {
+	scheme := runtime.NewScheme()
+	_ = AddToScheme(scheme)
+	return &spireServerBackupValidator{client: fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objects...).Build()}
+}
+
+func TestDefaultBackupRetention(t *testing.T) {
+	backup := validSpireServerBackup()
+	backup.Spec.Retention = 0
+
+	backup.Default()
+
+	assert.Equal(t, int32(DefaultBackupRetention), backup.Spec.Retention)
+}
+
+func TestValidateBackupAcceptsValidSpecs(t *testing.T) {
+	secret := validSpireServerBackup()
+	secret.Spec.Destination = BackupDestination{Secret: &SecretDestination{}}
+	macro := validSpireServerBackup()
+	macro.Spec.Schedule = "@daily"
+	once := validSpireServerBackup()
+	once.Spec.Schedule = ""
+
+	for _, backup := range []*SpireServerBackup{validSpireServerBackup(), secret, macro, once} {
+		warnings, err := backupValidator(validSpireServer()).ValidateCreate(context.Background(), backup)
+		assert.NoError(t, err)
+		assert.Empty(t, warnings)
+	}
+}
+
+func TestValidateBackupRejectsInvalidSpecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(b *SpireServerBackup, s *SpireServer)
+		message string
+	}{
+		{"no destination", func(b *SpireServerBackup, s *SpireServer) { b.Spec.Destination = BackupDestination{} },
+			"spec.destination: Invalid value"},
+		{"two destinations", func(b *SpireServerBackup, s *SpireServer) {
+			b.Spec.Destination.Secret = &SecretDestination{}
+		}, "exactly one of persistentVolumeClaim and secret must be set"},
+		{"schedule of six fields", func(b *SpireServerBackup, s *SpireServer) { b.Spec.Schedule = "0 0 3 * * *" },
+			"spec.schedule: Invalid value: \"0 0 3 * * *\": must be a cron expression of 5 fields"},
+		{"unknown macro", func(b *SpireServerBackup, s *SpireServer) { b.Spec.Schedule = "@often" },
+			"unknown schedule macro"},
+		{"sqlite3 database outside the data volume", func(b *SpireServerBackup, s *SpireServer) {
+			s.Spec.ConnectionString = "/tmp/datastore.sqlite3"
+		}, "the sqlite3 database of the SPIRE server must be a file in /run/spire/data"},
+		{"sqlite3 database in an emptyDir", func(b *SpireServerBackup, s *SpireServer) {
+			s.Spec.Storage = &ServerStorage{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+		}, "must be kept on a PersistentVolumeClaim to be backed up"},
+		{"keys on the disk of several replicas", func(b *SpireServerBackup, s *SpireServer) {
+			s.Spec.DataStore = "postgres"
+			s.Spec.ConnectionString = "postgres://spire@postgres/spire"
+			s.Spec.Replicas = 3
+		}, "the keys of a SPIRE server of several replicas cannot be backed up"},
+		{"mysql connection string", func(b *SpireServerBackup, s *SpireServer) {
+			s.Spec.DataStore = "mysql"
+			s.Spec.ConnectionString = "spire:secret@tcp(mysql:3306)/spire"
+		}, "spec.serverRef: Invalid value: \"spire-server\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backup := validSpireServerBackup()
+			server := validSpireServer()
+			tt.mutate(backup, server)
+
+			_, err := backupValidator(server).ValidateUpdate(context.Background(), validSpireServerBackup(), backup)
+			assert.True(t, apierrors.IsInvalid(err))
+			assert.ErrorContains(t, err, tt.message)
+		})
+	}
+}
+
+func TestValidateBackupWarnsAboutMissingServer(t *testing.T) {
+	warnings, err := backupValidator().ValidateCreate(context.Background(), validSpireServerBackup())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SPIRE server default/spire-server does not exist yet"}, []string(warnings))
+}
+
+func TestValidateRestoreForbidsSpecChanges(t *testing.T) {
+	restore := &SpireServerRestore{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-restore", Namespace: "default"},
+		Spec: SpireServerRestoreSpec{
+			ServerRef: corev1.LocalObjectReference{Name: "spire-server"},
+			BackupRef: corev1.LocalObjectReference{Name: "spire-backup"},
+		},
+	}
+	_, err := restore.ValidateCreate()
+	assert.NoError(t, err)
+
+	updated := restore.DeepCopy()
+	updated.Labels = map[string]string{"team": "identity"}
+	_, err = updated.ValidateUpdate(restore)
+	assert.NoError(t, err)
+
+	updated.Spec.BackupName = "spire-backup-28000000"
+	_, err = updated.ValidateUpdate(restore)
+	assert.True(t, apierrors.IsInvalid(err))
+	assert.ErrorContains(t, err, "spec: Forbidden: may not be changed")
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SpireServerRestoreSpec defines the desired state of SpireServerRestore
+type SpireServerRestoreSpec struct {
+	// SPIRE server in the namespace of the SpireServerRestore whose datastore, and keys when they are stored
+	// on disk, are restored
+	ServerRef corev1.LocalObjectReference `json:"serverRef"`
+
+	// SpireServerBackup in the namespace of the SpireServerRestore whose destination holds the backup
+	BackupRef corev1.LocalObjectReference `json:"backupRef"`
+
+	// Name of the backup to restore, defaults to the last successful backup of the SpireServerBackup
+	// +optional
+	BackupName string `json:"backupName,omitempty"`
+}
+
+// RestorePhase is the stage a SpireServerRestore is at
+// +kubebuilder:validation:Enum=Pending;ScalingDown;Restoring;Succeeded;Failed
+type RestorePhase string
+
+const (
+	// RestorePending is the phase of restores waiting for their SPIRE server
+	// or backup
+	RestorePending RestorePhase = "Pending"
+
+	// RestoreScalingDown is the phase of restores waiting for the pods of
+	// their SPIRE server to stop
+	RestoreScalingDown RestorePhase = "ScalingDown"
+
+	// RestoreRestoring is the phase of restores whose Job is running
+	RestoreRestoring RestorePhase = "Restoring"
+
+	// RestoreSucceeded and RestoreFailed are the final phases of restores,
+	// once the SPIRE server has been started again
+	RestoreSucceeded RestorePhase = "Succeeded"
+	RestoreFailed    RestorePhase = "Failed"
+)
+
+// SpireServerRestoreStatus defines the observed state of SpireServerRestore
+type SpireServerRestoreStatus struct {
+	// Stage the restore is at
+	// +optional
+	Phase RestorePhase `json:"phase,omitempty"`
+
+	// Name of the backup being restored
+	// +optional
+	BackupName string `json:"backupName,omitempty"`
+
+	// Time the SPIRE server was stopped for the restore at
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// Time the restore succeeded or failed at
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Latest observations of the restore
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Server",type=string,JSONPath=`.spec.serverRef.name`
+//+kubebuilder:printcolumn:name="Backup",type=string,JSONPath=`.status.backupName`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// SpireServerRestore is the Schema for the spireserverrestores API
+type SpireServerRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SpireServerRestoreSpec   `json:"spec,omitempty"`
+	Status SpireServerRestoreStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SpireServerRestoreList contains a list of SpireServerRestore
+type SpireServerRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SpireServerRestore `json:"items"`
+}
+
+// ServerKey returns the namespaced name of the SpireServer restored.
+func (r *SpireServerRestore) ServerKey() types.NamespacedName {
+	return types.NamespacedName{Name: r.Spec.ServerRef.Name, Namespace: r.Namespace}
+}
+
+// BackupKey returns the namespaced name of the SpireServerBackup holding the
+// backup restored.
+func (r *SpireServerRestore) BackupKey() types.NamespacedName {
+	return types.NamespacedName{Name: r.Spec.BackupRef.Name, Namespace: r.Namespace}
+}
+
+// Finished reports whether the restore succeeded or failed.
+func (r *SpireServerRestore) Finished() bool {
+	return r.Status.Phase == RestoreSucceeded || r.Status.Phase == RestoreFailed
+}
+
+func init() {
+	SchemeBuilder.Register(&SpireServerRestore{}, &SpireServerRestoreList{})
+}
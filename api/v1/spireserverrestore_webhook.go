@@ -0,0 +1,79 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var spireserverrestorelog = logf.Log.WithName("spireserverrestore-resource")
+
+func (r *SpireServerRestore) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-spire-hpe-com-v1-spireserverrestore,mutating=false,failurePolicy=fail,sideEffects=None,groups=spire.hpe.com,resources=spireserverrestores,verbs=create;update,versions=v1,name=vspireserverrestore.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &SpireServerRestore{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *SpireServerRestore) ValidateCreate() (admission.Warnings, error) {
+	spireserverrestorelog.Info("validate create", "name", r.Name)
+
+	return nil, nil
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *SpireServerRestore) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	spireserverrestorelog.Info("validate update", "name", r.Name)
+
+	oldRestore, ok := old.(*SpireServerRestore)
+	if !ok {
+		return nil, fmt.Errorf("expected a SpireServerRestore but got a %T", old)
+	}
+
+	return nil, r.ValidateSpecUpdate(oldRestore)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *SpireServerRestore) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateSpecUpdate checks that the spec is left as it was created, as a
+// restore runs once.
+func (r *SpireServerRestore) ValidateSpecUpdate(old *SpireServerRestore) error {
+	if equality.Semantic.DeepEqual(r.Spec, old.Spec) {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("SpireServerRestore").GroupKind(), r.Name, field.ErrorList{
+		field.Forbidden(field.NewPath("spec"), "may not be changed, create another SpireServerRestore instead"),
+	})
+}
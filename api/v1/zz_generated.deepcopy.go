@@ -22,20 +22,650 @@ limitations under the License.
 package v1
 
 import (
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AWSIIDNodeAttestor) DeepCopyInto(out *AWSIIDNodeAttestor) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSIIDNodeAttestor.
+func (in *AWSIIDNodeAttestor) DeepCopy() *AWSIIDNodeAttestor {
+	if in == nil {
+		return nil
+	}
+	out := new(AWSIIDNodeAttestor)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentDiskKeyManager) DeepCopyInto(out *AgentDiskKeyManager) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentDiskKeyManager.
+func (in *AgentDiskKeyManager) DeepCopy() *AgentDiskKeyManager {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentDiskKeyManager)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentKeyManager) DeepCopyInto(out *AgentKeyManager) {
+	*out = *in
+	if in.Disk != nil {
+		in, out := &in.Disk, &out.Disk
+		*out = new(AgentDiskKeyManager)
+		**out = **in
+	}
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		*out = new(MemoryKeyManager)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentKeyManager.
+func (in *AgentKeyManager) DeepCopy() *AgentKeyManager {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentKeyManager)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureMSINodeAttestor) DeepCopyInto(out *AzureMSINodeAttestor) {
+	*out = *in
+	if in.Tenants != nil {
+		in, out := &in.Tenants, &out.Tenants
+		*out = make([]AzureTenant, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureMSINodeAttestor.
+func (in *AzureMSINodeAttestor) DeepCopy() *AzureMSINodeAttestor {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureMSINodeAttestor)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureTenant) DeepCopyInto(out *AzureTenant) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureTenant.
+func (in *AzureTenant) DeepCopy() *AzureTenant {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureTenant)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupDestination) DeepCopyInto(out *BackupDestination) {
+	*out = *in
+	if in.PersistentVolumeClaim != nil {
+		in, out := &in.PersistentVolumeClaim, &out.PersistentVolumeClaim
+		*out = new(PersistentVolumeClaimDestination)
+		**out = **in
+	}
+	if in.Secret != nil {
+		in, out := &in.Secret, &out.Secret
+		*out = new(SecretDestination)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupDestination.
+func (in *BackupDestination) DeepCopy() *BackupDestination {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupDestination)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CASubject) DeepCopyInto(out *CASubject) {
+	*out = *in
+	if in.Country != nil {
+		in, out := &in.Country, &out.Country
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Organization != nil {
+		in, out := &in.Organization, &out.Organization
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CASubject.
+func (in *CASubject) DeepCopy() *CASubject {
+	if in == nil {
+		return nil
+	}
+	out := new(CASubject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertManagerUpstreamAuthority) DeepCopyInto(out *CertManagerUpstreamAuthority) {
+	*out = *in
+	out.IssuerRef = in.IssuerRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertManagerUpstreamAuthority.
+func (in *CertManagerUpstreamAuthority) DeepCopy() *CertManagerUpstreamAuthority {
+	if in == nil {
+		return nil
+	}
+	out := new(CertManagerUpstreamAuthority)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateAuthority) DeepCopyInto(out *CertificateAuthority) {
+	*out = *in
+	if in.Subject != nil {
+		in, out := &in.Subject, &out.Subject
+		*out = new(CASubject)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.X509SVIDTTL != nil {
+		in, out := &in.X509SVIDTTL, &out.X509SVIDTTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.JWTSVIDTTL != nil {
+		in, out := &in.JWTSVIDTTL, &out.JWTSVIDTTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateAuthority.
+func (in *CertificateAuthority) DeepCopy() *CertificateAuthority {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateAuthority)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataStoreOptions) DeepCopyInto(out *DataStoreOptions) {
+	*out = *in
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(DataStoreTLS)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxOpenConns != nil {
+		in, out := &in.MaxOpenConns, &out.MaxOpenConns
+		*out = new(int)
+		**out = **in
+	}
+	if in.MaxIdleConns != nil {
+		in, out := &in.MaxIdleConns, &out.MaxIdleConns
+		*out = new(int)
+		**out = **in
+	}
+	if in.ConnMaxLifetime != nil {
+		in, out := &in.ConnMaxLifetime, &out.ConnMaxLifetime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.ReadOnlyConnectionStringSecretRef != nil {
+		in, out := &in.ReadOnlyConnectionStringSecretRef, &out.ReadOnlyConnectionStringSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataStoreOptions.
+func (in *DataStoreOptions) DeepCopy() *DataStoreOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(DataStoreOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataStoreSecretReference) DeepCopyInto(out *DataStoreSecretReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataStoreSecretReference.
+func (in *DataStoreSecretReference) DeepCopy() *DataStoreSecretReference {
+	if in == nil {
+		return nil
+	}
+	out := new(DataStoreSecretReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataStoreTLS) DeepCopyInto(out *DataStoreTLS) {
+	*out = *in
+	if in.RootCASecretRef != nil {
+		in, out := &in.RootCASecretRef, &out.RootCASecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataStoreTLS.
+func (in *DataStoreTLS) DeepCopy() *DataStoreTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(DataStoreTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskKeyManager) DeepCopyInto(out *DiskKeyManager) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskKeyManager.
+func (in *DiskKeyManager) DeepCopy() *DiskKeyManager {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskKeyManager)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskUpstreamAuthority) DeepCopyInto(out *DiskUpstreamAuthority) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskUpstreamAuthority.
+func (in *DiskUpstreamAuthority) DeepCopy() *DiskUpstreamAuthority {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskUpstreamAuthority)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GCPIITNodeAttestor) DeepCopyInto(out *GCPIITNodeAttestor) {
+	*out = *in
+	if in.ProjectIDAllowList != nil {
+		in, out := &in.ProjectIDAllowList, &out.ProjectIDAllowList
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedLabelKeys != nil {
+		in, out := &in.AllowedLabelKeys, &out.AllowedLabelKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedMetadataKeys != nil {
+		in, out := &in.AllowedMetadataKeys, &out.AllowedMetadataKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCPIITNodeAttestor.
+func (in *GCPIITNodeAttestor) DeepCopy() *GCPIITNodeAttestor {
+	if in == nil {
+		return nil
+	}
+	out := new(GCPIITNodeAttestor)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IssuerReference) DeepCopyInto(out *IssuerReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssuerReference.
+func (in *IssuerReference) DeepCopy() *IssuerReference {
+	if in == nil {
+		return nil
+	}
+	out := new(IssuerReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubernetesNodeAttestor) DeepCopyInto(out *KubernetesNodeAttestor) {
+	*out = *in
+	if in.ServiceAccountAllowList != nil {
+		in, out := &in.ServiceAccountAllowList, &out.ServiceAccountAllowList
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Audience != nil {
+		in, out := &in.Audience, &out.Audience
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedNodeLabelKeys != nil {
+		in, out := &in.AllowedNodeLabelKeys, &out.AllowedNodeLabelKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedPodLabelKeys != nil {
+		in, out := &in.AllowedPodLabelKeys, &out.AllowedPodLabelKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesNodeAttestor.
+func (in *KubernetesNodeAttestor) DeepCopy() *KubernetesNodeAttestor {
+	if in == nil {
+		return nil
+	}
+	out := new(KubernetesNodeAttestor)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedDataStore) DeepCopyInto(out *ManagedDataStore) {
+	*out = *in
+	if in.StorageSize != nil {
+		in, out := &in.StorageSize, &out.StorageSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedDataStore.
+func (in *ManagedDataStore) DeepCopy() *ManagedDataStore {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedDataStore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MemoryKeyManager) DeepCopyInto(out *MemoryKeyManager) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MemoryKeyManager.
+func (in *MemoryKeyManager) DeepCopy() *MemoryKeyManager {
+	if in == nil {
+		return nil
+	}
+	out := new(MemoryKeyManager)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NodeAttestor) DeepCopyInto(out *NodeAttestor) {
 	*out = *in
+	if in.Kubernetes != nil {
+		in, out := &in.Kubernetes, &out.Kubernetes
+		*out = new(KubernetesNodeAttestor)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.X509PoP != nil {
+		in, out := &in.X509PoP, &out.X509PoP
+		*out = new(X509PoPNodeAttestor)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TPMDevID != nil {
+		in, out := &in.TPMDevID, &out.TPMDevID
+		*out = new(TPMDevIDNodeAttestor)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AWSIID != nil {
+		in, out := &in.AWSIID, &out.AWSIID
+		*out = new(AWSIIDNodeAttestor)
+		**out = **in
+	}
+	if in.GCPIIT != nil {
+		in, out := &in.GCPIIT, &out.GCPIIT
+		*out = new(GCPIITNodeAttestor)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AzureMSI != nil {
+		in, out := &in.AzureMSI, &out.AzureMSI
+		*out = new(AzureMSINodeAttestor)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeAttestor.
+func (in *NodeAttestor) DeepCopy() *NodeAttestor {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeAttestor)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PersistentVolumeClaimDestination) DeepCopyInto(out *PersistentVolumeClaimDestination) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PersistentVolumeClaimDestination.
+func (in *PersistentVolumeClaimDestination) DeepCopy() *PersistentVolumeClaimDestination {
+	if in == nil {
+		return nil
+	}
+	out := new(PersistentVolumeClaimDestination)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PluginConfigSecretReference) DeepCopyInto(out *PluginConfigSecretReference) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PluginConfigSecretReference.
+func (in *PluginConfigSecretReference) DeepCopy() *PluginConfigSecretReference {
+	if in == nil {
+		return nil
+	}
+	out := new(PluginConfigSecretReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PluginKeyManager) DeepCopyInto(out *PluginKeyManager) {
+	*out = *in
+	in.ConfigSecretRef.DeepCopyInto(&out.ConfigSecretRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PluginKeyManager.
+func (in *PluginKeyManager) DeepCopy() *PluginKeyManager {
+	if in == nil {
+		return nil
+	}
+	out := new(PluginKeyManager)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodScheduling) DeepCopyInto(out *PodScheduling) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(corev1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TopologySpreadConstraints != nil {
+		in, out := &in.TopologySpreadConstraints, &out.TopologySpreadConstraints
+		*out = make([]corev1.TopologySpreadConstraint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodScheduling.
+func (in *PodScheduling) DeepCopy() *PodScheduling {
+	if in == nil {
+		return nil
+	}
+	out := new(PodScheduling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretDestination) DeepCopyInto(out *SecretDestination) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretDestination.
+func (in *SecretDestination) DeepCopy() *SecretDestination {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretDestination)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServerKeyManager) DeepCopyInto(out *ServerKeyManager) {
+	*out = *in
+	if in.Disk != nil {
+		in, out := &in.Disk, &out.Disk
+		*out = new(DiskKeyManager)
+		**out = **in
+	}
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		*out = new(MemoryKeyManager)
+		**out = **in
+	}
+	if in.Plugin != nil {
+		in, out := &in.Plugin, &out.Plugin
+		*out = new(PluginKeyManager)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServerKeyManager.
+func (in *ServerKeyManager) DeepCopy() *ServerKeyManager {
+	if in == nil {
+		return nil
+	}
+	out := new(ServerKeyManager)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServerReference) DeepCopyInto(out *ServerReference) {
+	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeAttestor.
-func (in *NodeAttestor) DeepCopy() *NodeAttestor {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServerReference.
+func (in *ServerReference) DeepCopy() *ServerReference {
 	if in == nil {
 		return nil
 	}
-	out := new(NodeAttestor)
+	out := new(ServerReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServerStorage) DeepCopyInto(out *ServerStorage) {
+	*out = *in
+	if in.Size != nil {
+		in, out := &in.Size, &out.Size
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.StorageClassName != nil {
+		in, out := &in.StorageClassName, &out.StorageClassName
+		*out = new(string)
+		**out = **in
+	}
+	if in.AccessModes != nil {
+		in, out := &in.AccessModes, &out.AccessModes
+		*out = make([]corev1.PersistentVolumeAccessMode, len(*in))
+		copy(*out, *in)
+	}
+	if in.EmptyDir != nil {
+		in, out := &in.EmptyDir, &out.EmptyDir
+		*out = new(corev1.EmptyDirVolumeSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServerStorage.
+func (in *ServerStorage) DeepCopy() *ServerStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(ServerStorage)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -46,7 +676,7 @@ func (in *SpireAgent) DeepCopyInto(out *SpireAgent) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpireAgent.
@@ -102,12 +732,25 @@ func (in *SpireAgentList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SpireAgentSpec) DeepCopyInto(out *SpireAgentSpec) {
 	*out = *in
-	out.NodeAttestor = in.NodeAttestor
+	out.ServerRef = in.ServerRef
+	in.NodeAttestor.DeepCopyInto(&out.NodeAttestor)
 	if in.WorkloadAttestors != nil {
 		in, out := &in.WorkloadAttestors, &out.WorkloadAttestors
 		*out = make([]WorkloadAttestor, len(*in))
 		copy(*out, *in)
 	}
+	if in.KeyManager != nil {
+		in, out := &in.KeyManager, &out.KeyManager
+		*out = new(AgentKeyManager)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	in.PodScheduling.DeepCopyInto(&out.PodScheduling)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpireAgentSpec.
@@ -123,6 +766,13 @@ func (in *SpireAgentSpec) DeepCopy() *SpireAgentSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SpireAgentStatus) DeepCopyInto(out *SpireAgentStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpireAgentStatus.
@@ -141,7 +791,7 @@ func (in *SpireServer) DeepCopyInto(out *SpireServer) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpireServer.
@@ -162,6 +812,108 @@ func (in *SpireServer) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpireServerBackup) DeepCopyInto(out *SpireServerBackup) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpireServerBackup.
+func (in *SpireServerBackup) DeepCopy() *SpireServerBackup {
+	if in == nil {
+		return nil
+	}
+	out := new(SpireServerBackup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SpireServerBackup) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpireServerBackupList) DeepCopyInto(out *SpireServerBackupList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SpireServerBackup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpireServerBackupList.
+func (in *SpireServerBackupList) DeepCopy() *SpireServerBackupList {
+	if in == nil {
+		return nil
+	}
+	out := new(SpireServerBackupList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SpireServerBackupList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpireServerBackupSpec) DeepCopyInto(out *SpireServerBackupSpec) {
+	*out = *in
+	out.ServerRef = in.ServerRef
+	in.Destination.DeepCopyInto(&out.Destination)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpireServerBackupSpec.
+func (in *SpireServerBackupSpec) DeepCopy() *SpireServerBackupSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SpireServerBackupSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpireServerBackupStatus) DeepCopyInto(out *SpireServerBackupStatus) {
+	*out = *in
+	if in.LastBackupTime != nil {
+		in, out := &in.LastBackupTime, &out.LastBackupTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpireServerBackupStatus.
+func (in *SpireServerBackupStatus) DeepCopy() *SpireServerBackupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SpireServerBackupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SpireServerList) DeepCopyInto(out *SpireServerList) {
 	*out = *in
@@ -194,14 +946,169 @@ func (in *SpireServerList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpireServerRestore) DeepCopyInto(out *SpireServerRestore) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpireServerRestore.
+func (in *SpireServerRestore) DeepCopy() *SpireServerRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(SpireServerRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SpireServerRestore) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpireServerRestoreList) DeepCopyInto(out *SpireServerRestoreList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SpireServerRestore, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpireServerRestoreList.
+func (in *SpireServerRestoreList) DeepCopy() *SpireServerRestoreList {
+	if in == nil {
+		return nil
+	}
+	out := new(SpireServerRestoreList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SpireServerRestoreList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpireServerRestoreSpec) DeepCopyInto(out *SpireServerRestoreSpec) {
+	*out = *in
+	out.ServerRef = in.ServerRef
+	out.BackupRef = in.BackupRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpireServerRestoreSpec.
+func (in *SpireServerRestoreSpec) DeepCopy() *SpireServerRestoreSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SpireServerRestoreSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpireServerRestoreStatus) DeepCopyInto(out *SpireServerRestoreStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpireServerRestoreStatus.
+func (in *SpireServerRestoreStatus) DeepCopy() *SpireServerRestoreStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SpireServerRestoreStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SpireServerSpec) DeepCopyInto(out *SpireServerSpec) {
 	*out = *in
 	if in.NodeAttestors != nil {
 		in, out := &in.NodeAttestors, &out.NodeAttestors
 		*out = make([]NodeAttestor, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.KeyManager != nil {
+		in, out := &in.KeyManager, &out.KeyManager
+		*out = new(ServerKeyManager)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConnectionStringSecretRef != nil {
+		in, out := &in.ConnectionStringSecretRef, &out.ConnectionStringSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DataStoreSecretRef != nil {
+		in, out := &in.DataStoreSecretRef, &out.DataStoreSecretRef
+		*out = new(DataStoreSecretReference)
+		**out = **in
+	}
+	if in.ManagedDataStore != nil {
+		in, out := &in.ManagedDataStore, &out.ManagedDataStore
+		*out = new(ManagedDataStore)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DataStoreOptions != nil {
+		in, out := &in.DataStoreOptions, &out.DataStoreOptions
+		*out = new(DataStoreOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CA != nil {
+		in, out := &in.CA, &out.CA
+		*out = new(CertificateAuthority)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UpstreamAuthority != nil {
+		in, out := &in.UpstreamAuthority, &out.UpstreamAuthority
+		*out = new(UpstreamAuthority)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(ServerStorage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
 		copy(*out, *in)
 	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	in.PodScheduling.DeepCopyInto(&out.PodScheduling)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpireServerSpec.
@@ -217,6 +1124,13 @@ func (in *SpireServerSpec) DeepCopy() *SpireServerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SpireServerStatus) DeepCopyInto(out *SpireServerStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpireServerStatus.
@@ -229,6 +1143,97 @@ func (in *SpireServerStatus) DeepCopy() *SpireServerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TPMDevIDNodeAttestor) DeepCopyInto(out *TPMDevIDNodeAttestor) {
+	*out = *in
+	if in.DevIDCASecretRef != nil {
+		in, out := &in.DevIDCASecretRef, &out.DevIDCASecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EndorsementCASecretRef != nil {
+		in, out := &in.EndorsementCASecretRef, &out.EndorsementCASecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TPMDevIDNodeAttestor.
+func (in *TPMDevIDNodeAttestor) DeepCopy() *TPMDevIDNodeAttestor {
+	if in == nil {
+		return nil
+	}
+	out := new(TPMDevIDNodeAttestor)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpstreamAuthority) DeepCopyInto(out *UpstreamAuthority) {
+	*out = *in
+	if in.Disk != nil {
+		in, out := &in.Disk, &out.Disk
+		*out = new(DiskUpstreamAuthority)
+		**out = **in
+	}
+	if in.CertManager != nil {
+		in, out := &in.CertManager, &out.CertManager
+		*out = new(CertManagerUpstreamAuthority)
+		**out = **in
+	}
+	if in.Vault != nil {
+		in, out := &in.Vault, &out.Vault
+		*out = new(VaultUpstreamAuthority)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpstreamAuthority.
+func (in *UpstreamAuthority) DeepCopy() *UpstreamAuthority {
+	if in == nil {
+		return nil
+	}
+	out := new(UpstreamAuthority)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultKubernetesAuth) DeepCopyInto(out *VaultKubernetesAuth) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultKubernetesAuth.
+func (in *VaultKubernetesAuth) DeepCopy() *VaultKubernetesAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultKubernetesAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultUpstreamAuthority) DeepCopyInto(out *VaultUpstreamAuthority) {
+	*out = *in
+	if in.CACertSecretRef != nil {
+		in, out := &in.CACertSecretRef, &out.CACertSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	out.KubernetesAuth = in.KubernetesAuth
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultUpstreamAuthority.
+func (in *VaultUpstreamAuthority) DeepCopy() *VaultUpstreamAuthority {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultUpstreamAuthority)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WorkloadAttestor) DeepCopyInto(out *WorkloadAttestor) {
 	*out = *in
@@ -243,3 +1248,23 @@ func (in *WorkloadAttestor) DeepCopy() *WorkloadAttestor {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *X509PoPNodeAttestor) DeepCopyInto(out *X509PoPNodeAttestor) {
+	*out = *in
+	if in.CABundleSecretRef != nil {
+		in, out := &in.CABundleSecretRef, &out.CABundleSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new X509PoPNodeAttestor.
+func (in *X509PoPNodeAttestor) DeepCopy() *X509PoPNodeAttestor {
+	if in == nil {
+		return nil
+	}
+	out := new(X509PoPNodeAttestor)
+	in.DeepCopyInto(out)
+	return out
+}
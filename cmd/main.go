@@ -52,11 +52,24 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var images controller.Images
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&images.ServerImage, "spire-server-image", controller.DefaultServerImage,
+		"The repository of the SPIRE server image, for SpireServers that do not set their own.")
+	flag.StringVar(&images.AgentImage, "spire-agent-image", controller.DefaultAgentImage,
+		"The repository of the SPIRE agent image, for SpireAgents that do not set their own.")
+	flag.StringVar(&images.Version, "spire-version", controller.DefaultVersion,
+		"The version of SPIRE, used as the image tag, for resources that do not set their own.")
+	flag.StringVar(&images.InitImage, "init-image", controller.DefaultInitImage,
+		"The image of the init container waiting for the SPIRE server before SPIRE agents start.")
+	flag.StringVar(&images.SQLiteImage, "sqlite-image", controller.DefaultSQLiteImage,
+		"The image sqlite3 datastores are backed up and restored with.")
+	flag.StringVar(&images.KubectlImage, "kubectl-image", controller.DefaultKubectlImage,
+		"The image storing SPIRE server backups in Secrets.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -72,6 +85,7 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "1919a05a.hpe.com",
+		Cache:                  controller.CacheOptions(),
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -90,19 +104,61 @@ func main() {
 	}
 
 	if err = (&controller.SpireServerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Recorder:  mgr.GetEventRecorderFor("spireserver-controller"),
+		Images:    images,
+		APIReader: mgr.GetAPIReader(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SpireServer")
 		os.Exit(1)
 	}
 	if err = (&controller.SpireAgentReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Recorder:  mgr.GetEventRecorderFor("spireagent-controller"),
+		Images:    images,
+		APIReader: mgr.GetAPIReader(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SpireAgent")
 		os.Exit(1)
 	}
+	if err = (&controller.SpireServerBackupReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("spireserverbackup-controller"),
+		Images:   images,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SpireServerBackup")
+		os.Exit(1)
+	}
+	if err = (&controller.SpireServerRestoreReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("spireserverrestore-controller"),
+		Images:   images,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SpireServerRestore")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&spirev1.SpireServer{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "SpireServer")
+			os.Exit(1)
+		}
+		if err = (&spirev1.SpireAgent{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "SpireAgent")
+			os.Exit(1)
+		}
+		if err = (&spirev1.SpireServerBackup{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "SpireServerBackup")
+			os.Exit(1)
+		}
+		if err = (&spirev1.SpireServerRestore{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "SpireServerRestore")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
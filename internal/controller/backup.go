@@ -0,0 +1,254 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+)
+
+// Backups are taken and restored by Jobs running the tools of the datastore
+// of the SPIRE server. A backup is a directory, or a Secret, holding the dump
+// of the datastore and, for servers keeping their keys on disk, the keys.json
+// file of the disk KeyManager.
+const (
+	// backupDir is where the destination of the backups is mounted
+	backupDir = "/backup"
+
+	// backupNameEnv holds the name of the backup taken, which is the name of
+	// the Job taking it
+	backupNameEnv = "BACKUP_NAME"
+
+	sqliteBackupFile = "datastore.sqlite3"
+	sqlBackupFile    = "datastore.sql"
+	keysBackupFile   = "keys.json"
+)
+
+// backupImage returns the image holding the tools of the datastore of the
+// SPIRE server, unless the SpireServerBackup sets its own.
+func backupImage(images Images, b *spirev1.SpireServerBackup, s *spirev1.SpireServer) string {
+	if b.Spec.Image != "" {
+		return b.Spec.Image
+	}
+
+	// the client of a managed database matches its server
+	if s.Spec.ManagedDataStore != nil {
+		return s.Spec.ManagedDataStore.Image
+	}
+
+	switch strings.ToLower(s.Spec.DataStore) {
+	case "postgres":
+		return spirev1.DefaultPostgresImage
+	case "mysql":
+		return spirev1.DefaultMySQLImage
+	default:
+		return images.sqliteImage()
+	}
+}
+
+// mountsServerData reports whether backups of the SPIRE server read the
+// volume of its first pod, for its sqlite3 database or its keys.
+func mountsServerData(s *spirev1.SpireServer) bool {
+	return s.SQLitePath() != "" || s.KeysPath() != ""
+}
+
+// backupToolContainer returns the container running script against the
+// datastore of the SPIRE server, with backupDir mounted from the volume named
+// "backup".
+func backupToolContainer(name string, image string, s *spirev1.SpireServer, script string) corev1.Container {
+	_, tlsMounts := dataStoreVolumes(s)
+	mounts := append([]corev1.VolumeMount{{Name: "backup", MountPath: backupDir}}, tlsMounts...)
+
+	container := corev1.Container{
+		Name:            name,
+		Image:           image,
+		ImagePullPolicy: s.Spec.ImagePullPolicy,
+		Command:         []string{"/bin/sh", "-c", script},
+		Env:             dataStoreToolEnv(s),
+		VolumeMounts:    mounts,
+	}
+
+	if mountsServerData(s) {
+		// the files of the SPIRE server are only readable by its user
+		root := int64(0)
+		container.SecurityContext = &corev1.SecurityContext{RunAsUser: &root}
+		container.VolumeMounts = append(container.VolumeMounts,
+			corev1.VolumeMount{Name: "spire-data", MountPath: spirev1.DataDir})
+	}
+
+	return container
+}
+
+// backupPodVolumes returns the volumes of the pods backing up or restoring the
+// SPIRE server, along with backup, the volume mounted on backupDir.
+func backupPodVolumes(s *spirev1.SpireServer, backup corev1.Volume) []corev1.Volume {
+	volumes := []corev1.Volume{backup}
+
+	if mountsServerData(s) {
+		volumes = append(volumes, corev1.Volume{
+			Name: "spire-data",
+			VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: serverDataClaimName(s.Name),
+			}},
+		})
+	}
+
+	tlsVolumes, _ := dataStoreVolumes(s)
+	return append(volumes, tlsVolumes...)
+}
+
+// dataStoreToolEnv returns the environment the clients of the datastore of
+// the SPIRE server connect to it with.
+func dataStoreToolEnv(s *spirev1.SpireServer) []corev1.EnvVar {
+	ref := dataStoreSecret(s)
+
+	switch strings.ToLower(s.Spec.DataStore) {
+	case "postgres":
+		if ref == nil {
+			if s.Spec.ConnectionStringSecretRef != nil {
+				return []corev1.EnvVar{secretEnv(connectionStringEnv, s.Spec.ConnectionStringSecretRef.DeepCopy())}
+			}
+			return []corev1.EnvVar{literalEnv(connectionStringEnv, s.Spec.ConnectionString)}
+		}
+
+		env := []corev1.EnvVar{
+			secretEnv(postgresHostEnv, secretKey(ref.Name, ref.HostKey)),
+			secretEnv(postgresUserEnv, secretKey(ref.Name, ref.UserKey)),
+			secretEnv(postgresPasswordEnv, secretKey(ref.Name, ref.PasswordKey)),
+			secretEnv(postgresDatabaseEnv, secretKey(ref.Name, ref.DatabaseKey)),
+		}
+		return append(env, postgresTLSEnv(s.Spec.DataStoreOptions)...)
+	case "mysql":
+		// the mysql clients cannot read the connection string of SPIRE,
+		// ValidateServer rejects such servers before any Job is built
+		if ref == nil {
+			return nil
+		}
+
+		return []corev1.EnvVar{
+			secretEnv(dataStoreHostEnv, secretKey(ref.Name, ref.HostKey)),
+			secretEnv(dataStoreUserEnv, secretKey(ref.Name, ref.UserKey)),
+			secretEnv("MYSQL_PWD", secretKey(ref.Name, ref.PasswordKey)),
+			secretEnv(dataStoreNameEnv, secretKey(ref.Name, ref.DatabaseKey)),
+		}
+	default:
+		return nil
+	}
+}
+
+// backupScript returns the shell script dumping the datastore of the SPIRE
+// server, and copying its keys, into the directory held by the out variable.
+func backupScript(s *spirev1.SpireServer) string {
+	var script string
+
+	switch strings.ToLower(s.Spec.DataStore) {
+	case "postgres":
+		script = "pg_dump --clean --if-exists --no-owner" + postgresDatabaseArgument(s) +
+			` -f "$out/` + sqlBackupFile + `"` + "\n"
+	case "mysql":
+		script = mysqlAddress + "mysqldump --single-transaction" + mysqlArguments(s) +
+			` > "$out/` + sqlBackupFile + `"` + "\n"
+	default:
+		// the backup command of sqlite3 copies a consistent snapshot while
+		// the SPIRE server keeps writing
+		script = "sqlite3 " + shellQuote(s.SQLitePath()) + ` ".backup '$out/` + sqliteBackupFile + `'"` + "\n"
+	}
+
+	if keysPath := s.KeysPath(); keysPath != "" {
+		script += "if [ -f " + shellQuote(keysPath) + " ]; then cp " + shellQuote(keysPath) +
+			` "$out/` + keysBackupFile + `"; fi` + "\n"
+	}
+
+	return script
+}
+
+// restoreScript returns the shell script loading the backup in the directory
+// held by the in variable into the datastore of the SPIRE server, and putting
+// back its keys.
+func restoreScript(s *spirev1.SpireServer) string {
+	var script string
+
+	switch strings.ToLower(s.Spec.DataStore) {
+	case "postgres":
+		script = "psql -v ON_ERROR_STOP=1" + postgresDatabaseArgument(s) + ` -f "$in/` + sqlBackupFile + `"` + "\n"
+	case "mysql":
+		script = mysqlAddress + "mysql" + mysqlArguments(s) + ` < "$in/` + sqlBackupFile + `"` + "\n"
+	default:
+		// the database is swapped in whole, along with dropping the journal of
+		// the one it replaces
+		database := s.SQLitePath()
+		script = `cp "$in/` + sqliteBackupFile + `" ` + shellQuote(database+".restore") + "\n" +
+			"rm -f " + shellQuote(database+"-wal") + " " + shellQuote(database+"-shm") + "\n" +
+			"mv " + shellQuote(database+".restore") + " " + shellQuote(database) + "\n"
+	}
+
+	if keysPath := s.KeysPath(); keysPath != "" {
+		script += `if [ -f "$in/` + keysBackupFile + `" ]; then cp "$in/` + keysBackupFile + `" ` + shellQuote(keysPath) + "; fi\n"
+	}
+
+	return script
+}
+
+// postgresDatabaseArgument returns the argument pointing the postgres clients
+// to the connection string, when the database is not set from the parts of a
+// Secret in the PG variables.
+func postgresDatabaseArgument(s *spirev1.SpireServer) string {
+	if dataStoreSecret(s) != nil {
+		return ""
+	}
+
+	return ` -d "$` + connectionStringEnv + `"`
+}
+
+// mysqlAddress splits the host of the mysql datastore, which may carry its
+// port, into the host and port variables.
+const mysqlAddress = `host="${` + dataStoreHostEnv + `%:*}"
+port=3306
+case "$` + dataStoreHostEnv + `" in *:*) port="${` + dataStoreHostEnv + `##*:}";; esac
+`
+
+// mysqlArguments returns the arguments connecting the mysql clients to the
+// database, whose password is read from MYSQL_PWD.
+func mysqlArguments(s *spirev1.SpireServer) string {
+	args := ` -h "$host" -P "$port" -u "$` + dataStoreUserEnv + `"`
+
+	if options := s.Spec.DataStoreOptions; options != nil && options.TLS != nil {
+		if options.TLS.RootCASecretRef != nil {
+			args += " --ssl-mode=VERIFY_IDENTITY --ssl-ca=" + dataStoreRootCAPath
+		}
+		if options.TLS.ClientCertSecretName != "" {
+			args += " --ssl-cert=" + dataStoreClientCertPath + " --ssl-key=" + dataStoreClientKeyPath
+		}
+	}
+
+	return args + ` "$` + dataStoreNameEnv + `"`
+}
+
+// shellQuote quotes s for the shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// backupPath returns the directory the backup named name is stored in on a
+// volume.
+func backupPath(name string) string {
+	return path.Join(backupDir, name)
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// managedSelector selects the objects generated by the operator.
+var managedSelector = labels.SelectorFromSet(labels.Set{managedByLabel: managedBy})
+
+// CacheOptions returns the options of the cache of the manager running the
+// controllers. The pods, ConfigMaps, Secrets and Jobs the controllers read are
+// all generated by the operator, so only those are cached rather than every
+// one in the cluster.
+func CacheOptions() cache.Options {
+	return cache.Options{
+		ByObject: map[client.Object]cache.ByObject{
+			// the pods of the SPIRE servers, whose health is read from them
+			&corev1.Pod{}: {Label: managedSelector},
+			// the configuration and trust bundles of SPIRE servers and agents
+			&corev1.ConfigMap{}: {Label: managedSelector},
+			// the credentials of managed datastores and the backups kept in
+			// Secrets
+			&corev1.Secret{}: {Label: managedSelector},
+			// the Jobs taking and restoring backups
+			&batchv1.Job{}: {Label: managedSelector},
+		},
+	}
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+)
+
+func cacheSelector(t *testing.T, kind interface{}) labels.Selector {
+	for obj, byObject := range CacheOptions().ByObject {
+		if reflect.TypeOf(obj) == reflect.TypeOf(kind) {
+			return byObject.Label
+		}
+	}
+
+	t.Fatalf("%T should be cached by label", kind)
+	return nil
+}
+
+func TestCacheSelectsServerPods(t *testing.T) {
+	selector := cacheSelector(t, &corev1.Pod{})
+
+	template := reconciler.spireStatefulSetDeployment(mockSpireServer, "default").Spec.Template
+	assert.True(t, selector.Matches(labels.Set(template.Labels)), "the pods of the SPIRE server should be cached")
+	assert.False(t, selector.Matches(labels.Set{"app": "client"}))
+}
+
+func TestCacheSelectsGeneratedConfigMaps(t *testing.T) {
+	selector := cacheSelector(t, &corev1.ConfigMap{})
+
+	server := mockSpireServer.DeepCopy()
+	agent := spireAgentFor(server, "default")
+	for _, configMap := range []*corev1.ConfigMap{
+		reconciler.spireConfigMapDeployment(server, "default", nil),
+		reconciler.spireBundleDeployment(server, "default"),
+		agentReconciler.agentConfigMapDeployment(agent, server, "default"),
+	} {
+		assert.True(t, selector.Matches(labels.Set(configMap.Labels)), "ConfigMap %s should be cached", configMap.Name)
+	}
+	assert.False(t, selector.Matches(labels.Set{}))
+}
+
+func TestCacheSelectsGeneratedSecrets(t *testing.T) {
+	selector := cacheSelector(t, &corev1.Secret{})
+
+	server := mockSpireServer.DeepCopy()
+	server.Spec.ManagedDataStore = &spirev1.ManagedDataStore{}
+	server.Default()
+	secret, err := reconciler.managedDataStoreSecret(server, "default")
+	assert.NoError(t, err)
+	assert.True(t, selector.Matches(labels.Set(secret.Labels)), "the managed datastore Secret should be cached")
+
+	backup := createSpireServerBackup(claimDestination)
+	assert.True(t, selector.Matches(labels.Set(componentLabels(backupApp, backup.Name))),
+		"the Secrets holding backups should be cached")
+	assert.False(t, selector.Matches(labels.Set{}))
+}
+
+func TestCacheSelectsBackupJobs(t *testing.T) {
+	selector := cacheSelector(t, &batchv1.Job{})
+
+	server := mockSpireServer.DeepCopy()
+	backup := createSpireServerBackup(claimDestination)
+	backupReconciler := &SpireServerBackupReconciler{}
+	restore := createSpireServerRestore()
+	restore.Status.BackupName = "spire-backup-28000000"
+	restoreReconciler := &SpireServerRestoreReconciler{}
+
+	for _, jobLabels := range []map[string]string{
+		backupReconciler.backupJob(backup, server).Labels,
+		backupReconciler.backupCronJob(backup, server).Spec.JobTemplate.Labels,
+		restoreReconciler.restoreJob(restore, backup, server).Labels,
+	} {
+		assert.True(t, selector.Matches(labels.Set(jobLabels)), "Job labelled %v should be cached", jobLabels)
+	}
+	assert.False(t, selector.Matches(labels.Set{}))
+}
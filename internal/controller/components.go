@@ -0,0 +1,343 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+)
+
+// component is a desired object generated by a reconciler, along with the
+// name it is reported under in logs.
+type component struct {
+	name   string
+	object client.Object
+}
+
+// configHashAnnotation is set on the pod templates of SPIRE servers and agents
+// to a hash of their configuration, so that changes to it roll the pods.
+const configHashAnnotation = "spire.hpe.com/config-hash"
+
+// stampConfigHash annotates template with the hash of the data of configMap.
+func stampConfigHash(template *corev1.PodTemplateSpec, configMap *corev1.ConfigMap) {
+	keys := make([]string, 0, len(configMap.Data))
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s\x00%s\x00", key, configMap.Data[key])
+	}
+
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[configHashAnnotation] = hex.EncodeToString(hash.Sum(nil))
+}
+
+// schedulePods applies the scheduling controls of a SPIRE server or agent to
+// the spec of its pods. Spread constraints without a label selector select
+// the pods matched by selector.
+func schedulePods(podSpec *corev1.PodSpec, scheduling spirev1.PodScheduling, selector map[string]string) {
+	podSpec.NodeSelector = scheduling.NodeSelector
+	podSpec.Tolerations = scheduling.Tolerations
+	podSpec.Affinity = scheduling.Affinity
+	podSpec.PriorityClassName = scheduling.PriorityClassName
+
+	for _, constraint := range scheduling.TopologySpreadConstraints {
+		if constraint.LabelSelector == nil {
+			constraint.LabelSelector = &metav1.LabelSelector{MatchLabels: selector}
+		}
+		podSpec.TopologySpreadConstraints = append(podSpec.TopologySpreadConstraints, constraint)
+	}
+}
+
+// reconcileComponents creates each desired object that does not exist yet and
+// patches existing objects whose live state has drifted from the desired one.
+// Namespaced objects are made controlled by owner so that they are garbage
+// collected along with it. Components are reconciled in order, stopping at
+// the first failure.
+func reconcileComponents(ctx context.Context, c client.Client, scheme *runtime.Scheme, owner client.Object,
+	components []component, logger logr.Logger) error {
+	for _, comp := range components {
+		result, err := reconcileComponent(ctx, c, scheme, owner, comp.object)
+		if err != nil {
+			logger.Error(err, "Failed to reconcile", "Name", comp.name)
+			return err
+		}
+
+		if result != controllerutil.OperationResultNone {
+			logger.Info("Reconciled component", "Name", comp.name, "Operation", result)
+		}
+	}
+
+	return nil
+}
+
+func reconcileComponent(ctx context.Context, c client.Client, scheme *runtime.Scheme, owner client.Object,
+	desired client.Object) (controllerutil.OperationResult, error) {
+	live := reflect.New(reflect.TypeOf(desired).Elem()).Interface().(client.Object)
+	live.SetName(desired.GetName())
+	live.SetNamespace(desired.GetNamespace())
+
+	result, err := controllerutil.CreateOrPatch(ctx, c, live, func() error {
+		if err := mutateComponent(live, desired); err != nil {
+			return err
+		}
+
+		// cluster-scoped objects cannot be owned by a namespaced resource
+		if owner == nil || live.GetNamespace() == "" {
+			return nil
+		}
+
+		return controllerutil.SetControllerReference(owner, live, scheme)
+	})
+
+	// the generation written tells rollouts apart from the stale copies of
+	// the object the cache may still hold
+	desired.SetGeneration(live.GetGeneration())
+
+	return result, err
+}
+
+// mutateComponent brings live in line with desired. Objects that do not exist
+// yet take the desired state wholesale; existing objects only have the fields
+// the operator manages reset, so values defaulted by the API server and data
+// written by SPIRE itself (such as the trust bundle) are left alone. Pod
+// templates and ports are compared with matchesDesired, so that additions made
+// out of band are reverted as well.
+func mutateComponent(live client.Object, desired client.Object) error {
+	if live.GetResourceVersion() == "" {
+		reflect.ValueOf(live).Elem().Set(reflect.ValueOf(desired.DeepCopyObject()).Elem())
+		return nil
+	}
+
+	live.SetLabels(mergeStringMaps(live.GetLabels(), desired.GetLabels()))
+
+	switch want := desired.(type) {
+	case *corev1.ServiceAccount:
+	case *corev1.ConfigMap:
+		have := live.(*corev1.ConfigMap)
+		if want.Data != nil && !equality.Semantic.DeepEqual(want.Data, have.Data) {
+			have.Data = want.Data
+		}
+	case *corev1.Secret:
+		// generated credentials are kept once stored, only missing keys
+		// are added
+		have := live.(*corev1.Secret)
+		for key, value := range want.Data {
+			if _, ok := have.Data[key]; !ok {
+				if have.Data == nil {
+					have.Data = map[string][]byte{}
+				}
+				have.Data[key] = value
+			}
+		}
+	case *corev1.Service:
+		mutateService(live.(*corev1.Service), want)
+	case *rbacv1.Role:
+		live.(*rbacv1.Role).Rules = want.Rules
+	case *rbacv1.ClusterRole:
+		live.(*rbacv1.ClusterRole).Rules = want.Rules
+	case *rbacv1.RoleBinding:
+		have := live.(*rbacv1.RoleBinding)
+		have.Subjects = want.Subjects
+		have.RoleRef = want.RoleRef
+	case *rbacv1.ClusterRoleBinding:
+		have := live.(*rbacv1.ClusterRoleBinding)
+		have.Subjects = want.Subjects
+		have.RoleRef = want.RoleRef
+	case *appsv1.StatefulSet:
+		have := live.(*appsv1.StatefulSet)
+		have.Spec.Replicas = want.Spec.Replicas
+		if !matchesDesired(want.Spec.Template, have.Spec.Template) {
+			have.Spec.Template = want.Spec.Template
+		}
+	case *appsv1.DaemonSet:
+		have := live.(*appsv1.DaemonSet)
+		if !matchesDesired(want.Spec.Template, have.Spec.Template) {
+			have.Spec.Template = want.Spec.Template
+		}
+	case *batchv1.Job:
+		// the pod template of a Job cannot be changed, the Job runs once
+	case *batchv1.CronJob:
+		have := live.(*batchv1.CronJob)
+		have.Spec.Schedule = want.Spec.Schedule
+		have.Spec.Suspend = want.Spec.Suspend
+		have.Spec.ConcurrencyPolicy = want.Spec.ConcurrencyPolicy
+		if !matchesDesired(want.Spec.JobTemplate, have.Spec.JobTemplate) {
+			have.Spec.JobTemplate = want.Spec.JobTemplate
+		}
+	default:
+		return fmt.Errorf("unsupported component type %T", desired)
+	}
+
+	return nil
+}
+
+func mutateService(have *corev1.Service, want *corev1.Service) {
+	ports := make([]corev1.ServicePort, len(want.Spec.Ports))
+	copy(ports, want.Spec.Ports)
+
+	// node ports are allocated by the API server, keep the ones already assigned
+	for i := range ports {
+		for _, livePort := range have.Spec.Ports {
+			if ports[i].NodePort == 0 && livePort.Name == ports[i].Name {
+				ports[i].NodePort = livePort.NodePort
+			}
+		}
+	}
+
+	if !matchesDesired(ports, have.Spec.Ports) {
+		have.Spec.Ports = ports
+	}
+
+	have.Spec.Type = want.Spec.Type
+	have.Spec.Selector = want.Spec.Selector
+}
+
+// apiDefaultedFields are the pointer and map fields of pod templates, Jobs and
+// Services the API server fills in when they are left unset, such as the
+// default mode of volumes or the requests of containers that only set limits.
+var apiDefaultedFields = map[string]bool{
+	"TerminationGracePeriodSeconds": true,
+	"EnableServiceLinks":            true,
+	"DefaultMode":                   true,
+	"ExpirationSeconds":             true,
+	"Requests":                      true,
+	"Completions":                   true,
+	"Parallelism":                   true,
+	"BackoffLimit":                  true,
+	"CompletionMode":                true,
+}
+
+// matchesDesired reports whether the live state of an object field holds the
+// desired one. Lists and maps must match exactly, as must every field set in
+// desired. Fields left unset in desired accept the value the API server
+// defaults them to: scalars, apiDefaultedFields, and pointers to zero values
+// such as the empty security context of pods.
+func matchesDesired(desired interface{}, live interface{}) bool {
+	return valueMatches(reflect.ValueOf(desired), reflect.ValueOf(live))
+}
+
+func valueMatches(want reflect.Value, have reflect.Value) bool {
+	switch want.Kind() {
+	case reflect.Struct:
+		// types with unexported fields, such as quantities and timestamps,
+		// have their own semantic equality
+		if opaque(want.Type()) {
+			return equality.Semantic.DeepEqual(want.Interface(), have.Interface())
+		}
+
+		for i := 0; i < want.NumField(); i++ {
+			field := want.Field(i)
+			unset := (field.Kind() == reflect.Pointer && field.IsNil()) || (field.Kind() == reflect.Map && field.Len() == 0)
+			if unset && apiDefaultedFields[want.Type().Field(i).Name] {
+				continue
+			}
+
+			if !valueMatches(field, have.Field(i)) {
+				return false
+			}
+		}
+
+		return true
+	case reflect.Slice:
+		if want.Len() != have.Len() {
+			return false
+		}
+
+		for i := 0; i < want.Len(); i++ {
+			if !valueMatches(want.Index(i), have.Index(i)) {
+				return false
+			}
+		}
+
+		return true
+	case reflect.Map:
+		if want.Len() != have.Len() {
+			return false
+		}
+
+		for _, key := range want.MapKeys() {
+			value := have.MapIndex(key)
+			if !value.IsValid() || !valueMatches(want.MapIndex(key), value) {
+				return false
+			}
+		}
+
+		return true
+	case reflect.Pointer:
+		if want.IsNil() {
+			return have.IsNil() || have.Elem().IsZero()
+		}
+
+		return !have.IsNil() && valueMatches(want.Elem(), have.Elem())
+	case reflect.Interface:
+		return equality.Semantic.DeepEqual(want.Interface(), have.Interface())
+	default:
+		return want.IsZero() || want.Interface() == have.Interface()
+	}
+}
+
+// opaque reports whether the struct type t holds unexported fields, directly
+// or in the structs it embeds.
+func opaque(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || (field.Anonymous && field.Type.Kind() == reflect.Struct && opaque(field.Type)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mergeStringMaps(base map[string]string, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return base
+	}
+
+	merged := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+
+	return merged
+}
@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+)
+
+var testScheme = func() *runtime.Scheme {
+	s := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(s)
+	_ = spirev1.AddToScheme(s)
+	return s
+}()
+
+func serverWithPort(port int) *spirev1.SpireServer {
+	server := mockSpireServer.DeepCopy()
+	server.Spec.Port = port
+	return server
+}
+
+func TestReconcileComponentCreatesMissingObject(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithScheme(testScheme).Build()
+
+	result, err := reconcileComponent(ctx, c, testScheme, nil, reconciler.spireServiceDeployment(mockSpireServer, "default"))
+	assert.NoError(t, err)
+	assert.Equal(t, controllerutil.OperationResultCreated, result)
+
+	service := &corev1.Service{}
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: "valid-spire-server", Namespace: "default"}, service))
+	assert.Equal(t, int32(8081), service.Spec.Ports[0].Port)
+}
+
+func TestReconcileComponentIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithScheme(testScheme).Build()
+	components := []component{
+		{"serviceAccount", reconciler.createServiceAccount(mockSpireServer, "default")},
+		{"serverConfigMap", reconciler.spireConfigMapDeployment(mockSpireServer, "default", nil)},
+		{"spireStatefulSet", reconciler.spireStatefulSetDeployment(mockSpireServer, "default")},
+		{"spireService", reconciler.spireServiceDeployment(mockSpireServer, "default")},
+	}
+
+	assert.NoError(t, reconcileComponents(ctx, c, testScheme, nil, components, log.Log))
+
+	for _, comp := range components {
+		result, err := reconcileComponent(ctx, c, testScheme, nil, comp.object)
+		assert.NoError(t, err)
+		assert.Equal(t, controllerutil.OperationResultNone, result, comp.name)
+	}
+}
+
+func TestReconcileComponentAppliesSpecChanges(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithScheme(testScheme).Build()
+
+	_, err := reconcileComponent(ctx, c, testScheme, nil, reconciler.spireServiceDeployment(mockSpireServer, "default"))
+	assert.NoError(t, err)
+
+	result, err := reconcileComponent(ctx, c, testScheme, nil, reconciler.spireServiceDeployment(serverWithPort(9090), "default"))
+	assert.NoError(t, err)
+	assert.Equal(t, controllerutil.OperationResultUpdated, result)
+
+	service := &corev1.Service{}
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: "valid-spire-server", Namespace: "default"}, service))
+	assert.Equal(t, int32(9090), service.Spec.Ports[0].Port)
+}
+
+func TestReconcileComponentRevertsManualEdits(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithScheme(testScheme).Build()
+	key := types.NamespacedName{Name: "valid-spire-server", Namespace: "default"}
+
+	_, err := reconcileComponent(ctx, c, testScheme, nil, reconciler.spireStatefulSetDeployment(mockSpireServer, "default"))
+	assert.NoError(t, err)
+
+	statefulSet := &appsv1.StatefulSet{}
+	assert.NoError(t, c.Get(ctx, key, statefulSet))
+	replicas := int32(5)
+	statefulSet.Spec.Replicas = &replicas
+	statefulSet.Spec.Template.Spec.Containers[0].Image = "example.com/spire-server:latest"
+	assert.NoError(t, c.Update(ctx, statefulSet))
+
+	result, err := reconcileComponent(ctx, c, testScheme, nil, reconciler.spireStatefulSetDeployment(mockSpireServer, "default"))
+	assert.NoError(t, err)
+	assert.Equal(t, controllerutil.OperationResultUpdated, result)
+
+	assert.NoError(t, c.Get(ctx, key, statefulSet))
+	assert.Equal(t, int32(1), *statefulSet.Spec.Replicas)
+	assert.Equal(t, "ghcr.io/spiffe/spire-server:1.5.1", statefulSet.Spec.Template.Spec.Containers[0].Image)
+}
+
+func TestReconcileComponentRevertsAdditions(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Spec.PodScheduling.NodeSelector = map[string]string{"disktype": "ssd"}
+	c := fake.NewClientBuilder().WithScheme(testScheme).Build()
+	key := types.NamespacedName{Name: "valid-spire-server", Namespace: "default"}
+
+	_, err := reconcileComponent(ctx, c, testScheme, nil, reconciler.spireStatefulSetDeployment(server, "default"))
+	assert.NoError(t, err)
+
+	statefulSet := &appsv1.StatefulSet{}
+	assert.NoError(t, c.Get(ctx, key, statefulSet))
+	podSpec := &statefulSet.Spec.Template.Spec
+	podSpec.Containers = append(podSpec.Containers, corev1.Container{Name: "sidecar", Image: "busybox"})
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, corev1.EnvVar{Name: "DEBUG", Value: "true"})
+	podSpec.NodeSelector["zone"] = "a"
+	podSpec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{}}
+	assert.NoError(t, c.Update(ctx, statefulSet))
+
+	result, err := reconcileComponent(ctx, c, testScheme, nil, reconciler.spireStatefulSetDeployment(server, "default"))
+	assert.NoError(t, err)
+	assert.Equal(t, controllerutil.OperationResultUpdated, result)
+
+	assert.NoError(t, c.Get(ctx, key, statefulSet))
+	podSpec = &statefulSet.Spec.Template.Spec
+	assert.Len(t, podSpec.Containers, 1)
+	assert.NotContains(t, podSpec.Containers[0].Env, corev1.EnvVar{Name: "DEBUG", Value: "true"})
+	assert.Equal(t, map[string]string{"disktype": "ssd"}, podSpec.NodeSelector)
+	assert.Nil(t, podSpec.Affinity)
+}
+
+func TestReconcileComponentKeepsAPIDefaults(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Spec.Resources = corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+	}
+	c := fake.NewClientBuilder().WithScheme(testScheme).Build()
+	key := types.NamespacedName{Name: "valid-spire-server", Namespace: "default"}
+
+	_, err := reconcileComponent(ctx, c, testScheme, nil, reconciler.spireStatefulSetDeployment(server, "default"))
+	assert.NoError(t, err)
+
+	// values the API server fills in for fields the operator leaves unset
+	statefulSet := &appsv1.StatefulSet{}
+	assert.NoError(t, c.Get(ctx, key, statefulSet))
+	gracePeriod := int64(30)
+	podSpec := &statefulSet.Spec.Template.Spec
+	podSpec.TerminationGracePeriodSeconds = &gracePeriod
+	podSpec.SecurityContext = &corev1.PodSecurityContext{}
+	podSpec.DNSPolicy = corev1.DNSClusterFirst
+	podSpec.SchedulerName = corev1.DefaultSchedulerName
+	podSpec.Containers[0].TerminationMessagePath = corev1.TerminationMessagePathDefault
+	podSpec.Containers[0].Resources.Requests = podSpec.Containers[0].Resources.Limits
+	assert.NoError(t, c.Update(ctx, statefulSet))
+
+	result, err := reconcileComponent(ctx, c, testScheme, nil, reconciler.spireStatefulSetDeployment(server, "default"))
+	assert.NoError(t, err)
+	assert.Equal(t, controllerutil.OperationResultNone, result)
+}
+
+func TestReconcileComponentKeepsBundleData(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithScheme(testScheme).Build()
+	key := types.NamespacedName{Name: "valid-spire-server-bundle", Namespace: "default"}
+
+	_, err := reconcileComponent(ctx, c, testScheme, nil, reconciler.spireBundleDeployment(mockSpireServer, "default"))
+	assert.NoError(t, err)
+
+	bundle := &corev1.ConfigMap{}
+	assert.NoError(t, c.Get(ctx, key, bundle))
+	bundle.Data = map[string]string{"bundle.crt": "certificate"}
+	assert.NoError(t, c.Update(ctx, bundle))
+
+	result, err := reconcileComponent(ctx, c, testScheme, nil, reconciler.spireBundleDeployment(mockSpireServer, "default"))
+	assert.NoError(t, err)
+	assert.Equal(t, controllerutil.OperationResultNone, result)
+
+	assert.NoError(t, c.Get(ctx, key, bundle))
+	assert.Equal(t, "certificate", bundle.Data["bundle.crt"])
+}
+
+func TestReconcileComponentKeepsAllocatedNodePort(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithScheme(testScheme).Build()
+	key := types.NamespacedName{Name: "valid-spire-server", Namespace: "default"}
+
+	_, err := reconcileComponent(ctx, c, testScheme, nil, reconciler.spireServiceDeployment(mockSpireServer, "default"))
+	assert.NoError(t, err)
+
+	service := &corev1.Service{}
+	assert.NoError(t, c.Get(ctx, key, service))
+	service.Spec.Ports[0].NodePort = 30081
+	assert.NoError(t, c.Update(ctx, service))
+
+	result, err := reconcileComponent(ctx, c, testScheme, nil, reconciler.spireServiceDeployment(mockSpireServer, "default"))
+	assert.NoError(t, err)
+	assert.Equal(t, controllerutil.OperationResultNone, result)
+
+	assert.NoError(t, c.Get(ctx, key, service))
+	assert.Equal(t, int32(30081), service.Spec.Ports[0].NodePort)
+}
+
+func TestReconcileComponentsSetsOwnerReferences(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithScheme(testScheme).Build()
+	owner := mockSpireServer.DeepCopy()
+	owner.UID = "server-uid"
+	components := []component{
+		{"serviceAccount", reconciler.createServiceAccount(mockSpireServer, "default")},
+		{"clusterRole", reconciler.spireClusterRoleDeployment(mockSpireServer, "default")},
+	}
+
+	assert.NoError(t, reconcileComponents(ctx, c, testScheme, owner, components, log.Log))
+
+	serviceAccount := &corev1.ServiceAccount{}
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: "valid-spire-server-server", Namespace: "default"}, serviceAccount))
+	assert.True(t, metav1.IsControlledBy(serviceAccount, owner))
+
+	clusterRole := &rbacv1.ClusterRole{}
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: "valid-spire-server-trust-role-default"}, clusterRole))
+	assert.Empty(t, clusterRole.OwnerReferences)
+}
+
+func TestReconcileComponentsAdoptsExistingObjects(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(reconciler.spireServiceDeployment(mockSpireServer, "default")).Build()
+	owner := mockSpireServer.DeepCopy()
+	owner.UID = "server-uid"
+
+	result, err := reconcileComponent(ctx, c, testScheme, owner, reconciler.spireServiceDeployment(mockSpireServer, "default"))
+	assert.NoError(t, err)
+	assert.Equal(t, controllerutil.OperationResultUpdated, result)
+
+	service := &corev1.Service{}
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: "valid-spire-server", Namespace: "default"}, service))
+	assert.True(t, metav1.IsControlledBy(service, owner))
+}
@@ -0,0 +1,343 @@
+package controller
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// assertGolden compares config with testdata/name, which is rewritten instead
+// when the tests run with -update.
+func assertGolden(t *testing.T, name string, config string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+
+	if *update {
+		assert.NoError(t, os.MkdirAll("testdata", 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(config), 0o644))
+		return
+	}
+
+	golden, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, string(golden), config)
+}
+
+var goldenDataStores = []struct {
+	name             string
+	connectionString string
+}{
+	{"sqlite3", spirev1.DefaultConnectionString},
+	{"postgres", `dbname=spire host=db.spire.svc user=spire password='pa"ss\word'`},
+	{"mysql", "spire:pa\"ss@tcp(db.spire.svc:3306)/spire?parseTime=true"},
+}
+
+func TestServerConfigGolden(t *testing.T) {
+	for _, nodeAttestor := range []string{"join_token", "k8s_sat", "k8s_psat"} {
+		for _, dataStore := range goldenDataStores {
+			name := "server-" + nodeAttestor + "-" + dataStore.name + ".conf"
+			t.Run(name, func(t *testing.T) {
+				server := &spirev1.SpireServer{
+					ObjectMeta: metav1.ObjectMeta{Name: "spire-server", Namespace: "spire"},
+					Spec: spirev1.SpireServerSpec{
+						TrustDomain:      "example.org",
+						NodeAttestors:    []spirev1.NodeAttestor{{Name: nodeAttestor}},
+						DataStore:        dataStore.name,
+						ConnectionString: dataStore.connectionString,
+					},
+				}
+				server.Default()
+
+				config := serverConfig(server, "spire", []string{"workloads:spire-agent", "spire:spire-agent"})
+				assertGolden(t, name, config.Render())
+			})
+		}
+	}
+}
+
+func TestAgentConfigGolden(t *testing.T) {
+	server := &spirev1.SpireServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-server", Namespace: "spire"},
+		Spec:       spirev1.SpireServerSpec{TrustDomain: "example.org"},
+	}
+	server.Default()
+
+	for _, nodeAttestor := range []string{"join_token", "k8s_sat", "k8s_psat"} {
+		for _, workloadAttestor := range []string{"k8s", "unix", "docker", "systemd", "windows"} {
+			name := "agent-" + nodeAttestor + "-" + workloadAttestor + ".conf"
+			t.Run(name, func(t *testing.T) {
+				agent := &spirev1.SpireAgent{
+					ObjectMeta: metav1.ObjectMeta{Name: "spire-agent", Namespace: "spire"},
+					Spec: spirev1.SpireAgentSpec{
+						ServerRef:         spirev1.ServerReference{Name: server.Name},
+						NodeAttestor:      spirev1.NodeAttestor{Name: nodeAttestor},
+						WorkloadAttestors: []spirev1.WorkloadAttestor{{Name: workloadAttestor}},
+					},
+				}
+				agent.Default()
+
+				assertGolden(t, name, agentConfig(agent, server).Render())
+			})
+		}
+	}
+}
+
+func TestKeyManagersGolden(t *testing.T) {
+	server := &spirev1.SpireServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-server", Namespace: "spire"},
+		Spec: spirev1.SpireServerSpec{
+			TrustDomain: "example.org",
+			KeyManager:  &spirev1.ServerKeyManager{Memory: &spirev1.MemoryKeyManager{}},
+		},
+	}
+	server.Default()
+	assertGolden(t, "server-memory.conf", serverConfig(server, "spire", nil).Render())
+
+	server.Spec.KeyManager = &spirev1.ServerKeyManager{Plugin: &spirev1.PluginKeyManager{
+		Name: "aws_kms",
+		ConfigSecretRef: spirev1.PluginConfigSecretReference{
+			Name: "aws-kms",
+			Keys: []string{"region", "access_key_id", "secret_access_key"},
+		},
+	}}
+	assertGolden(t, "server-aws_kms.conf", serverConfig(server, "spire", nil).Render())
+
+	agent := &spirev1.SpireAgent{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-agent", Namespace: "spire"},
+		Spec: spirev1.SpireAgentSpec{
+			ServerRef:  spirev1.ServerReference{Name: server.Name},
+			KeyManager: &spirev1.AgentKeyManager{Disk: &spirev1.AgentDiskKeyManager{Directory: "keys"}},
+		},
+	}
+	agent.Default()
+	assertGolden(t, "agent-disk.conf", agentConfig(agent, server).Render())
+}
+
+func TestDataStoreSecretsGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(s *spirev1.SpireServer)
+	}{
+		{"server-connection-string-secret.conf", func(s *spirev1.SpireServer) {
+			s.Spec.ConnectionStringSecretRef = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "datastore"}, Key: "dsn"}
+		}},
+		{"server-postgres-secret.conf", func(s *spirev1.SpireServer) {
+			s.Spec.DataStoreSecretRef = &spirev1.DataStoreSecretReference{Name: "datastore"}
+		}},
+		{"server-mysql-secret.conf", func(s *spirev1.SpireServer) {
+			s.Spec.DataStore = "mysql"
+			s.Spec.DataStoreSecretRef = &spirev1.DataStoreSecretReference{Name: "datastore"}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &spirev1.SpireServer{
+				ObjectMeta: metav1.ObjectMeta{Name: "spire-server", Namespace: "spire"},
+				Spec:       spirev1.SpireServerSpec{TrustDomain: "example.org", DataStore: "postgres"},
+			}
+			tt.mutate(server)
+			server.Default()
+
+			assertGolden(t, tt.name, serverConfig(server, "spire", nil).Render())
+		})
+	}
+}
+
+func TestDataStoreOptionsGolden(t *testing.T) {
+	maxOpenConns, maxIdleConns := 50, 10
+	options := &spirev1.DataStoreOptions{
+		TLS: &spirev1.DataStoreTLS{
+			RootCASecretRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "datastore-ca"}, Key: "ca.pem"},
+			ClientCertSecretName: "datastore-client",
+		},
+		MaxOpenConns:     &maxOpenConns,
+		MaxIdleConns:     &maxIdleConns,
+		ConnMaxLifetime:  &metav1.Duration{Duration: time.Hour},
+		DisableMigration: true,
+		ReadOnlyConnectionStringSecretRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "datastore"}, Key: "replica"},
+	}
+
+	for _, dataStore := range []string{"mysql", "postgres"} {
+		name := "server-" + dataStore + "-options.conf"
+		t.Run(name, func(t *testing.T) {
+			server := &spirev1.SpireServer{
+				ObjectMeta: metav1.ObjectMeta{Name: "spire-server", Namespace: "spire"},
+				Spec: spirev1.SpireServerSpec{
+					TrustDomain:        "example.org",
+					DataStore:          dataStore,
+					DataStoreSecretRef: &spirev1.DataStoreSecretReference{Name: "datastore"},
+					DataStoreOptions:   options,
+				},
+			}
+			server.Default()
+
+			assertGolden(t, name, serverConfig(server, "spire", nil).Render())
+		})
+	}
+}
+
+func TestCertificateAuthorityGolden(t *testing.T) {
+	server := &spirev1.SpireServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-server", Namespace: "spire"},
+		Spec: spirev1.SpireServerSpec{
+			TrustDomain: "example.org",
+			CA: &spirev1.CertificateAuthority{
+				KeyType: "ec-p384",
+				Subject: &spirev1.CASubject{
+					Country:      []string{"FR"},
+					Organization: []string{"Example"},
+					CommonName:   "Example SPIRE CA",
+				},
+				TTL:         &metav1.Duration{Duration: 48 * time.Hour},
+				X509SVIDTTL: &metav1.Duration{Duration: 4 * time.Hour},
+				JWTSVIDTTL:  &metav1.Duration{Duration: 10 * time.Minute},
+				JWTIssuer:   "https://oidc.example.org",
+			},
+		},
+	}
+	server.Default()
+
+	assertGolden(t, "server-ca.conf", serverConfig(server, "spire", nil).Render())
+}
+
+func TestUpstreamAuthorityGolden(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream *spirev1.UpstreamAuthority
+	}{
+		{"server-upstream-disk.conf", &spirev1.UpstreamAuthority{
+			Disk: &spirev1.DiskUpstreamAuthority{SecretName: "upstream-ca", BundleKey: "ca.crt"},
+		}},
+		{"server-upstream-cert-manager.conf", &spirev1.UpstreamAuthority{
+			CertManager: &spirev1.CertManagerUpstreamAuthority{
+				IssuerRef: spirev1.IssuerReference{Name: "corporate-ca", Kind: "ClusterIssuer"},
+			},
+		}},
+		{"server-upstream-vault.conf", &spirev1.UpstreamAuthority{
+			Vault: &spirev1.VaultUpstreamAuthority{
+				Address:       "https://vault.vault:8200",
+				PKIMountPoint: "pki_int",
+				CACertSecretRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "vault-ca"}, Key: "ca.crt"},
+				KubernetesAuth: spirev1.VaultKubernetesAuth{RoleName: "spire-server"},
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &spirev1.SpireServer{
+				ObjectMeta: metav1.ObjectMeta{Name: "spire-server", Namespace: "spire"},
+				Spec:       spirev1.SpireServerSpec{TrustDomain: "example.org", UpstreamAuthority: tt.upstream},
+			}
+			server.Default()
+
+			assertGolden(t, tt.name, serverConfig(server, "spire", nil).Render())
+		})
+	}
+}
+
+func TestKubernetesNodeAttestorGolden(t *testing.T) {
+	server := &spirev1.SpireServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-server", Namespace: "spire"},
+		Spec: spirev1.SpireServerSpec{
+			TrustDomain: "example.org",
+			NodeAttestors: []spirev1.NodeAttestor{{
+				Name: "k8s_psat",
+				Kubernetes: &spirev1.KubernetesNodeAttestor{
+					Cluster:                 "production",
+					ServiceAccountAllowList: []string{"spire:spire-agent", "edge:edge-agent"},
+					Audience:                []string{"spire-production"},
+					AllowedNodeLabelKeys:    []string{"topology.kubernetes.io/zone"},
+					AllowedPodLabelKeys:     []string{"app"},
+					TokenPath:               "/var/run/secrets/spire/token",
+				},
+			}},
+		},
+	}
+	server.Default()
+	agent := &spirev1.SpireAgent{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-agent", Namespace: "spire"},
+		Spec: spirev1.SpireAgentSpec{
+			ServerRef:    spirev1.ServerReference{Name: server.Name},
+			NodeAttestor: spirev1.NodeAttestor{Name: "k8s_psat"},
+		},
+	}
+	agent.Default()
+
+	assertGolden(t, "server-k8s_psat-cluster.conf", serverConfig(server, "spire", []string{"spire:spire-agent"}).Render())
+	assertGolden(t, "agent-k8s_psat-cluster.conf", agentConfig(agent, server).Render())
+}
+
+func TestNodeAttestorsGolden(t *testing.T) {
+	server := &spirev1.SpireServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-server", Namespace: "spire"},
+		Spec: spirev1.SpireServerSpec{
+			TrustDomain: "example.org",
+			NodeAttestors: []spirev1.NodeAttestor{
+				{Name: "x509pop", X509PoP: &spirev1.X509PoPNodeAttestor{
+					CABundleSecretRef: secretKey("x509pop-ca", "ca.crt"),
+				}},
+				{Name: "tpm_devid", TPMDevID: &spirev1.TPMDevIDNodeAttestor{
+					DevIDCASecretRef:       secretKey("tpm-ca", "devid-ca.crt"),
+					EndorsementCASecretRef: secretKey("tpm-ca", "endorsement-ca.crt"),
+				}},
+				{Name: "aws_iid", AWSIID: &spirev1.AWSIIDNodeAttestor{
+					CredentialsSecretName: "aws-credentials",
+					AssumeRole:            "spire-server",
+					SkipBlockDevice:       true,
+				}},
+				{Name: "gcp_iit", GCPIIT: &spirev1.GCPIITNodeAttestor{
+					ProjectIDAllowList:  []string{"edge-fleet"},
+					UseInstanceMetadata: true,
+					AllowedLabelKeys:    []string{"role"},
+				}},
+				{Name: "azure_msi", AzureMSI: &spirev1.AzureMSINodeAttestor{
+					Tenants: []spirev1.AzureTenant{
+						{TenantID: "0ba5c0e2-0c5e-4a43-a4a4-4b2a4e4f3a6d"},
+						{TenantID: "partner.onmicrosoft.com", ResourceID: "api://spire", CredentialsSecretName: "azure-partner"},
+					},
+				}},
+			},
+		},
+	}
+	server.Default()
+
+	assertGolden(t, "server-node-attestors.conf", serverConfig(server, "spire", nil).Render())
+
+	for _, attestor := range []spirev1.NodeAttestor{
+		{Name: "x509pop", X509PoP: &spirev1.X509PoPNodeAttestor{CertificateHostPath: "/etc/spire-agent/x509pop"}},
+		{Name: "tpm_devid", TPMDevID: &spirev1.TPMDevIDNodeAttestor{DevIDHostPath: "/etc/spire-agent/devid"}},
+		{Name: "aws_iid"},
+		{Name: "gcp_iit"},
+		{Name: "azure_msi", AzureMSI: &spirev1.AzureMSINodeAttestor{ResourceID: "api://spire"}},
+	} {
+		name := "agent-" + attestor.Name + ".conf"
+		t.Run(name, func(t *testing.T) {
+			agent := &spirev1.SpireAgent{
+				ObjectMeta: metav1.ObjectMeta{Name: "spire-agent", Namespace: "spire"},
+				Spec: spirev1.SpireAgentSpec{
+					ServerRef:    spirev1.ServerReference{Name: server.Name},
+					NodeAttestor: attestor,
+				},
+			}
+			agent.Default()
+
+			assertGolden(t, name, agentConfig(agent, server).Render())
+		})
+	}
+}
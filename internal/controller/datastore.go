@@ -0,0 +1,280 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+	"github.com/glcp/spire-k8s-operator/internal/spireconfig"
+)
+
+// Environment variables of the SPIRE server container holding datastore
+// credentials read from Secrets. SPIRE expands them in server.conf, so the
+// credentials never land in the ConfigMap.
+const (
+	connectionStringEnv = "SPIRE_DATASTORE_CONNECTION_STRING"
+	dataStoreHostEnv    = "SPIRE_DATASTORE_HOST"
+	dataStoreUserEnv    = "SPIRE_DATASTORE_USER"
+	dataStorePassEnv    = "SPIRE_DATASTORE_PASSWORD"
+	dataStoreNameEnv    = "SPIRE_DATASTORE_DATABASE"
+	roConnectionEnv     = "SPIRE_DATASTORE_RO_CONNECTION_STRING"
+)
+
+// Environment variables postgres clients read the parts of the connection
+// string missing from it from. Unlike values spliced into the connection
+// string, they need no quoting, and they apply to the read-only connection
+// string as well.
+const (
+	postgresHostEnv        = "PGHOST"
+	postgresUserEnv        = "PGUSER"
+	postgresPasswordEnv    = "PGPASSWORD"
+	postgresDatabaseEnv    = "PGDATABASE"
+	postgresSSLModeEnv     = "PGSSLMODE"
+	postgresSSLRootCertEnv = "PGSSLROOTCERT"
+	postgresSSLCertEnv     = "PGSSLCERT"
+	postgresSSLKeyEnv      = "PGSSLKEY"
+)
+
+// postgresApplicationName is set in the connection string of postgres
+// datastores built from a Secret, which SPIRE requires not to be empty.
+const postgresApplicationName = "application_name=spire-server"
+
+// Files the certificates for TLS connections to the database are mounted as
+const (
+	dataStoreRootCAPath     = "/run/spire/datastore/ca/ca.crt"
+	dataStoreClientCertPath = "/run/spire/datastore/client/tls.crt"
+	dataStoreClientKeyPath  = "/run/spire/datastore/client/tls.key"
+)
+
+// sqlDataStore models the DataStore plugin of the SPIRE server.
+func sqlDataStore(s *spirev1.SpireServer) spireconfig.Plugin {
+	data := spireconfig.Data{
+		"database_type":     s.Spec.DataStore,
+		"connection_string": connectionString(s),
+	}
+
+	if options := s.Spec.DataStoreOptions; options != nil {
+		// postgres reads its certificates from its own variables instead
+		if tls := options.TLS; tls != nil && strings.EqualFold(s.Spec.DataStore, "mysql") {
+			if tls.RootCASecretRef != nil {
+				data["root_ca_path"] = dataStoreRootCAPath
+			}
+			if tls.ClientCertSecretName != "" {
+				data["client_cert_path"] = dataStoreClientCertPath
+				data["client_key_path"] = dataStoreClientKeyPath
+			}
+		}
+
+		if options.MaxOpenConns != nil {
+			data["max_open_conns"] = *options.MaxOpenConns
+		}
+		if options.MaxIdleConns != nil {
+			data["max_idle_conns"] = *options.MaxIdleConns
+		}
+		if options.ConnMaxLifetime != nil {
+			data["conn_max_lifetime"] = options.ConnMaxLifetime.Duration.String()
+		}
+		if options.DisableMigration {
+			data["disable_migration"] = true
+		}
+
+		if options.ReadOnlyConnectionStringSecretRef != nil || expandsInto(options.ReadOnlyConnectionString) {
+			data["ro_connection_string"] = envReference(roConnectionEnv)
+		} else if options.ReadOnlyConnectionString != "" {
+			data["ro_connection_string"] = options.ReadOnlyConnectionString
+		}
+	}
+
+	return spireconfig.Plugin{Type: "DataStore", Name: "sql", Data: data}
+}
+
+// connectionString returns the connection_string of the SQL datastore, which
+// refers to the environment of the server container when the credentials are
+// read from a Secret. Postgres reads them from its own environment variables
+// instead, so that quotes and backslashes in them are kept as written.
+func connectionString(s *spirev1.SpireServer) string {
+	switch {
+	case s.Spec.ConnectionStringSecretRef != nil || expandsInto(s.Spec.ConnectionString):
+		return envReference(connectionStringEnv)
+	case dataStoreSecret(s) != nil:
+		if strings.EqualFold(s.Spec.DataStore, "mysql") {
+			return envReference(dataStoreUserEnv) + ":" + envReference(dataStorePassEnv) +
+				"@tcp(" + envReference(dataStoreHostEnv) + ")/" + envReference(dataStoreNameEnv) + "?parseTime=true"
+		}
+
+		return postgresApplicationName
+	default:
+		return s.Spec.ConnectionString
+	}
+}
+
+// expandsInto reports whether SPIRE would expand parts of value from the
+// environment. Such values are passed through the environment themselves, as
+// the expansion has no escape for $.
+func expandsInto(value string) bool {
+	return strings.Contains(value, "$")
+}
+
+// dataStoreSecret returns the Secret the connection string is built from, if
+// any. The operator generates it for managed datastores.
+func dataStoreSecret(s *spirev1.SpireServer) *spirev1.DataStoreSecretReference {
+	if s.Spec.ManagedDataStore != nil {
+		return &spirev1.DataStoreSecretReference{
+			Name:        managedDataStoreName(s.Name),
+			HostKey:     spirev1.DefaultDataStoreHostKey,
+			UserKey:     spirev1.DefaultDataStoreUserKey,
+			PasswordKey: spirev1.DefaultDataStorePasswordKey,
+			DatabaseKey: spirev1.DefaultDataStoreDatabaseKey,
+		}
+	}
+
+	return s.Spec.DataStoreSecretRef
+}
+
+// postgresTLSEnv returns the environment variables pointing postgres clients
+// to the mounted certificates.
+func postgresTLSEnv(options *spirev1.DataStoreOptions) []corev1.EnvVar {
+	if options == nil || options.TLS == nil {
+		return nil
+	}
+
+	var env []corev1.EnvVar
+	if options.TLS.RootCASecretRef != nil {
+		env = append(env,
+			corev1.EnvVar{Name: postgresSSLModeEnv, Value: "verify-full"},
+			corev1.EnvVar{Name: postgresSSLRootCertEnv, Value: dataStoreRootCAPath})
+	}
+	if options.TLS.ClientCertSecretName != "" {
+		env = append(env,
+			corev1.EnvVar{Name: postgresSSLCertEnv, Value: dataStoreClientCertPath},
+			corev1.EnvVar{Name: postgresSSLKeyEnv, Value: dataStoreClientKeyPath})
+	}
+
+	return env
+}
+
+// dataStoreEnv returns the environment variables the SPIRE server container
+// reads the datastore credentials from, if any.
+func dataStoreEnv(s *spirev1.SpireServer) []corev1.EnvVar {
+	var env []corev1.EnvVar
+
+	switch {
+	case s.Spec.ConnectionStringSecretRef != nil:
+		env = append(env, secretEnv(connectionStringEnv, s.Spec.ConnectionStringSecretRef.DeepCopy()))
+	case expandsInto(s.Spec.ConnectionString):
+		env = append(env, literalEnv(connectionStringEnv, s.Spec.ConnectionString))
+	case dataStoreSecret(s) != nil:
+		ref := dataStoreSecret(s)
+		names := []string{dataStoreHostEnv, dataStoreUserEnv, dataStorePassEnv, dataStoreNameEnv}
+		if !strings.EqualFold(s.Spec.DataStore, "mysql") {
+			names = []string{postgresHostEnv, postgresUserEnv, postgresPasswordEnv, postgresDatabaseEnv}
+		}
+		env = append(env,
+			secretEnv(names[0], secretKey(ref.Name, ref.HostKey)),
+			secretEnv(names[1], secretKey(ref.Name, ref.UserKey)),
+			secretEnv(names[2], secretKey(ref.Name, ref.PasswordKey)),
+			secretEnv(names[3], secretKey(ref.Name, ref.DatabaseKey)),
+		)
+	}
+
+	if strings.EqualFold(s.Spec.DataStore, "postgres") {
+		env = append(env, postgresTLSEnv(s.Spec.DataStoreOptions)...)
+	}
+
+	if options := s.Spec.DataStoreOptions; options != nil {
+		if options.ReadOnlyConnectionStringSecretRef != nil {
+			env = append(env, secretEnv(roConnectionEnv, options.ReadOnlyConnectionStringSecretRef.DeepCopy()))
+		} else if expandsInto(options.ReadOnlyConnectionString) {
+			env = append(env, literalEnv(roConnectionEnv, options.ReadOnlyConnectionString))
+		}
+	}
+
+	return env
+}
+
+// dataStoreVolumes returns the volumes holding the certificates the SPIRE
+// server connects to its database with, along with their mounts.
+func dataStoreVolumes(s *spirev1.SpireServer) ([]corev1.Volume, []corev1.VolumeMount) {
+	if s.Spec.DataStoreOptions == nil || s.Spec.DataStoreOptions.TLS == nil {
+		return nil, nil
+	}
+
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+	tls := s.Spec.DataStoreOptions.TLS
+
+	if ref := tls.RootCASecretRef; ref != nil {
+		volumes = append(volumes, corev1.Volume{
+			Name: "datastore-ca",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+				SecretName: ref.Name,
+				Items:      []corev1.KeyToPath{{Key: ref.Key, Path: path.Base(dataStoreRootCAPath)}},
+				Optional:   ref.Optional,
+			}},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name: "datastore-ca", MountPath: path.Dir(dataStoreRootCAPath), ReadOnly: true})
+	}
+
+	if tls.ClientCertSecretName != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name: "datastore-client",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+				SecretName: tls.ClientCertSecretName,
+			}},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name: "datastore-client", MountPath: path.Dir(dataStoreClientCertPath), ReadOnly: true})
+	}
+
+	return volumes, mounts
+}
+
+func secretEnv(name string, selector *corev1.SecretKeySelector) corev1.EnvVar {
+	return corev1.EnvVar{Name: name, ValueFrom: &corev1.EnvVarSource{SecretKeyRef: selector}}
+}
+
+// referencesEnv reports whether the configuration of the SPIRE server refers
+// to variables of env, which it does for all of them but the PG variables
+// postgres reads itself.
+func referencesEnv(env []corev1.EnvVar) bool {
+	for _, variable := range env {
+		if !strings.HasPrefix(variable.Name, "PG") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// literalEnv returns a variable holding value as written, escaping the $ that
+// Kubernetes would otherwise expand references to other variables from.
+func literalEnv(name string, value string) corev1.EnvVar {
+	return corev1.EnvVar{Name: name, Value: strings.ReplaceAll(value, "$", "$$")}
+}
+
+func secretKey(secretName string, key string) *corev1.SecretKeySelector {
+	return &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}, Key: key}
+}
+
+func envReference(name string) string {
+	return "${" + name + "}"
+}
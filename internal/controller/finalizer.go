@@ -0,0 +1,60 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+)
+
+// cleanupFinalizer holds SpireServer and SpireAgent resources until the
+// objects that cannot be garbage collected through owner references, such as
+// cluster-scoped RBAC, have been removed.
+const cleanupFinalizer = "spire.hpe.com/cleanup"
+
+// deleteComponents deletes each object, treating objects that are already
+// gone as deleted.
+func deleteComponents(ctx context.Context, c client.Client, components []component, logger logr.Logger) error {
+	for _, comp := range components {
+		if err := client.IgnoreNotFound(c.Delete(ctx, comp.object)); err != nil {
+			logger.Error(err, "Failed to delete", "Name", comp.name)
+			return fmt.Errorf("failed to delete %s: %w", comp.name, err)
+		}
+	}
+
+	return nil
+}
+
+// reportCleanupBlocked stores the cleanup failure in the status of obj, whose
+// conditions are passed in separately as they live in type-specific structs.
+func reportCleanupBlocked(ctx context.Context, c client.Client, obj client.Object, conditions *[]metav1.Condition,
+	cleanupErr error) error {
+	setCondition(conditions, obj.GetGeneration(), spirev1.ConditionCleanupBlocked, metav1.ConditionTrue,
+		spirev1.ReasonCleanupFailed, cleanupErr.Error())
+
+	if err := c.Status().Update(ctx, obj); err != nil {
+		return fmt.Errorf("failed to report blocked cleanup: %w, original error: %v", err, cleanupErr)
+	}
+
+	return cleanupErr
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+)
+
+func deletingSpireServer() *spirev1.SpireServer {
+	server := mockSpireServer.DeepCopy()
+	now := metav1.Now()
+	server.DeletionTimestamp = &now
+	server.Finalizers = []string{cleanupFinalizer}
+	return server
+}
+
+func TestServerFinalizerRemovesClusterScopedObjects(t *testing.T) {
+	ctx := context.Background()
+	server := deletingSpireServer()
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		server,
+		reconciler.spireClusterRoleDeployment(server, server.Namespace),
+		reconciler.spireClusterRoleBindingDeployment(server, server.Namespace),
+		reconciler.spireBundleDeployment(server, server.Namespace),
+	).Build()
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)})
+	assert.NoError(t, err)
+
+	err = c.Get(ctx, types.NamespacedName{Name: "valid-spire-server-trust-role-default"}, &rbacv1.ClusterRole{})
+	assert.True(t, apiErrors.IsNotFound(err))
+	err = c.Get(ctx, types.NamespacedName{Name: "valid-spire-server-trust-role-binding-default"}, &rbacv1.ClusterRoleBinding{})
+	assert.True(t, apiErrors.IsNotFound(err))
+	err = c.Get(ctx, types.NamespacedName{Name: "valid-spire-server-bundle", Namespace: server.Namespace}, &corev1.ConfigMap{})
+	assert.True(t, apiErrors.IsNotFound(err))
+	err = c.Get(ctx, client.ObjectKeyFromObject(server), &spirev1.SpireServer{})
+	assert.True(t, apiErrors.IsNotFound(err), "SpireServer should be released once cleanup succeeds")
+}
+
+func TestServerFinalizerReportsBlockedCleanup(t *testing.T) {
+	ctx := context.Background()
+	server := deletingSpireServer()
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, reconciler.spireClusterRoleDeployment(server, server.Namespace)).
+		WithStatusSubresource(server).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+				if _, ok := obj.(*rbacv1.ClusterRole); ok {
+					return apiErrors.NewForbidden(rbacv1.Resource("clusterroles"), obj.GetName(), errors.New("denied"))
+				}
+				return c.Delete(ctx, obj, opts...)
+			},
+		}).Build()
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)})
+	assert.Error(t, err)
+
+	blocked := &spirev1.SpireServer{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), blocked))
+	assert.Contains(t, blocked.Finalizers, cleanupFinalizer)
+	assert.True(t, meta.IsStatusConditionTrue(blocked.Status.Conditions, spirev1.ConditionCleanupBlocked))
+	assert.Equal(t, spirev1.ReasonCleanupFailed,
+		meta.FindStatusCondition(blocked.Status.Conditions, spirev1.ConditionCleanupBlocked).Reason)
+}
+
+func TestAgentFinalizerRemovesClusterScopedObjects(t *testing.T) {
+	ctx := context.Background()
+	agent := &spirev1.SpireAgent{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-agent", Namespace: "default"},
+	}
+	now := metav1.Now()
+	agent.DeletionTimestamp = &now
+	agent.Finalizers = []string{cleanupFinalizer}
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		agent,
+		agentReconciler.agentClusterRoleDeployment(agent, agent.Namespace),
+		agentReconciler.agentClusterRoleBindingDeployment(agent, agent.Namespace),
+	).Build()
+	r := &SpireAgentReconciler{Client: c, Scheme: testScheme}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(agent)})
+	assert.NoError(t, err)
+
+	err = c.Get(ctx, types.NamespacedName{Name: "spire-agent-cluster-role-default"}, &rbacv1.ClusterRole{})
+	assert.True(t, apiErrors.IsNotFound(err))
+	err = c.Get(ctx, types.NamespacedName{Name: "spire-agent-cluster-role-binding-default"}, &rbacv1.ClusterRoleBinding{})
+	assert.True(t, apiErrors.IsNotFound(err))
+	err = c.Get(ctx, client.ObjectKeyFromObject(agent), &spirev1.SpireAgent{})
+	assert.True(t, apiErrors.IsNotFound(err), "SpireAgent should be released once cleanup succeeds")
+}
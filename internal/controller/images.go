@@ -0,0 +1,89 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+// Images deployed when neither the SpireServer or SpireAgent nor the
+// operator configuration set their own
+const (
+	DefaultServerImage  = "ghcr.io/spiffe/spire-server"
+	DefaultAgentImage   = "ghcr.io/spiffe/spire-agent"
+	DefaultVersion      = "1.5.1"
+	DefaultInitImage    = "cgr.dev/chainguard/wait-for-it"
+	DefaultSQLiteImage  = "keinos/sqlite3:3.42.0"
+	DefaultKubectlImage = "bitnami/kubectl:1.27"
+)
+
+// Images holds the images the operator deploys for resources that do not set
+// their own, so that air-gapped clusters can use an internal registry.
+type Images struct {
+	// ServerImage is the repository of the SPIRE server image
+	ServerImage string
+
+	// AgentImage is the repository of the SPIRE agent image
+	AgentImage string
+
+	// Version of SPIRE, used as the tag of the server and agent images
+	Version string
+
+	// InitImage is the image, including its tag, of the container holding
+	// SPIRE agents back until their server accepts connections
+	InitImage string
+
+	// SQLiteImage is the image, including its tag, sqlite3 datastores are
+	// backed up and restored with
+	SQLiteImage string
+
+	// KubectlImage is the image, including its tag, storing backups in
+	// Secrets
+	KubectlImage string
+}
+
+func (i Images) serverImage(repository string, version string) string {
+	return firstNonEmpty(repository, i.ServerImage, DefaultServerImage) + ":" + i.version(version)
+}
+
+func (i Images) agentImage(repository string, version string) string {
+	return firstNonEmpty(repository, i.AgentImage, DefaultAgentImage) + ":" + i.version(version)
+}
+
+// version returns the version of SPIRE deployed for a resource requesting
+// version, which falls back to the operator defaults when empty.
+func (i Images) version(version string) string {
+	return firstNonEmpty(version, i.Version, DefaultVersion)
+}
+
+func (i Images) initImage() string {
+	return firstNonEmpty(i.InitImage, DefaultInitImage)
+}
+
+func (i Images) sqliteImage() string {
+	return firstNonEmpty(i.SQLiteImage, DefaultSQLiteImage)
+}
+
+func (i Images) kubectlImage() string {
+	return firstNonEmpty(i.KubectlImage, DefaultKubectlImage)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+	"github.com/glcp/spire-k8s-operator/internal/spireconfig"
+)
+
+const (
+	// keyManagerEnvPrefix starts the environment variables of the SPIRE
+	// server container holding the settings of its KeyManager plugin, which
+	// SPIRE expands in server.conf like the datastore credentials
+	keyManagerEnvPrefix = "SPIRE_KEYMANAGER_"
+
+	// agentDataDir is where the volume of the SPIRE agent keeping its keys on
+	// disk is mounted
+	agentDataDir = "/run/spire/data"
+)
+
+// serverKeyManager models the KeyManager plugin of the SPIRE server. Memory
+// keys take no settings at all, SPIRE rejects the plugin_data of the disk
+// plugin there.
+func serverKeyManager(s *spirev1.SpireServer) spireconfig.Plugin {
+	keyManager := s.Spec.KeyManager
+	if keyManager == nil {
+		// the spec has not been through the defaulting webhook
+		defaulted := s.DeepCopy()
+		defaulted.Default()
+		keyManager = defaulted.Spec.KeyManager
+	}
+
+	switch {
+	case keyManager.Disk != nil:
+		return spireconfig.Plugin{
+			Type: "KeyManager",
+			Name: "disk",
+			Data: spireconfig.Data{"keys_path": s.KeysPath()},
+		}
+	case keyManager.Plugin != nil:
+		plugin := keyManager.Plugin
+		// the plugins keep track of the keys they created in the service
+		data := spireconfig.Data{"key_metadata_file": path.Join(spirev1.DataDir, plugin.Name+"-key-metadata.json")}
+		for _, key := range plugin.ConfigSecretRef.Keys {
+			data[key] = envReference(keyManagerEnv(key))
+		}
+		return spireconfig.Plugin{Type: "KeyManager", Name: plugin.Name, Data: data}
+	default:
+		return spireconfig.Plugin{Type: "KeyManager", Name: "memory"}
+	}
+}
+
+// keyManagerEnvVars returns the environment variables of the SPIRE server
+// container holding the settings of its KeyManager plugin.
+func keyManagerEnvVars(s *spirev1.SpireServer) []corev1.EnvVar {
+	if s.Spec.KeyManager == nil || s.Spec.KeyManager.Plugin == nil {
+		return nil
+	}
+
+	ref := s.Spec.KeyManager.Plugin.ConfigSecretRef
+	env := make([]corev1.EnvVar, 0, len(ref.Keys))
+	for _, key := range ref.Keys {
+		env = append(env, secretEnv(keyManagerEnv(key), secretKey(ref.Name, key)))
+	}
+
+	return env
+}
+
+func keyManagerEnv(key string) string {
+	return keyManagerEnvPrefix + strings.ToUpper(key)
+}
+
+// agentKeyManager models the KeyManager plugin of the SPIRE agent.
+func agentKeyManager(a *spirev1.SpireAgent) spireconfig.Plugin {
+	if disk := agentDiskKeyManager(a); disk != nil {
+		return spireconfig.Plugin{
+			Type: "KeyManager",
+			Name: "disk",
+			Data: spireconfig.Data{"directory": path.Join(agentDataDir, disk.Directory)},
+		}
+	}
+
+	return spireconfig.Plugin{Type: "KeyManager", Name: "memory"}
+}
+
+// agentDiskKeyManager returns the settings of the disk KeyManager of the SPIRE
+// agent, or nil when it keeps its keys in memory.
+func agentDiskKeyManager(a *spirev1.SpireAgent) *spirev1.AgentDiskKeyManager {
+	keyManager := a.Spec.KeyManager
+	if keyManager == nil {
+		// the spec has not been through the defaulting webhook
+		defaulted := a.DeepCopy()
+		defaulted.Default()
+		keyManager = defaulted.Spec.KeyManager
+	}
+
+	return keyManager.Disk
+}
+
+// agentDataVolume returns the volume the SPIRE agent keeps its keys in, on
+// the node it runs on so that they outlive the agent pod, along with its
+// mount. Agents keeping their keys in memory have none.
+func agentDataVolume(a *spirev1.SpireAgent) ([]corev1.Volume, []corev1.VolumeMount) {
+	if agentDiskKeyManager(a) == nil {
+		return nil, nil
+	}
+
+	hostPathType := corev1.HostPathDirectoryOrCreate
+	volume := corev1.Volume{
+		Name: "spire-agent-data",
+		VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{
+			Path: agentDataHostPath(a.Namespace, a.Name),
+			Type: &hostPathType,
+		}},
+	}
+	mount := corev1.VolumeMount{Name: "spire-agent-data", MountPath: agentDataDir}
+
+	return []corev1.Volume{volume}, []corev1.VolumeMount{mount}
+}
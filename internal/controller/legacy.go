@@ -0,0 +1,198 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// legacyCleanupAnnotation is set on a SpireServer or SpireAgent once the
+// objects earlier versions of the operator generated for it under other names
+// have been removed, so that they are only looked for once.
+const legacyCleanupAnnotation = "spire.hpe.com/legacy-names-removed"
+
+// legacyServerComponents returns the objects earlier versions of the operator
+// generated for the SPIRE server under names it no longer uses: the fixed
+// names shared by every server, then the names of the first releases that
+// named objects after the server.
+func legacyServerComponents(s client.Object) []component {
+	namespace := s.GetNamespace()
+
+	legacy := []component{
+		{"legacyStatefulSet", namedObject(&appsv1.StatefulSet{}, "spire-server", namespace)},
+		{"legacyService", namedObject(&corev1.Service{}, "spire-service", namespace)},
+		{"legacyServerConfigMap", namedObject(&corev1.ConfigMap{}, "spire-config-map", namespace)},
+		{"legacyServerConfigMap", namedObject(&corev1.ConfigMap{}, s.GetName()+"-config", namespace)},
+		{"legacyBundle", namedObject(&corev1.ConfigMap{}, "spire-bundle", namespace)},
+		{"legacyServiceAccount", namedObject(&corev1.ServiceAccount{}, "spire-server", namespace)},
+		{"legacyServiceAccount", namedObject(&corev1.ServiceAccount{}, s.GetName(), namespace)},
+		{"legacyRoleBinding", namedObject(&rbacv1.RoleBinding{}, "spire-server-configmap-role-binding", namespace)},
+		{"legacyRole", namedObject(&rbacv1.Role{}, "spire-server-configmap-role", namespace)},
+		{"legacyClusterRoleBinding", namedObject(&rbacv1.ClusterRoleBinding{}, "spire-server-trust-role-binding", "")},
+		{"legacyClusterRole", namedObject(&rbacv1.ClusterRole{}, "spire-server-trust-role", "")},
+	}
+
+	current := []client.Object{
+		namedObject(&appsv1.StatefulSet{}, s.GetName(), namespace),
+		namedObject(&appsv1.StatefulSet{}, managedDataStoreName(s.GetName()), namespace),
+		namedObject(&corev1.Service{}, s.GetName(), namespace),
+		namedObject(&corev1.Service{}, managedDataStoreName(s.GetName()), namespace),
+		namedObject(&corev1.ConfigMap{}, serverConfigMapName(s.GetName()), namespace),
+		namedObject(&corev1.ConfigMap{}, serverBundleName(s.GetName()), namespace),
+		namedObject(&corev1.ServiceAccount{}, serverServiceAccountName(s.GetName()), namespace),
+		namedObject(&rbacv1.RoleBinding{}, serverRoleName(s.GetName())+"-binding", namespace),
+		namedObject(&rbacv1.Role{}, serverRoleName(s.GetName()), namespace),
+	}
+
+	return withoutCurrentNames(legacy, current)
+}
+
+// legacyAgentComponents returns the objects earlier versions of the operator
+// generated for the SPIRE agent under names it no longer uses.
+func legacyAgentComponents(a client.Object) []component {
+	namespace := a.GetNamespace()
+
+	legacy := []component{
+		{"legacyDaemonSet", namedObject(&appsv1.DaemonSet{}, "spire-agent", namespace)},
+		{"legacyAgentConfigMap", namedObject(&corev1.ConfigMap{}, "spire-agent", namespace)},
+		{"legacyAgentConfigMap", namedObject(&corev1.ConfigMap{}, a.GetName()+"-config", namespace)},
+		{"legacyBundle", namedObject(&corev1.ConfigMap{}, "spire-agent-bundle", namespace)},
+		{"legacyBundle", namedObject(&corev1.ConfigMap{}, a.GetName()+"-bundle", namespace)},
+		{"legacyServiceAccount", namedObject(&corev1.ServiceAccount{}, "spire-agent", namespace)},
+		{"legacyServiceAccount", namedObject(&corev1.ServiceAccount{}, a.GetName(), namespace)},
+		{"legacyClusterRoleBinding", namedObject(&rbacv1.ClusterRoleBinding{}, "spire-agent-cluster-role-binding", "")},
+		{"legacyClusterRole", namedObject(&rbacv1.ClusterRole{}, "spire-agent-cluster-role", "")},
+	}
+
+	current := []client.Object{
+		namedObject(&appsv1.DaemonSet{}, a.GetName(), namespace),
+		namedObject(&corev1.ConfigMap{}, agentConfigMapName(a.GetName()), namespace),
+		namedObject(&corev1.ConfigMap{}, agentBundleCopyName(a.GetName()), namespace),
+		namedObject(&corev1.ServiceAccount{}, agentServiceAccountName(a.GetName()), namespace),
+	}
+
+	return withoutCurrentNames(legacy, current)
+}
+
+func namedObject(obj client.Object, name string, namespace string) client.Object {
+	obj.SetName(name)
+	obj.SetNamespace(namespace)
+	return obj
+}
+
+// withoutCurrentNames drops the legacy objects that have the kind and name of
+// an object the operator still generates, as resources may be named so that
+// a legacy name is also a current one.
+func withoutCurrentNames(legacy []component, current []client.Object) []component {
+	var kept []component
+	for _, comp := range legacy {
+		inUse := false
+		for _, obj := range current {
+			if reflect.TypeOf(obj) == reflect.TypeOf(comp.object) && obj.GetName() == comp.object.GetName() {
+				inUse = true
+			}
+		}
+
+		if !inUse {
+			kept = append(kept, comp)
+		}
+	}
+
+	return kept
+}
+
+// removeLegacyComponents deletes the legacy objects belonging to owner, then
+// records on owner that they are gone. Namespaced objects belong to owner when
+// it controls them. The legacy cluster-scoped RBAC carries no owner, the
+// bindings belong to owner when they bind a ServiceAccount of its namespace,
+// and the roles once no legacy binding left in place refers to them. The
+// objects are read with reader, as the cache only holds the ConfigMaps that
+// carry the labels earlier versions did not set.
+func removeLegacyComponents(ctx context.Context, c client.Client, reader client.Reader, owner client.Object,
+	legacy []component, logger logr.Logger) error {
+	if owner.GetAnnotations()[legacyCleanupAnnotation] != "" {
+		return nil
+	}
+
+	if reader == nil {
+		reader = c
+	}
+
+	boundRoles := map[string]bool{}
+	for _, comp := range legacy {
+		live := comp.object.DeepCopyObject().(client.Object)
+		if err := reader.Get(ctx, client.ObjectKeyFromObject(live), live); err != nil {
+			if apiErrors.IsNotFound(err) {
+				continue
+			}
+
+			logger.Error(err, "Failed to get", "Name", comp.name)
+			return fmt.Errorf("failed to get %s: %w", comp.name, err)
+		}
+
+		switch obj := live.(type) {
+		case *rbacv1.ClusterRoleBinding:
+			if !bindsNamespace(obj, owner.GetNamespace()) {
+				boundRoles[obj.RoleRef.Name] = true
+				continue
+			}
+		case *rbacv1.ClusterRole:
+			if boundRoles[obj.Name] {
+				continue
+			}
+		default:
+			if !metav1.IsControlledBy(live, owner) {
+				continue
+			}
+		}
+
+		if err := deleteComponents(ctx, c, []component{{comp.name, live}}, logger); err != nil {
+			return err
+		}
+		logger.Info("Deleted object under legacy name", "Name", comp.name, "Object", live.GetName())
+	}
+
+	patch := client.MergeFrom(owner.DeepCopyObject().(client.Object))
+	annotations := owner.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[legacyCleanupAnnotation] = "true"
+	owner.SetAnnotations(annotations)
+
+	return c.Patch(ctx, owner, patch)
+}
+
+func bindsNamespace(binding *rbacv1.ClusterRoleBinding, namespace string) bool {
+	for _, subject := range binding.Subjects {
+		if subject.Kind == rbacv1.ServiceAccountKind && subject.Namespace == namespace {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+)
+
+func legacyObjectOf(t *testing.T, owner *spirev1.SpireServer, obj client.Object, name string) client.Object {
+	namedObject(obj, name, owner.Namespace)
+	assert.NoError(t, controllerutil.SetControllerReference(owner, obj, testScheme))
+	return obj
+}
+
+func legacyClusterRoleBinding(namespace string) *rbacv1.ClusterRoleBinding {
+	return &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-server-trust-role-binding"},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "spire-server", Namespace: namespace}},
+		RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "spire-server-trust-role"},
+	}
+}
+
+func TestRemoveLegacyServerComponents(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.UID = "server-uid"
+	unowned := namedObject(&corev1.ServiceAccount{}, "spire-server", server.Namespace)
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		server,
+		legacyObjectOf(t, server, &appsv1.StatefulSet{}, "spire-server"),
+		legacyObjectOf(t, server, &corev1.ConfigMap{}, "spire-config-map"),
+		legacyObjectOf(t, server, &corev1.ConfigMap{}, server.Name+"-config"),
+		legacyObjectOf(t, server, &corev1.ServiceAccount{}, server.Name),
+		unowned,
+		legacyClusterRoleBinding(server.Namespace),
+		namedObject(&rbacv1.ClusterRole{}, "spire-server-trust-role", ""),
+	).Build()
+
+	assert.NoError(t, removeLegacyComponents(ctx, c, nil, server, legacyServerComponents(server), logr.Discard()))
+
+	for _, obj := range []client.Object{
+		namedObject(&appsv1.StatefulSet{}, "spire-server", "default"),
+		namedObject(&corev1.ConfigMap{}, "spire-config-map", "default"),
+		namedObject(&corev1.ConfigMap{}, "valid-spire-server-config", "default"),
+		namedObject(&corev1.ServiceAccount{}, "valid-spire-server", "default"),
+		namedObject(&rbacv1.ClusterRoleBinding{}, "spire-server-trust-role-binding", ""),
+		namedObject(&rbacv1.ClusterRole{}, "spire-server-trust-role", ""),
+	} {
+		err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		assert.True(t, apiErrors.IsNotFound(err), "legacy %T %s should be deleted", obj, obj.GetName())
+	}
+
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(unowned), unowned),
+		"objects the server does not control should be left alone")
+
+	reconciled := &spirev1.SpireServer{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), reconciled))
+	assert.Equal(t, "true", reconciled.Annotations[legacyCleanupAnnotation])
+}
+
+func TestRemoveLegacyComponentsKeepsOtherNamespaceRBAC(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		server,
+		legacyClusterRoleBinding("spire"),
+		namedObject(&rbacv1.ClusterRole{}, "spire-server-trust-role", ""),
+	).Build()
+
+	assert.NoError(t, removeLegacyComponents(ctx, c, nil, server, legacyServerComponents(server), logr.Discard()))
+
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: "spire-server-trust-role-binding"}, &rbacv1.ClusterRoleBinding{}))
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: "spire-server-trust-role"}, &rbacv1.ClusterRole{}))
+}
+
+func TestLegacyComponentsSkipCurrentNames(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+	server.Name = "spire"
+
+	for _, comp := range legacyServerComponents(server) {
+		_, isServiceAccount := comp.object.(*corev1.ServiceAccount)
+		assert.False(t, isServiceAccount && comp.object.GetName() == "spire-server",
+			"the ServiceAccount of a server named spire is not a legacy object")
+	}
+
+	agent := spireAgentFor(server, "default")
+	for _, comp := range legacyAgentComponents(agent) {
+		_, isDaemonSet := comp.object.(*appsv1.DaemonSet)
+		assert.False(t, isDaemonSet, "the DaemonSet of an agent named spire-agent is not a legacy object")
+	}
+}
+
+func TestRemoveLegacyComponentsRunsOnce(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.UID = "server-uid"
+	server.Annotations = map[string]string{legacyCleanupAnnotation: "true"}
+	statefulSet := legacyObjectOf(t, server, &appsv1.StatefulSet{}, "spire-server")
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(server, statefulSet).Build()
+
+	assert.NoError(t, removeLegacyComponents(ctx, c, nil, server, legacyServerComponents(server), logr.Discard()))
+
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(statefulSet), statefulSet))
+}
+
+func TestRemoveLegacyComponentsReadsWithReader(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.UID = "server-uid"
+	configMap := legacyObjectOf(t, server, &corev1.ConfigMap{}, "spire-config-map")
+	// the cache does not hold the unlabelled ConfigMaps of earlier versions
+	cached := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(server).Build()
+	apiServer := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(configMap).Build()
+	c := interceptor.NewClient(cached, interceptor.Funcs{
+		Delete: func(ctx context.Context, _ client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			return apiServer.Delete(ctx, obj, opts...)
+		},
+	})
+
+	assert.NoError(t, removeLegacyComponents(ctx, c, apiServer, server, legacyServerComponents(server), logr.Discard()))
+
+	err := apiServer.Get(ctx, client.ObjectKeyFromObject(configMap), &corev1.ConfigMap{})
+	assert.True(t, apiErrors.IsNotFound(err))
+}
@@ -0,0 +1,274 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+)
+
+// managedDataStoreUser is the user and database the SPIRE server connects to
+// in the database deployed by the operator
+const managedDataStoreUser = "spire"
+
+// dataStoreEngine describes how a database image is run by the operator
+type dataStoreEngine struct {
+	port int32
+
+	// dataDir is where the image keeps its data
+	dataDir string
+
+	// env maps the keys of the datastore Secret to the variables the image
+	// reads its user, password and database from
+	env map[string]string
+
+	// extraEnv holds image settings that do not come from the Secret
+	extraEnv []corev1.EnvVar
+
+	readinessCommand []string
+}
+
+var dataStoreEngines = map[string]dataStoreEngine{
+	"postgres": {
+		port:    5432,
+		dataDir: "/var/lib/postgresql/data",
+		env: map[string]string{
+			spirev1.DefaultDataStoreUserKey:     "POSTGRES_USER",
+			spirev1.DefaultDataStorePasswordKey: "POSTGRES_PASSWORD",
+			spirev1.DefaultDataStoreDatabaseKey: "POSTGRES_DB",
+		},
+		// the root of a volume may hold lost+found, which initdb refuses
+		extraEnv:         []corev1.EnvVar{{Name: "PGDATA", Value: "/var/lib/postgresql/data/pgdata"}},
+		readinessCommand: []string{"pg_isready", "-h", "127.0.0.1", "-U", managedDataStoreUser, "-d", managedDataStoreUser},
+	},
+	"mysql": {
+		port:    3306,
+		dataDir: "/var/lib/mysql",
+		env: map[string]string{
+			spirev1.DefaultDataStoreUserKey:     "MYSQL_USER",
+			spirev1.DefaultDataStorePasswordKey: "MYSQL_PASSWORD",
+			spirev1.DefaultDataStoreDatabaseKey: "MYSQL_DATABASE",
+		},
+		extraEnv:         []corev1.EnvVar{{Name: "MYSQL_RANDOM_ROOT_PASSWORD", Value: "yes"}},
+		readinessCommand: []string{"mysqladmin", "ping", "-h", "127.0.0.1"},
+	},
+}
+
+// managedDataStoreAddress returns the host and port of the database deployed
+// for the SPIRE server.
+func managedDataStoreAddress(s *spirev1.SpireServer, namespace string) string {
+	engine := dataStoreEngines[s.Spec.ManagedDataStore.Engine]
+	return managedDataStoreName(s.Name) + "." + namespace + ".svc:" + strconv.Itoa(int(engine.port))
+}
+
+// managedDataStoreSecret returns the Secret holding the credentials of the
+// database deployed for the SPIRE server. The password is generated anew on
+// every call, but only the first one is stored: the Secret of an existing
+// database keeps its data.
+func (r *SpireServerReconciler) managedDataStoreSecret(s *spirev1.SpireServer,
+	namespace string) (*corev1.Secret, error) {
+	password := make([]byte, 24)
+	if _, err := rand.Read(password); err != nil {
+		return nil, fmt.Errorf("failed to generate the datastore password: %w", err)
+	}
+
+	// postgres connects through the host alone and takes the default port
+	host := managedDataStoreName(s.Name) + "." + namespace + ".svc"
+	if s.Spec.ManagedDataStore.Engine == "mysql" {
+		host = managedDataStoreAddress(s, namespace)
+	}
+
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      managedDataStoreName(s.Name),
+			Namespace: namespace,
+			Labels:    componentLabels(dataStoreApp, s.Name),
+		},
+		Data: map[string][]byte{
+			spirev1.DefaultDataStoreHostKey:     []byte(host),
+			spirev1.DefaultDataStoreUserKey:     []byte(managedDataStoreUser),
+			spirev1.DefaultDataStorePasswordKey: []byte(hex.EncodeToString(password)),
+			spirev1.DefaultDataStoreDatabaseKey: []byte(managedDataStoreUser),
+		},
+	}
+
+	return secret, nil
+}
+
+func (r *SpireServerReconciler) managedDataStoreService(s *spirev1.SpireServer, namespace string) *corev1.Service {
+	engine := dataStoreEngines[s.Spec.ManagedDataStore.Engine]
+
+	service := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      managedDataStoreName(s.Name),
+			Namespace: namespace,
+			Labels:    componentLabels(dataStoreApp, s.Name),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: selectorLabels(dataStoreApp, s.Name),
+			Ports: []corev1.ServicePort{{
+				Name:       s.Spec.ManagedDataStore.Engine,
+				Port:       engine.port,
+				TargetPort: intstr.FromInt(int(engine.port)),
+				Protocol:   corev1.ProtocolTCP,
+			}},
+		},
+	}
+
+	return service
+}
+
+func (r *SpireServerReconciler) managedDataStoreStatefulSet(s *spirev1.SpireServer,
+	namespace string) *appsv1.StatefulSet {
+	managed := s.Spec.ManagedDataStore
+	engine := dataStoreEngines[managed.Engine]
+	name := managedDataStoreName(s.Name)
+	replicas := int32(1)
+
+	var env []corev1.EnvVar
+	for _, key := range []string{spirev1.DefaultDataStoreUserKey, spirev1.DefaultDataStorePasswordKey,
+		spirev1.DefaultDataStoreDatabaseKey} {
+		env = append(env, secretEnv(engine.env[key], secretKey(name, key)))
+	}
+	env = append(env, engine.extraEnv...)
+
+	container := corev1.Container{
+		Name:            managed.Engine,
+		Image:           managed.Image,
+		ImagePullPolicy: s.Spec.ImagePullPolicy,
+		Env:             env,
+		Ports:           []corev1.ContainerPort{{Name: managed.Engine, ContainerPort: engine.port}},
+		VolumeMounts:    []corev1.VolumeMount{{Name: "data", MountPath: engine.dataDir}},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler:        corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: engine.readinessCommand}},
+			InitialDelaySeconds: 5,
+			PeriodSeconds:       10,
+			TimeoutSeconds:      5,
+		},
+	}
+
+	statefulSet := &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "StatefulSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    componentLabels(dataStoreApp, s.Name),
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: name,
+			Selector:    &metav1.LabelSelector{MatchLabels: selectorLabels(dataStoreApp, s.Name)},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: componentLabels(dataStoreApp, s.Name),
+				},
+				Spec: corev1.PodSpec{
+					ImagePullSecrets: s.Spec.ImagePullSecrets,
+					Containers:       []corev1.Container{container},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{Name: "data"},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: *managed.StorageSize},
+					},
+				},
+			}},
+		},
+	}
+
+	return statefulSet
+}
+
+// removeManagedDataStore deletes the database deployed for the SPIRE server
+// once managedDataStore is removed from its spec. The claims of the database
+// are not owned by its StatefulSet, so its data is kept. Objects of the same
+// names the server does not control are left alone.
+func (r *SpireServerReconciler) removeManagedDataStore(ctx context.Context, s *spirev1.SpireServer,
+	logger logr.Logger) error {
+	name := managedDataStoreName(s.Name)
+	components := []component{
+		{"dataStore", namedObject(&appsv1.StatefulSet{}, name, s.Namespace)},
+		{"dataStoreService", namedObject(&corev1.Service{}, name, s.Namespace)},
+		{"dataStoreSecret", namedObject(&corev1.Secret{}, name, s.Namespace)},
+	}
+
+	for _, comp := range components {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(comp.object), comp.object); err != nil {
+			if apiErrors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("failed to get %s: %w", comp.name, err)
+		}
+
+		if !metav1.IsControlledBy(comp.object, s) {
+			continue
+		}
+
+		if err := deleteComponents(ctx, r.Client, []component{comp}, logger); err != nil {
+			return err
+		}
+		logger.Info("Deleted managed datastore", "Name", comp.name, "Object", name)
+	}
+
+	return nil
+}
+
+// setDataStoreCondition reports whether the database deployed for the SPIRE
+// server is ready, or drops the condition when the server has none.
+func setDataStoreCondition(s *spirev1.SpireServer, dataStore *appsv1.StatefulSet) {
+	if dataStore == nil {
+		meta.RemoveStatusCondition(&s.Status.Conditions, spirev1.ConditionDataStoreReady)
+		return
+	}
+
+	if dataStore.Status.ReadyReplicas > 0 {
+		setCondition(&s.Status.Conditions, s.Generation, spirev1.ConditionDataStoreReady, metav1.ConditionTrue,
+			spirev1.ReasonDataStoreReady, "the managed datastore accepts connections")
+		return
+	}
+
+	setCondition(&s.Status.Conditions, s.Generation, spirev1.ConditionDataStoreReady, metav1.ConditionFalse,
+		spirev1.ReasonDataStoreNotReady, fmt.Sprintf("waiting for the managed datastore %s to be ready", dataStore.Name))
+}
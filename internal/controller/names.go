@@ -0,0 +1,151 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+// The objects generated for a SpireServer or SpireAgent are named after the
+// resource, so that several of them can live side by side. Objects of the same
+// kind generated for both carry a suffix telling them apart, as a server and an
+// agent may share a name. Cluster-scoped objects also carry the namespace of
+// the resource, as resources with the same name may exist in different
+// namespaces.
+
+const (
+	nameLabel      = "app.kubernetes.io/name"
+	instanceLabel  = "app.kubernetes.io/instance"
+	managedByLabel = "app.kubernetes.io/managed-by"
+
+	// managedBy is the value of the managed-by label of generated objects
+	managedBy = "spire-k8s-operator"
+
+	// serverApp and agentApp are the values of the name label of the objects
+	// generated for SpireServers and SpireAgents respectively
+	serverApp = "spire-server"
+	agentApp  = "spire-agent"
+
+	// dataStoreApp is the value of the name label of the database deployed
+	// for a SpireServer with a managed datastore
+	dataStoreApp = "spire-datastore"
+
+	// backupApp is the value of the name label of the Jobs taking backups
+	// for a SpireServerBackup and of the Secrets they are stored in, and
+	// restoreApp the one of the Jobs run for a SpireServerRestore
+	backupApp  = "spire-backup"
+	restoreApp = "spire-restore"
+)
+
+// selectorLabels returns the labels selecting the pods of the SpireServer or
+// SpireAgent named instance.
+func selectorLabels(app string, instance string) map[string]string {
+	return map[string]string{
+		nameLabel:     app,
+		instanceLabel: instance,
+	}
+}
+
+// componentLabels returns the labels set on every object generated for the
+// SpireServer or SpireAgent named instance.
+func componentLabels(app string, instance string) map[string]string {
+	labels := selectorLabels(app, instance)
+	labels[managedByLabel] = managedBy
+
+	return labels
+}
+
+// clusterScopedName returns the name of a cluster-scoped object generated for
+// a resource in namespace.
+func clusterScopedName(name string, namespace string) string {
+	return name + "-" + namespace
+}
+
+func serverConfigMapName(serverName string) string {
+	return serverName + "-server-config"
+}
+
+func serverServiceAccountName(serverName string) string {
+	return serverName + "-server"
+}
+
+// serverBundleName returns the name of the ConfigMap the SPIRE server
+// publishes its trust bundle in.
+func serverBundleName(serverName string) string {
+	return serverName + "-bundle"
+}
+
+func serverRoleName(serverName string) string {
+	return serverName + "-configmap-role"
+}
+
+func serverClusterRoleName(serverName string, namespace string) string {
+	return clusterScopedName(serverName+"-trust-role", namespace)
+}
+
+func serverClusterRoleBindingName(serverName string, namespace string) string {
+	return clusterScopedName(serverName+"-trust-role-binding", namespace)
+}
+
+// managedDataStoreName returns the name of the StatefulSet, Service and Secret
+// of the database deployed for the SPIRE server.
+func managedDataStoreName(serverName string) string {
+	return serverName + "-datastore"
+}
+
+// serverDataClaimPrefix returns the prefix of the names of the
+// PersistentVolumeClaims of the SPIRE server pods, which the StatefulSet
+// completes with the ordinal of each pod.
+func serverDataClaimPrefix(serverName string) string {
+	return "spire-data-" + serverName + "-"
+}
+
+// serverDataClaimName returns the name of the PersistentVolumeClaim of the
+// first pod of the SPIRE server, which holds its sqlite3 database and keys.
+func serverDataClaimName(serverName string) string {
+	return serverDataClaimPrefix(serverName) + "0"
+}
+
+// backupUploaderName returns the name of the ServiceAccount, Role and
+// RoleBinding the Jobs storing backups in Secrets run with.
+func backupUploaderName(backupName string) string {
+	return backupName + "-uploader"
+}
+
+func agentConfigMapName(agentName string) string {
+	return agentName + "-agent-config"
+}
+
+func agentServiceAccountName(agentName string) string {
+	return agentName + "-agent"
+}
+
+// agentBundleCopyName returns the name of the copy of the trust bundle of a
+// SPIRE server in another namespace than the agent.
+func agentBundleCopyName(agentName string) string {
+	return agentName + "-agent-bundle"
+}
+
+func agentClusterRoleName(agentName string, namespace string) string {
+	return clusterScopedName(agentName+"-cluster-role", namespace)
+}
+
+func agentClusterRoleBindingName(agentName string, namespace string) string {
+	return clusterScopedName(agentName+"-cluster-role-binding", namespace)
+}
+
+// agentDataHostPath is the directory of the nodes the SPIRE agent keeps its
+// keys in when they are stored on disk.
+func agentDataHostPath(namespace string, agentName string) string {
+	return "/var/lib/spire-agent/" + namespace + "/" + agentName
+}
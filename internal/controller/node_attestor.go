@@ -0,0 +1,305 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+	"github.com/glcp/spire-k8s-operator/internal/spireconfig"
+)
+
+// Files the certificates of the x509pop and tpm_devid node attestors are
+// mounted as, in the server and agent pods
+const (
+	x509popCABundlePath     = "/run/spire/nodeattestor/x509pop/ca.crt"
+	x509popCertificatePath  = "/run/spire/nodeattestor/x509pop/tls.crt"
+	x509popPrivateKeyPath   = "/run/spire/nodeattestor/x509pop/tls.key"
+	tpmDevIDCAPath          = "/run/spire/nodeattestor/tpm_devid/devid-ca.crt"
+	tpmEndorsementCAPath    = "/run/spire/nodeattestor/tpm_devid/endorsement-ca.crt"
+	tpmDevIDCertificatePath = "/run/spire/nodeattestor/tpm_devid/tls.crt"
+	tpmDevIDPrivateKeyPath  = "/run/spire/nodeattestor/tpm_devid/tls.key"
+
+	// nodeAttestorEnvPrefix starts the environment variables of the SPIRE
+	// server container holding the cloud credentials of its node attestors
+	nodeAttestorEnvPrefix = "SPIRE_NODEATTESTOR_"
+)
+
+func x509popNodeAttestor() spireconfig.Plugin {
+	return spireconfig.Plugin{
+		Type: "NodeAttestor",
+		Name: "x509pop",
+		Data: spireconfig.Data{"ca_bundle_path": x509popCABundlePath},
+	}
+}
+
+func tpmDevIDNodeAttestor() spireconfig.Plugin {
+	return spireconfig.Plugin{
+		Type: "NodeAttestor",
+		Name: "tpm_devid",
+		Data: spireconfig.Data{
+			"devid_ca_path":       tpmDevIDCAPath,
+			"endorsement_ca_path": tpmEndorsementCAPath,
+		},
+	}
+}
+
+func awsIIDNodeAttestor(settings *spirev1.AWSIIDNodeAttestor) spireconfig.Plugin {
+	data := spireconfig.Data{}
+	if settings != nil {
+		if settings.CredentialsSecretName != "" {
+			data["access_key_id"] = envReference(awsIIDEnv("access_key_id"))
+			data["secret_access_key"] = envReference(awsIIDEnv("secret_access_key"))
+		}
+		if settings.AssumeRole != "" {
+			data["assume_role"] = settings.AssumeRole
+		}
+		if settings.SkipBlockDevice {
+			data["skip_block_device"] = true
+		}
+		if settings.DisableInstanceProfileSelectors {
+			data["disable_instance_profile_selectors"] = true
+		}
+	}
+
+	return spireconfig.Plugin{Type: "NodeAttestor", Name: "aws_iid", Data: data}
+}
+
+func gcpIITNodeAttestor(settings *spirev1.GCPIITNodeAttestor) spireconfig.Plugin {
+	data := spireconfig.Data{}
+	if settings != nil {
+		data["projectid_allow_list"] = settings.ProjectIDAllowList
+		if settings.UseInstanceMetadata {
+			data["use_instance_metadata"] = true
+		}
+		if len(settings.AllowedLabelKeys) > 0 {
+			data["allowed_label_keys"] = settings.AllowedLabelKeys
+		}
+		if len(settings.AllowedMetadataKeys) > 0 {
+			data["allowed_metadata_keys"] = settings.AllowedMetadataKeys
+		}
+	}
+
+	return spireconfig.Plugin{Type: "NodeAttestor", Name: "gcp_iit", Data: data}
+}
+
+// azureMSINodeAttestor configures each tenant with the credentials of its
+// Secret, or with the managed service identity of the server.
+func azureMSINodeAttestor(settings *spirev1.AzureMSINodeAttestor) spireconfig.Plugin {
+	tenants := spireconfig.Data{}
+	if settings != nil {
+		for i, tenant := range settings.Tenants {
+			data := spireconfig.Data{"resource_id": tenant.ResourceID}
+			if tenant.CredentialsSecretName != "" {
+				for _, key := range azureCredentialKeys {
+					data[key] = envReference(azureMSIEnv(i, key))
+				}
+			} else {
+				data["use_msi"] = true
+			}
+			tenants[tenant.TenantID] = data
+		}
+	}
+
+	return spireconfig.Plugin{
+		Type: "NodeAttestor",
+		Name: "azure_msi",
+		Data: spireconfig.Data{"tenants": tenants},
+	}
+}
+
+// azureCredentialKeys are the keys of the Secrets holding the credentials of
+// azure_msi tenants, named after the settings of the SPIRE server
+var azureCredentialKeys = []string{"subscription_id", "app_id", "app_secret"}
+
+// nodeAttestorEnvVars returns the environment variables of the SPIRE server
+// container holding the cloud credentials of its node attestors.
+func nodeAttestorEnvVars(s *spirev1.SpireServer) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	if attestor := s.NodeAttestor("aws_iid"); attestor != nil && attestor.AWSIID != nil &&
+		attestor.AWSIID.CredentialsSecretName != "" {
+		for _, key := range []string{"access_key_id", "secret_access_key"} {
+			env = append(env, secretEnv(awsIIDEnv(key), secretKey(attestor.AWSIID.CredentialsSecretName, key)))
+		}
+	}
+	if attestor := s.NodeAttestor("azure_msi"); attestor != nil && attestor.AzureMSI != nil {
+		for i, tenant := range attestor.AzureMSI.Tenants {
+			if tenant.CredentialsSecretName == "" {
+				continue
+			}
+			for _, key := range azureCredentialKeys {
+				env = append(env, secretEnv(azureMSIEnv(i, key), secretKey(tenant.CredentialsSecretName, key)))
+			}
+		}
+	}
+
+	return env
+}
+
+func awsIIDEnv(key string) string {
+	return nodeAttestorEnvPrefix + "AWS_IID_" + strings.ToUpper(key)
+}
+
+// azureMSIEnv names the variables after the position of the tenant, as the
+// IDs of tenants are not valid in variable names.
+func azureMSIEnv(tenant int, key string) string {
+	return fmt.Sprintf("%sAZURE_MSI_%d_%s", nodeAttestorEnvPrefix, tenant, strings.ToUpper(key))
+}
+
+// nodeAttestorVolumes returns the volumes holding the CA certificates the
+// x509pop and tpm_devid node attestors of the SPIRE server verify agents with,
+// along with their mounts.
+func nodeAttestorVolumes(s *spirev1.SpireServer) ([]corev1.Volume, []corev1.VolumeMount) {
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+
+	if attestor := s.NodeAttestor("x509pop"); attestor != nil && attestor.X509PoP != nil &&
+		attestor.X509PoP.CABundleSecretRef != nil {
+		ref := attestor.X509PoP.CABundleSecretRef
+		volumes = append(volumes, corev1.Volume{
+			Name: "x509pop-ca",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+				SecretName: ref.Name,
+				Items:      []corev1.KeyToPath{{Key: ref.Key, Path: path.Base(x509popCABundlePath)}},
+				Optional:   ref.Optional,
+			}},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name: "x509pop-ca", MountPath: path.Dir(x509popCABundlePath), ReadOnly: true})
+	}
+
+	if attestor := s.NodeAttestor("tpm_devid"); attestor != nil && attestor.TPMDevID != nil &&
+		attestor.TPMDevID.DevIDCASecretRef != nil && attestor.TPMDevID.EndorsementCASecretRef != nil {
+		// both CAs share a directory, they are projected into a single volume
+		var sources []corev1.VolumeProjection
+		for _, ca := range []struct {
+			file string
+			ref  *corev1.SecretKeySelector
+		}{
+			{tpmDevIDCAPath, attestor.TPMDevID.DevIDCASecretRef},
+			{tpmEndorsementCAPath, attestor.TPMDevID.EndorsementCASecretRef},
+		} {
+			sources = append(sources, corev1.VolumeProjection{Secret: &corev1.SecretProjection{
+				LocalObjectReference: ca.ref.LocalObjectReference,
+				Items:                []corev1.KeyToPath{{Key: ca.ref.Key, Path: path.Base(ca.file)}},
+				Optional:             ca.ref.Optional,
+			}})
+		}
+		volumes = append(volumes, corev1.Volume{
+			Name:         "tpm-devid-ca",
+			VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: sources}},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name: "tpm-devid-ca", MountPath: path.Dir(tpmDevIDCAPath), ReadOnly: true})
+	}
+
+	return volumes, mounts
+}
+
+// agentNodeAttestor returns the node attestor of the SPIRE agent.
+func agentNodeAttestor(a *spirev1.SpireAgent) spirev1.NodeAttestor {
+	// the spec may not have been through the defaulting webhook
+	defaulted := a.DeepCopy()
+	defaulted.Default()
+
+	return defaulted.Spec.NodeAttestor
+}
+
+func x509popAgentNodeAttestor() spireconfig.Plugin {
+	return spireconfig.Plugin{
+		Type: "NodeAttestor",
+		Name: "x509pop",
+		Data: spireconfig.Data{
+			"certificate_path": x509popCertificatePath,
+			"private_key_path": x509popPrivateKeyPath,
+		},
+	}
+}
+
+func tpmDevIDAgentNodeAttestor(settings *spirev1.TPMDevIDNodeAttestor) spireconfig.Plugin {
+	return spireconfig.Plugin{
+		Type: "NodeAttestor",
+		Name: "tpm_devid",
+		Data: spireconfig.Data{
+			"devid_cert_path": tpmDevIDCertificatePath,
+			"devid_priv_path": tpmDevIDPrivateKeyPath,
+			"tpm_device_path": settings.DevicePath,
+		},
+	}
+}
+
+func azureMSIAgentNodeAttestor(settings *spirev1.AzureMSINodeAttestor) spireconfig.Plugin {
+	return spireconfig.Plugin{
+		Type: "NodeAttestor",
+		Name: "azure_msi",
+		Data: spireconfig.Data{"resource_id": settings.ResourceID},
+	}
+}
+
+// agentNodeAttestorVolumes returns the volumes holding the certificate the
+// SPIRE agent attests with, and the TPM of the node for tpm_devid, along with
+// their mounts. The certificates are read from the node the agent runs on, as
+// each node attests with its own.
+func agentNodeAttestorVolumes(a *spirev1.SpireAgent) ([]corev1.Volume, []corev1.VolumeMount) {
+	attestor := agentNodeAttestor(a)
+
+	switch {
+	case attestor.Name == "x509pop" && attestor.X509PoP != nil:
+		directoryType := corev1.HostPathDirectory
+		volume := corev1.Volume{
+			Name: "x509pop",
+			VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{
+				Path: attestor.X509PoP.CertificateHostPath,
+				Type: &directoryType,
+			}},
+		}
+		mount := corev1.VolumeMount{Name: "x509pop", MountPath: path.Dir(x509popCertificatePath), ReadOnly: true}
+		return []corev1.Volume{volume}, []corev1.VolumeMount{mount}
+
+	case attestor.Name == "tpm_devid":
+		devicePath := attestor.TPMDevID.DevicePath
+		directoryType := corev1.HostPathDirectory
+		deviceType := corev1.HostPathCharDev
+		volumes := []corev1.Volume{
+			{
+				Name: "tpm-devid",
+				VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{
+					Path: attestor.TPMDevID.DevIDHostPath,
+					Type: &directoryType,
+				}},
+			},
+			{
+				Name: "tpm",
+				VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{
+					Path: devicePath,
+					Type: &deviceType,
+				}},
+			},
+		}
+		mounts := []corev1.VolumeMount{
+			{Name: "tpm-devid", MountPath: path.Dir(tpmDevIDCertificatePath), ReadOnly: true},
+			{Name: "tpm", MountPath: devicePath},
+		}
+		return volumes, mounts
+	}
+
+	return nil, nil
+}
@@ -18,36 +18,56 @@ package controller
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"path"
 	"strconv"
-	"strings"
-
-	"golang.org/x/exp/slices"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+	"github.com/glcp/spire-k8s-operator/internal/spireconfig"
+	"github.com/go-logr/logr"
 )
 
 // SpireAgentReconciler reconciles a SpireAgent object
 type SpireAgentReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Images deployed for resources that do not set their own
+	Images Images
+
+	// APIReader reads objects the cache does not hold, such as those of
+	// earlier versions of the operator, defaults to the Client
+	APIReader client.Reader
 }
 
 //+kubebuilder:rbac:groups=spire.hpe.com,resources=spireagents,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=spire.hpe.com,resources=spireagents/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=spire.hpe.com,resources=spireagents/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=spire.hpe.com,resources=spireservers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=serviceaccounts;configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods;nodes;nodes/proxy,verbs=get
+//+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles;clusterrolebindings,verbs=get;list;watch;create;update;patch;delete;bind;escalate
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -67,49 +87,193 @@ func (r *SpireAgentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// fetching SPIRE Agent instance
 	if err := r.Get(ctx, req.NamespacedName, agent); err != nil {
 		if apiErrors.IsNotFound(err) {
-			logger.Error(err, "SPIRE Agent not found.")
-			return ctrl.Result{}, err
+			// owned objects are garbage collected by Kubernetes
+			logger.Info("SPIRE Agent not found, it must have been deleted.")
+			return ctrl.Result{}, nil
 		}
 
 		logger.Error(err, "Failed to get SPIRE Agent instance.")
 		return ctrl.Result{}, err
 	}
 
-	if err := validateAgentYaml(agent, r, ctx); err != nil {
-		if errDelete := r.Delete(ctx, agent); errDelete != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to delete old instance of CRD: %w, original error: %v", errDelete, err)
+	status := agent.Status.DeepCopy()
+
+	if !agent.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalize(ctx, agent, logger)
+	}
+
+	// agents created before serverRef was introduced cannot be updated
+	// without one, the only SPIRE server of their namespace is recorded in
+	// their spec
+	if agent.Spec.ServerRef.Name == "" {
+		servers := &spirev1.SpireServerList{}
+		if err := r.List(ctx, servers, client.InNamespace(agent.Namespace)); err != nil {
+			logger.Error(err, "Failed to list SPIRE Server instances.")
+			return ctrl.Result{}, err
+		}
+		if len(servers.Items) != 1 {
+			logger.Info("SPIRE Agent has no serverRef, skipping reconcile.", "servers", len(servers.Items))
+			reportInvalidSpec(r.Recorder, agent, &agent.Status.Conditions, spirev1.ReasonServerRefMissing,
+				fmt.Errorf("serverRef is not set and namespace %s holds %d SPIRE servers instead of one", agent.Namespace, len(servers.Items)))
+			return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, agent, status, &agent.Status)
+		}
+		agent.Spec.ServerRef.Name = servers.Items[0].Name
+		controllerutil.AddFinalizer(agent, cleanupFinalizer)
+		if err := r.Update(ctx, agent); err != nil {
+			logger.Error(err, "Failed to set serverRef of SPIRE Agent instance.")
+			return ctrl.Result{}, err
 		}
+		logger.Info("Set serverRef of SPIRE Agent instance.", "SpireServer", agent.Spec.ServerRef.Name)
+	}
 
+	if controllerutil.AddFinalizer(agent, cleanupFinalizer) {
+		if err := r.Update(ctx, agent); err != nil {
+			logger.Error(err, "Failed to add finalizer to SPIRE Agent instance.")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// objects left under the names of earlier versions would keep running
+	// alongside the ones generated now
+	if err := removeLegacyComponents(ctx, r.Client, r.APIReader, agent, legacyAgentComponents(agent), logger); err != nil {
+		logger.Error(err, "Failed to remove legacy objects of SPIRE Agent instance.")
 		return ctrl.Result{}, err
 	}
 
-	clusterRole := r.agentClusterRoleDeployment()
-	clusterRoleBinding := r.agentClusterRoleBindingDeployment(req.Namespace)
-	serviceAccount := r.agentServiceAccountDeployment(req.Namespace)
-	agentConfigMap := r.agentConfigMapDeployment(agent, req.Namespace)
-	agentDaemonSet := r.agentDaemonSetDeployment(agent, req.Namespace)
+	// the defaulting webhook may not be deployed, the defaults are applied to
+	// the in-memory copy only so the stored spec is left as the user wrote it
+	agent.Default()
+
+	// the referenced server is watched, so the agent is reconciled again once
+	// it is created
+	server := &spirev1.SpireServer{}
+	if err := r.Get(ctx, agent.ServerKey(), server); err != nil {
+		if !apiErrors.IsNotFound(err) {
+			logger.Error(err, "Failed to get SPIRE Server instance.")
+			return ctrl.Result{}, err
+		}
+
+		logger.Info("Referenced SPIRE Server not found, skipping reconcile.", "SpireServer", agent.ServerKey())
+		reportInvalidSpec(r.Recorder, agent, &agent.Status.Conditions, spirev1.ReasonServerNotFound,
+			fmt.Errorf("SPIRE server %s not found", agent.ServerKey()))
+		return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, agent, status, &agent.Status)
+	}
+	server.Default()
+
+	// an invalid spec is left in place for the user to fix, a change to it
+	// triggers a new reconcile
+	if err := validateAgentYaml(agent, server); err != nil {
+		logger.Info("Invalid SPIRE Agent spec, skipping reconcile.", "reason", err.Error())
+		reportInvalidSpec(r.Recorder, agent, &agent.Status.Conditions, spirev1.ReasonInvalidSpec, err)
+		return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, agent, status, &agent.Status)
+	}
+
+	targetVersion := r.Images.version(agentVersion(agent, server))
+	if err := checkAgentVersion(agent.Status.Version, targetVersion, r.Images.version(server.Spec.Version)); err != nil {
+		logger.Info("Unsupported SPIRE Agent version, skipping reconcile.", "reason", err.Error())
+		reportInvalidSpec(r.Recorder, agent, &agent.Status.Conditions, spirev1.ReasonUnsupportedUpgrade, err)
+		return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, agent, status, &agent.Status)
+	}
+	agent.Status.TargetVersion = targetVersion
+
+	// running agents are only moved to a new version once every replica of
+	// their server runs it, the server is watched so the agent is reconciled
+	// again when its upgrade completes
+	waitingForServer := agent.Status.Version != "" && agent.Status.Version != targetVersion &&
+		!serverRunsVersion(server, targetVersion)
+	deployed := agent
+	if waitingForServer {
+		deployed = agent.DeepCopy()
+		deployed.Spec.Version = agent.Status.Version
+	}
+	deployedVersion := r.Images.version(agentVersion(deployed, server))
+
+	setCondition(&agent.Status.Conditions, agent.Generation, spirev1.ConditionConfigValid,
+		metav1.ConditionTrue, spirev1.ReasonValid, "spec is valid")
+
+	clusterRole := r.agentClusterRoleDeployment(agent, req.Namespace)
+	clusterRoleBinding := r.agentClusterRoleBindingDeployment(agent, req.Namespace)
+	serviceAccount := r.agentServiceAccountDeployment(agent, req.Namespace)
+	agentConfigMap := r.agentConfigMapDeployment(agent, server, req.Namespace)
+	agentDaemonSet := r.agentDaemonSetDeployment(deployed, server, req.Namespace)
+	stampConfigHash(&agentDaemonSet.Spec.Template, agentConfigMap)
+
+	components := []component{
+		{"serviceAccount", serviceAccount},
+		{"clusterRole", clusterRole},
+		{"clusterRoleBinding", clusterRoleBinding},
+		{"agentConfigMap", agentConfigMap},
+		{"agentDaemonSet", agentDaemonSet},
+	}
+
+	// the server publishes its bundle in its own namespace, agents in other
+	// namespaces get a copy
+	if server.Namespace != agent.Namespace {
+		bundle, err := r.agentBundleDeployment(ctx, agent, server, req.Namespace)
+		if err != nil {
+			logger.Error(err, "Failed to get SPIRE Server bundle.")
+			return ctrl.Result{}, err
+		}
 
-	components := map[string]interface{}{
-		"serviceAccount":     serviceAccount,
-		"clusterRole":        clusterRole,
-		"clusterRoleBinding": clusterRoleBinding,
-		"agentConfigMap":     agentConfigMap,
-		"agentDaemonSet":     agentDaemonSet,
+		components = append([]component{{"bundle", bundle}}, components...)
 	}
 
-	for key, value := range components {
-		err := r.Create(ctx, value.(client.Object))
-		result, createError := checkIfFailToCreate(err, key, logger)
-		if createError != nil {
-			err = createError
-			return result, err
+	if err := reconcileComponents(ctx, r.Client, r.Scheme, agent, components, logger); err != nil {
+		setReconcileFailedCondition(&agent.Status.Conditions, agent.Generation, err)
+		if statusErr := updateStatusIfChanged(ctx, r.Client, agent, status, &agent.Status); statusErr != nil {
+			logger.Error(statusErr, "Failed to update SPIRE Agent status.")
 		}
+
+		return ctrl.Result{}, err
+	}
+
+	// the DaemonSet is owned by the SpireAgent, so changes to its status
+	// trigger a new reconcile that refreshes the agent status
+	liveDaemonSet := &appsv1.DaemonSet{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(agentDaemonSet), liveDaemonSet); err != nil {
+		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	agent.Status.ObservedGeneration = agent.Generation
+	agent.Status.DesiredNumberScheduled = liveDaemonSet.Status.DesiredNumberScheduled
+	agent.Status.CurrentNumberScheduled = liveDaemonSet.Status.CurrentNumberScheduled
+	agent.Status.NumberReady = liveDaemonSet.Status.NumberReady
+	setWorkloadConditions(&agent.Status.Conditions, agent.Generation, daemonSetStatus(liveDaemonSet, agentDaemonSet))
+
+	if meta.IsStatusConditionFalse(agent.Status.Conditions, spirev1.ConditionProgressing) {
+		agent.Status.Version = deployedVersion
+	}
+
+	if waitingForServer {
+		setCondition(&agent.Status.Conditions, agent.Generation, spirev1.ConditionProgressing, metav1.ConditionTrue,
+			spirev1.ReasonWaitingForServer, fmt.Sprintf("waiting for SPIRE server %s to run version %s",
+				agent.ServerKey(), targetVersion))
+	}
+
+	return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, agent, status, &agent.Status)
 }
 
-func (r *SpireAgentReconciler) agentClusterRoleDeployment() *rbacv1.ClusterRole {
+// finalize removes the cluster-scoped objects created for the SPIRE agent, then
+// releases the SpireAgent.
+func (r *SpireAgentReconciler) finalize(ctx context.Context, a *spirev1.SpireAgent, logger logr.Logger) error {
+	if !controllerutil.ContainsFinalizer(a, cleanupFinalizer) {
+		return nil
+	}
+
+	components := []component{
+		{"clusterRoleBinding", r.agentClusterRoleBindingDeployment(a, a.Namespace)},
+		{"clusterRole", r.agentClusterRoleDeployment(a, a.Namespace)},
+	}
+
+	if err := deleteComponents(ctx, r.Client, components, logger); err != nil {
+		return reportCleanupBlocked(ctx, r.Client, a, &a.Status.Conditions, err)
+	}
+
+	controllerutil.RemoveFinalizer(a, cleanupFinalizer)
+	return r.Update(ctx, a)
+}
+
+func (r *SpireAgentReconciler) agentClusterRoleDeployment(a *spirev1.SpireAgent, namespace string) *rbacv1.ClusterRole {
 	rules := rbacv1.PolicyRule{
 		Verbs:     []string{"get"},
 		Resources: []string{"pods", "nodes", "nodes/proxy"},
@@ -122,7 +286,8 @@ func (r *SpireAgentReconciler) agentClusterRoleDeployment() *rbacv1.ClusterRole
 			APIVersion: "rbac.authorization.k8s.io/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "spire-agent-cluster-role",
+			Name:   agentClusterRoleName(a.Name, namespace),
+			Labels: componentLabels(agentApp, a.Name),
 		},
 		Rules: []rbacv1.PolicyRule{
 			rules,
@@ -132,10 +297,11 @@ func (r *SpireAgentReconciler) agentClusterRoleDeployment() *rbacv1.ClusterRole
 	return clusterRole
 }
 
-func (r *SpireAgentReconciler) agentClusterRoleBindingDeployment(namespace string) *rbacv1.ClusterRoleBinding {
+func (r *SpireAgentReconciler) agentClusterRoleBindingDeployment(a *spirev1.SpireAgent,
+	namespace string) *rbacv1.ClusterRoleBinding {
 	subject := rbacv1.Subject{
 		Kind:      "ServiceAccount",
-		Name:      "spire-agent",
+		Name:      agentServiceAccountName(a.Name),
 		Namespace: namespace,
 	}
 
@@ -145,7 +311,8 @@ func (r *SpireAgentReconciler) agentClusterRoleBindingDeployment(namespace strin
 			APIVersion: "rbac.authorization.k8s.io/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "spire-agent-cluster-role-binding",
+			Name:   agentClusterRoleBindingName(a.Name, namespace),
+			Labels: componentLabels(agentApp, a.Name),
 		},
 		Subjects: []rbacv1.Subject{
 			subject,
@@ -153,51 +320,110 @@ func (r *SpireAgentReconciler) agentClusterRoleBindingDeployment(namespace strin
 		RoleRef: rbacv1.RoleRef{
 			APIGroup: "rbac.authorization.k8s.io",
 			Kind:     "ClusterRole",
-			Name:     "spire-agent-cluster-role",
+			Name:     agentClusterRoleName(a.Name, namespace),
 		},
 	}
 
 	return clusterRoleBinding
 }
 
-func validateAgentYaml(a *spirev1.SpireAgent, r *SpireAgentReconciler, ctx context.Context) error {
-	invalidTrustDomain := false
-	checkTrustDomain(a.Spec.TrustDomain, &invalidTrustDomain)
+func validateAgentYaml(a *spirev1.SpireAgent, s *spirev1.SpireServer) error {
+	if err := a.ValidateSpec(); err != nil {
+		return err
+	}
+
+	return a.ValidateServerCompatibility(s)
+}
+
+// serverAddress returns the address of the service agents use to reach the
+// SPIRE server.
+func serverAddress(s *spirev1.SpireServer) string {
+	return s.Name + "." + s.Namespace + ".svc"
+}
+
+// agentVersion returns the version of SPIRE the agent runs, which follows
+// the version of its server unless it is pinned.
+func agentVersion(a *spirev1.SpireAgent, s *spirev1.SpireServer) string {
+	return firstNonEmpty(a.Spec.Version, s.Spec.Version)
+}
+
+// checkAgentVersion returns an error when the agent cannot move from the
+// running version to the target one, or cannot connect to its server once it
+// runs the target version.
+func checkAgentVersion(running string, target string, serverVersion string) error {
+	if err := checkUpgrade(running, target); err != nil {
+		return err
+	}
+
+	return checkAgentCompatibility(target, serverVersion)
+}
 
-	if invalidTrustDomain {
-		return errors.New("trust domain is invalid")
+// serverRunsVersion reports whether every replica of the SPIRE server runs
+// version or a newer one.
+func serverRunsVersion(s *spirev1.SpireServer, version string) bool {
+	return s.Status.Version != "" && s.Status.Version == s.Status.TargetVersion &&
+		versionAtLeast(s.Status.Version, version)
+}
+
+// agentBundleName returns the name of the ConfigMap holding the trust bundle
+// of the SPIRE server in the namespace of the agent.
+func agentBundleName(a *spirev1.SpireAgent, s *spirev1.SpireServer) string {
+	if s.Namespace == a.Namespace {
+		return serverBundleName(s.Name)
 	}
 
-	if a.Spec.ServerPort != serverPort {
-		return errors.New("the inputted port does not correspond to a SPIRE server")
+	return agentBundleCopyName(a.Name)
+}
+
+// agentBundleDeployment copies the trust bundle published by a SPIRE server in
+// another namespace.
+func (r *SpireAgentReconciler) agentBundleDeployment(ctx context.Context, a *spirev1.SpireAgent,
+	s *spirev1.SpireServer, namespace string) (*corev1.ConfigMap, error) {
+	serverBundle := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: serverBundleName(s.Name), Namespace: s.Namespace},
+		serverBundle); client.IgnoreNotFound(err) != nil {
+		return nil, err
 	}
 
-	if !(slices.Contains(serverNodeAttestors, a.Spec.NodeAttestor)) {
-		return errors.New("the inputted node attestor is not supported by the server")
+	bundle := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      agentBundleName(a, s),
+			Namespace: namespace,
+			Labels:    componentLabels(agentApp, a.Name),
+		},
+		Data: serverBundle.Data,
 	}
 
-	return nil
+	return bundle, nil
 }
 
-func (r *SpireAgentReconciler) agentServiceAccountDeployment(namespace string) *corev1.ServiceAccount {
+func (r *SpireAgentReconciler) agentServiceAccountDeployment(a *spirev1.SpireAgent,
+	namespace string) *corev1.ServiceAccount {
 	serviceAccount := &corev1.ServiceAccount{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ServiceAccount",
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "spire-agent",
+			Name:      agentServiceAccountName(a.Name),
 			Namespace: namespace,
+			Labels:    componentLabels(agentApp, a.Name),
 		},
 	}
 	return serviceAccount
 }
 
-func (r *SpireAgentReconciler) agentDaemonSetDeployment(a *spirev1.SpireAgent, namespace string) *appsv1.DaemonSet {
+func (r *SpireAgentReconciler) agentDaemonSetDeployment(a *spirev1.SpireAgent, s *spirev1.SpireServer,
+	namespace string) *appsv1.DaemonSet {
 	initContainer := corev1.Container{
-		Name:  "init",
-		Image: "cgr.dev/chainguard/wait-for-it",
-		Args:  []string{"-t", "30", "spire-service:8081"},
+		Name:            "init",
+		Image:           r.Images.initImage(),
+		ImagePullPolicy: a.Spec.ImagePullPolicy,
+		Args:            []string{"-t", "30", serverAddress(s) + ":" + strconv.Itoa(s.Spec.Port)},
 	}
 
 	volMount1 := corev1.VolumeMount{
@@ -221,6 +447,7 @@ func (r *SpireAgentReconciler) agentDaemonSetDeployment(a *spirev1.SpireAgent, n
 		ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
 			Path: "/live", Port: intstr.IntOrString{IntVal: 8080}}},
 		FailureThreshold:    2,
+		SuccessThreshold:    1,
 		InitialDelaySeconds: 15,
 		PeriodSeconds:       60,
 		TimeoutSeconds:      3,
@@ -230,14 +457,24 @@ func (r *SpireAgentReconciler) agentDaemonSetDeployment(a *spirev1.SpireAgent, n
 		ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
 			Path: "/ready", Port: intstr.IntOrString{IntVal: 8080}}},
 		InitialDelaySeconds: 5,
+		TimeoutSeconds:      1,
 		PeriodSeconds:       5,
+		SuccessThreshold:    1,
+		FailureThreshold:    3,
 	}
 
+	dataVolumes, dataMounts := agentDataVolume(a)
+	tokenVolumes, tokenMounts := agentTokenVolume(a, s)
+	attestorVolumes, attestorMounts := agentNodeAttestorVolumes(a)
+
 	container := corev1.Container{
-		Name:           "spire-agent",
-		Image:          "ghcr.io/spiffe/spire-agent:1.5.1",
-		Args:           []string{"-config", "/run/spire/config/agent.conf"},
-		VolumeMounts:   []corev1.VolumeMount{volMount1, volMount2, volMount3},
+		Name:            "spire-agent",
+		Image:           r.Images.agentImage(a.Spec.Image, agentVersion(a, s)),
+		ImagePullPolicy: a.Spec.ImagePullPolicy,
+		Args:            []string{"-config", "/run/spire/config/agent.conf"},
+		Resources:       a.Spec.Resources,
+		VolumeMounts: append(append(append([]corev1.VolumeMount{volMount1, volMount2, volMount3}, dataMounts...),
+			tokenMounts...), attestorMounts...),
 		LivenessProbe:  &livenessProbe,
 		ReadinessProbe: &readinessProbe,
 	}
@@ -246,7 +483,7 @@ func (r *SpireAgentReconciler) agentDaemonSetDeployment(a *spirev1.SpireAgent, n
 		Name: "spire-config",
 		VolumeSource: corev1.VolumeSource{
 			ConfigMap: &corev1.ConfigMapVolumeSource{
-				LocalObjectReference: corev1.LocalObjectReference{Name: "spire-agent"},
+				LocalObjectReference: corev1.LocalObjectReference{Name: agentConfigMapName(a.Name)},
 			},
 		},
 	}
@@ -255,7 +492,7 @@ func (r *SpireAgentReconciler) agentDaemonSetDeployment(a *spirev1.SpireAgent, n
 		Name: "spire-bundle",
 		VolumeSource: corev1.VolumeSource{
 			ConfigMap: &corev1.ConfigMapVolumeSource{
-				LocalObjectReference: corev1.LocalObjectReference{Name: "spire-bundle"},
+				LocalObjectReference: corev1.LocalObjectReference{Name: agentBundleName(a, s)},
 			},
 		},
 	}
@@ -276,20 +513,22 @@ func (r *SpireAgentReconciler) agentDaemonSetDeployment(a *spirev1.SpireAgent, n
 		HostPID:            true,
 		HostNetwork:        true,
 		DNSPolicy:          "ClusterFirstWithHostNet",
-		ServiceAccountName: "spire-agent",
+		ServiceAccountName: agentServiceAccountName(a.Name),
+		ImagePullSecrets:   a.Spec.ImagePullSecrets,
 		InitContainers:     []corev1.Container{initContainer},
 		Containers:         []corev1.Container{container},
-		Volumes:            []corev1.Volume{vol1, vol2, vol3},
+		Volumes:            append(append(append([]corev1.Volume{vol1, vol2, vol3}, dataVolumes...), tokenVolumes...), attestorVolumes...),
 	}
+	schedulePods(&agentPodSpec, a.Spec.PodScheduling, selectorLabels(agentApp, a.Name))
 
 	daemonSetSpec := appsv1.DaemonSetSpec{
 		Selector: &metav1.LabelSelector{
-			MatchLabels: map[string]string{"app": "spire-agent"},
+			MatchLabels: selectorLabels(agentApp, a.Name),
 		},
 		Template: corev1.PodTemplateSpec{
 			ObjectMeta: metav1.ObjectMeta{
 				Namespace: namespace,
-				Labels:    map[string]string{"app": "spire-agent"},
+				Labels:    componentLabels(agentApp, a.Name),
 			},
 			Spec: agentPodSpec,
 		},
@@ -301,9 +540,9 @@ func (r *SpireAgentReconciler) agentDaemonSetDeployment(a *spirev1.SpireAgent, n
 			Kind:       "DaemonSet",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "spire-agent",
+			Name:      a.Name,
 			Namespace: namespace,
-			Labels:    map[string]string{"app": "spire-agent"},
+			Labels:    componentLabels(agentApp, a.Name),
 		},
 		Spec: daemonSetSpec,
 	}
@@ -311,36 +550,8 @@ func (r *SpireAgentReconciler) agentDaemonSetDeployment(a *spirev1.SpireAgent, n
 	return agentDaemonSet
 }
 
-func (r *SpireAgentReconciler) agentConfigMapDeployment(a *spirev1.SpireAgent, namespace string) *corev1.ConfigMap {
-	nodeAttestorsConfig := ""
-
-	if strings.Compare(string(a.Spec.NodeAttestor.Name), "join_token") == 0 {
-		nodeAttestorsConfig += joinTokenAgentNodeAttestor()
-	} else if strings.Compare(string(a.Spec.NodeAttestor.Name), "k8s_sat") == 0 {
-		nodeAttestorsConfig += k8sSatAgentNodeAttestor()
-	} else if strings.Compare(string(a.Spec.NodeAttestor.Name), "k8s_psat") == 0 {
-		nodeAttestorsConfig += k8sPsatAgentNodeAttestor()
-	}
-
-	workloadAttestorsConfig := ""
-	for _, wLAttestor := range a.Spec.WorkloadAttestors {
-		if strings.Compare(string(wLAttestor.Name), "k8s") == 0 {
-			workloadAttestorsConfig += k8sWLAttestor()
-		} else if strings.Compare(string(wLAttestor.Name), "unix") == 0 {
-			workloadAttestorsConfig += unixWLAttestor()
-		} else if strings.Compare(string(wLAttestor.Name), "docker") == 0 {
-			workloadAttestorsConfig += dockerWLAttestor()
-		} else if strings.Compare(string(wLAttestor.Name), "systemd") == 0 {
-			workloadAttestorsConfig += systemdWLAttestor()
-		} else if strings.Compare(string(wLAttestor.Name), "windows") == 0 {
-			workloadAttestorsConfig += windowsWLAttestor()
-		}
-	}
-
-	config := agentCreation(strconv.Itoa(a.Spec.ServerPort), a.Spec.TrustDomain) +
-		pluginsAgent(nodeAttestorsConfig, a.Spec.KeyStorage, workloadAttestorsConfig) +
-		healthChecks()
-
+func (r *SpireAgentReconciler) agentConfigMapDeployment(a *spirev1.SpireAgent, s *spirev1.SpireServer,
+	namespace string) *corev1.ConfigMap {
 	configMap := &corev1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ConfigMap",
@@ -348,121 +559,187 @@ func (r *SpireAgentReconciler) agentConfigMapDeployment(a *spirev1.SpireAgent, n
 		},
 
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "spire-agent",
+			Name:      agentConfigMapName(a.Name),
 			Namespace: namespace,
+			Labels:    componentLabels(agentApp, a.Name),
 		},
 
 		Data: map[string]string{
-			"agent.conf": config,
+			"agent.conf": agentConfig(a, s).Render(),
 		},
 	}
 
 	return configMap
 }
 
-func joinTokenAgentNodeAttestor() string {
-	return `
-	NodeAttestor "join_token" {
-		plugin_data {
+// agentConfig models the agent.conf of a SPIRE agent connecting to server s.
+func agentConfig(a *spirev1.SpireAgent, s *spirev1.SpireServer) spireconfig.AgentConfig {
+	var plugins []spireconfig.Plugin
+
+	switch a.Spec.NodeAttestor.Name {
+	case "join_token":
+		plugins = append(plugins, joinTokenAgentNodeAttestor())
+	case "k8s_sat", "k8s_psat":
+		plugins = append(plugins, k8sAgentNodeAttestor(a.Spec.NodeAttestor.Name, s))
+	case "x509pop":
+		plugins = append(plugins, x509popAgentNodeAttestor())
+	case "tpm_devid":
+		plugins = append(plugins, tpmDevIDAgentNodeAttestor(agentNodeAttestor(a).TPMDevID))
+	case "azure_msi":
+		plugins = append(plugins, azureMSIAgentNodeAttestor(agentNodeAttestor(a).AzureMSI))
+	case "aws_iid", "gcp_iit":
+		// the agents read their identity from the metadata of their instance
+		plugins = append(plugins, spireconfig.Plugin{Type: "NodeAttestor", Name: a.Spec.NodeAttestor.Name})
+	}
 
-		}
-	}`
-}
+	plugins = append(plugins, agentKeyManager(a))
 
-func k8sSatAgentNodeAttestor() string {
-	return `
-	NodeAttestor "k8s_sat" {
-		plugin_data {
-			cluster = "demo-cluster"
+	for _, workloadAttestor := range a.Spec.WorkloadAttestors {
+		switch workloadAttestor.Name {
+		case "k8s":
+			plugins = append(plugins, k8sWLAttestor())
+		case "unix", "docker", "systemd", "windows":
+			plugins = append(plugins, spireconfig.Plugin{Type: "WorkloadAttestor", Name: workloadAttestor.Name})
 		}
-	}`
-}
+	}
 
-func k8sPsatAgentNodeAttestor() string {
-	return `
-	NodeAttestor "k8s_psat" {
-		plugin_data {
-			clusters = {
-				"cluster" = {
-		
-				}
-			}
-		}
-	}`
+	return spireconfig.AgentConfig{
+		Agent: spireconfig.Agent{
+			DataDir:         "/run/spire",
+			LogLevel:        "DEBUG",
+			ServerAddress:   serverAddress(s),
+			ServerPort:      s.Spec.Port,
+			SocketPath:      "/run/spire/sockets/agent.sock",
+			TrustBundlePath: "/run/spire/bundle/bundle.crt",
+			TrustDomain:     s.Spec.TrustDomain,
+		},
+		Plugins:      plugins,
+		HealthChecks: healthChecks(),
+	}
 }
 
-func agentCreation(port string, trustDomain string) string {
-	return `
-	agent {
-		data_dir = "/run/spire"
-		log_level = "DEBUG"
-		server_address = "spire-service"
-		server_port = "` + port + `"
-		socket_path = "/run/spire/sockets/agent.sock"
-		trust_bundle_path = "/run/spire/bundle/bundle.crt"
-		trust_domain = "` + trustDomain + `"
-	  }`
+func joinTokenAgentNodeAttestor() spireconfig.Plugin {
+	return spireconfig.Plugin{Type: "NodeAttestor", Name: "join_token"}
 }
 
-func pluginsAgent(nodeAttestorsConfig string, keyStorage string, workloadAttestorsConfig string) string {
-	return `
-
-	plugins {
-		` + nodeAttestorsConfig + `
-	
-		KeyManager "` + keyStorage + `" {
-			plugin_data {
-			}
-		} ` +
-		workloadAttestorsConfig + `
-	}`
+// agentTokenExpiration is the lifetime of the tokens projected for the
+// k8s_psat node attestor, which the kubelet renews well before they expire
+const agentTokenExpiration = 2 * time.Hour
+
+// k8sAgentNodeAttestor follows the settings of the Kubernetes node attestor
+// of the server, so that the agents attest from the cluster it expects.
+func k8sAgentNodeAttestor(name string, s *spirev1.SpireServer) spireconfig.Plugin {
+	settings := serverNodeAttestor(name, s).Kubernetes
+
+	return spireconfig.Plugin{
+		Type: "NodeAttestor",
+		Name: name,
+		Data: spireconfig.Data{
+			"cluster":    settings.Cluster,
+			"token_path": settings.TokenPath,
+		},
+	}
 }
 
-func k8sWLAttestor() string {
-	return `
+// serverNodeAttestor returns the settings of a node attestor of the server,
+// falling back to the defaults for servers without it, whose agents are
+// refused by the webhook.
+func serverNodeAttestor(name string, s *spirev1.SpireServer) *spirev1.NodeAttestor {
+	if attestor := s.NodeAttestor(name); attestor != nil {
+		return attestor
+	}
 
-	WorkloadAttestor "k8s" {
-		plugin_data {
-			skip_kubelet_verification = true
-		}
-	}`
+	defaulted := &spirev1.SpireServer{Spec: spirev1.SpireServerSpec{NodeAttestors: []spirev1.NodeAttestor{{Name: name}}}}
+	return defaulted.NodeAttestor(name)
 }
 
-func unixWLAttestor() string {
-	return `
+// agentTokenVolume returns the volume projecting the token the agent attests
+// with k8s_psat, along with its mount. Agents attesting with k8s_sat read the
+// token of their service account.
+func agentTokenVolume(a *spirev1.SpireAgent, s *spirev1.SpireServer) ([]corev1.Volume, []corev1.VolumeMount) {
+	if a.Spec.NodeAttestor.Name != "k8s_psat" {
+		return nil, nil
+	}
+	settings := serverNodeAttestor(a.Spec.NodeAttestor.Name, s).Kubernetes
+	expiration := int64(agentTokenExpiration.Seconds())
+	volume := corev1.Volume{
+		Name: "spire-agent-token",
+		VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+			Sources: []corev1.VolumeProjection{{ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+				Audience:          settings.Audience[0],
+				ExpirationSeconds: &expiration,
+				Path:              path.Base(settings.TokenPath),
+			}}},
+		}},
+	}
+	mount := corev1.VolumeMount{Name: "spire-agent-token", MountPath: path.Dir(settings.TokenPath), ReadOnly: true}
 
-	WorkloadAttestor "unix" {
-		plugin_data {
-		}
-	}`
+	return []corev1.Volume{volume}, []corev1.VolumeMount{mount}
 }
 
-func dockerWLAttestor() string {
-	return `
+func k8sWLAttestor() spireconfig.Plugin {
+	return spireconfig.Plugin{
+		Type: "WorkloadAttestor",
+		Name: "k8s",
+		Data: spireconfig.Data{"skip_kubelet_verification": true},
+	}
+}
 
-	WorkloadAttestor "docker" {
-		plugin_data {
+// SetupWithManager sets up the controller with the Manager.
+func (r *SpireAgentReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&spirev1.SpireAgent{}).
+		Owns(&corev1.ServiceAccount{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&appsv1.DaemonSet{}).
+		Watches(&spirev1.SpireServer{}, handler.EnqueueRequestsFromMapFunc(r.spireAgentsForServer)).
+		// the cache only holds the ConfigMaps generated by the operator, see
+		// CacheOptions
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.spireAgentsForBundle)).
+		Complete(r)
+}
+
+// spireAgentsForServer maps a SPIRE server to the SPIRE agents referencing it
+// so that they are reconfigured when the server changes.
+func (r *SpireAgentReconciler) spireAgentsForServer(ctx context.Context, server client.Object) []reconcile.Request {
+	return r.spireAgentsMatching(ctx, func(a *spirev1.SpireAgent) bool {
+		// agents without a serverRef may now find a single server in their
+		// namespace
+		if a.Spec.ServerRef.Name == "" {
+			return a.Namespace == server.GetNamespace()
 		}
-	}`
+		return a.ServerKey() == client.ObjectKeyFromObject(server)
+	})
 }
 
-func systemdWLAttestor() string {
-	return `
+// spireAgentsForBundle maps the trust bundle of SPIRE servers to the SPIRE
+// agents in other namespaces that hold a copy of it.
+func (r *SpireAgentReconciler) spireAgentsForBundle(ctx context.Context, bundle client.Object) []reconcile.Request {
+	if bundle.GetLabels()[nameLabel] != serverApp {
+		return nil
+	}
 
-	WorkloadAttestor "systemd" {
-	}`
+	return r.spireAgentsMatching(ctx, func(a *spirev1.SpireAgent) bool {
+		server := a.ServerKey()
+		return server.Namespace == bundle.GetNamespace() && serverBundleName(server.Name) == bundle.GetName() &&
+			a.Namespace != bundle.GetNamespace()
+	})
 }
 
-func windowsWLAttestor() string {
-	return `
+func (r *SpireAgentReconciler) spireAgentsMatching(ctx context.Context,
+	match func(a *spirev1.SpireAgent) bool) []reconcile.Request {
+	agents := &spirev1.SpireAgentList{}
+	if err := r.List(ctx, agents); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list SPIRE Agents.")
+		return nil
+	}
 
-	WorkloadAttestor "windows" {
-	}`
-}
+	var requests []reconcile.Request
+	for i := range agents.Items {
+		if match(&agents.Items[i]) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&agents.Items[i])})
+		}
+	}
 
-// SetupWithManager sets up the controller with the Manager.
-func (r *SpireAgentReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&spirev1.SpireAgent{}).
-		Complete(r)
+	return requests
 }
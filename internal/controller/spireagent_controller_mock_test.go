@@ -2,13 +2,24 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
-	// "sigs.k8s.io/controller-runtime/pkg/client/fake"
-
 	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 var agentReconciler = &SpireAgentReconciler{
@@ -26,11 +37,11 @@ func TestSpireAgentController(t *testing.T) {
 
 	spireagent := &spirev1.SpireAgent{}
 	spireServiceNamespace := "test-namespace"
-	agentServiceAccount := agentReconciler.agentServiceAccountDeployment(spireServiceNamespace)
-	agentClusterRoles := agentReconciler.agentClusterRoleDeployment()
-	agentClusterRoleBinding := agentReconciler.agentClusterRoleBindingDeployment(spireServiceNamespace)
-	agentConfigMap := agentReconciler.agentConfigMapDeployment(spireagent, spireServiceNamespace)
-	agentDaemonSet := agentReconciler.agentDaemonSetDeployment(spireagent, spireServiceNamespace)
+	agentServiceAccount := agentReconciler.agentServiceAccountDeployment(spireagent, spireServiceNamespace)
+	agentClusterRoles := agentReconciler.agentClusterRoleDeployment(spireagent, spireServiceNamespace)
+	agentClusterRoleBinding := agentReconciler.agentClusterRoleBindingDeployment(spireagent, spireServiceNamespace)
+	agentConfigMap := agentReconciler.agentConfigMapDeployment(spireagent, mockSpireServer, spireServiceNamespace)
+	agentDaemonSet := agentReconciler.agentDaemonSetDeployment(spireagent, mockSpireServer, spireServiceNamespace)
 
 	// Call the method you want to test
 	// Assert the expected behavior
@@ -51,3 +62,380 @@ func TestSpireAgentController(t *testing.T) {
 		t.Errorf("Expected namespace %s, got %s", spireServiceNamespace, agentDaemonSet.Namespace)
 	}
 }
+
+func spireAgentFor(server *spirev1.SpireServer, namespace string) *spirev1.SpireAgent {
+	return &spirev1.SpireAgent{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-agent", Namespace: namespace},
+		Spec: spirev1.SpireAgentSpec{
+			ServerRef:    spirev1.ServerReference{Name: server.Name, Namespace: server.Namespace},
+			NodeAttestor: spirev1.NodeAttestor{Name: "k8s_sat"},
+		},
+	}
+}
+
+func TestAgentReconcileReportsMissingServer(t *testing.T) {
+	ctx := context.Background()
+	agent := spireAgentFor(mockSpireServer, "default")
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(agent).WithStatusSubresource(agent).Build()
+	recorder := record.NewFakeRecorder(1)
+	r := &SpireAgentReconciler{Client: c, Scheme: testScheme, Recorder: recorder}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(agent)})
+	assert.NoError(t, err)
+
+	reconciled := &spirev1.SpireAgent{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(agent), reconciled))
+	condition := meta.FindStatusCondition(reconciled.Status.Conditions, spirev1.ConditionConfigValid)
+	assert.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, spirev1.ReasonServerNotFound, condition.Reason)
+	assert.Equal(t, "Warning ServerNotFound SPIRE server default/valid-spire-server not found", <-recorder.Events)
+
+	err = c.Get(ctx, types.NamespacedName{Name: "spire-agent", Namespace: "default"}, &appsv1.DaemonSet{})
+	assert.True(t, apiErrors.IsNotFound(err))
+}
+
+func TestAgentReconcileDefaultsServerRefToSoleServer(t *testing.T) {
+	ctx := context.Background()
+	agent := spireAgentFor(mockSpireServer, "default")
+	agent.Spec.ServerRef = spirev1.ServerReference{}
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(mockSpireServer.DeepCopy(), agent).WithStatusSubresource(agent).Build()
+	r := &SpireAgentReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(agent)})
+	assert.NoError(t, err)
+
+	reconciled := &spirev1.SpireAgent{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(agent), reconciled))
+	assert.Equal(t, mockSpireServer.Name, reconciled.Spec.ServerRef.Name)
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: "spire-agent", Namespace: "default"}, &appsv1.DaemonSet{}))
+}
+
+func TestAgentReconcileReportsAmbiguousServerRef(t *testing.T) {
+	ctx := context.Background()
+	other := mockSpireServer.DeepCopy()
+	other.Name = "other-spire-server"
+	for _, servers := range [][]client.Object{nil, {mockSpireServer.DeepCopy(), other}} {
+		agent := spireAgentFor(mockSpireServer, "default")
+		agent.Spec.ServerRef = spirev1.ServerReference{}
+		c := fake.NewClientBuilder().WithScheme(testScheme).
+			WithObjects(append(servers, agent)...).WithStatusSubresource(agent).Build()
+		r := &SpireAgentReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(10)}
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(agent)})
+		assert.NoError(t, err)
+
+		reconciled := &spirev1.SpireAgent{}
+		assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(agent), reconciled))
+		assert.Empty(t, reconciled.Spec.ServerRef.Name)
+		condition := meta.FindStatusCondition(reconciled.Status.Conditions, spirev1.ConditionConfigValid)
+		assert.NotNil(t, condition)
+		assert.Equal(t, metav1.ConditionFalse, condition.Status)
+		assert.Equal(t, spirev1.ReasonServerRefMissing, condition.Reason)
+		assert.Contains(t, condition.Message, fmt.Sprintf("holds %d SPIRE servers", len(servers)))
+	}
+}
+
+func TestSpireAgentsForServerMatchesAgentsWithoutServerRef(t *testing.T) {
+	agent := spireAgentFor(mockSpireServer, "default")
+	agent.Spec.ServerRef = spirev1.ServerReference{}
+	elsewhere := spireAgentFor(mockSpireServer, "elsewhere")
+	elsewhere.Spec.ServerRef = spirev1.ServerReference{}
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(agent, elsewhere).Build()
+	r := &SpireAgentReconciler{Client: c, Scheme: testScheme}
+
+	requests := r.spireAgentsForServer(context.Background(), mockSpireServer)
+	assert.Equal(t, []reconcile.Request{{NamespacedName: client.ObjectKeyFromObject(agent)}}, requests)
+}
+
+func TestAgentReconcileConfiguresReferencedServer(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Spec.Port = 9090
+	agent := spireAgentFor(server, "default")
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, agent).WithStatusSubresource(agent).Build()
+	r := &SpireAgentReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(1)}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(agent)})
+	assert.NoError(t, err)
+
+	configMap := &corev1.ConfigMap{}
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: "spire-agent-agent-config", Namespace: "default"}, configMap))
+	assert.Contains(t, configMap.Data["agent.conf"], `server_address = "valid-spire-server.default.svc"`)
+	assert.Contains(t, configMap.Data["agent.conf"], `server_port = 9090`)
+	assert.Contains(t, configMap.Data["agent.conf"], `trust_domain = "example.org"`)
+
+	daemonSet := &appsv1.DaemonSet{}
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: "spire-agent", Namespace: "default"}, daemonSet))
+	assert.Equal(t, []string{"-t", "30", "valid-spire-server.default.svc:9090"}, daemonSet.Spec.Template.Spec.InitContainers[0].Args)
+	assert.Equal(t, "valid-spire-server-bundle", daemonSet.Spec.Template.Spec.Volumes[1].ConfigMap.Name)
+	assert.Equal(t, []corev1.Toleration{{Operator: corev1.TolerationOpExists}}, daemonSet.Spec.Template.Spec.Tolerations,
+		"agents should run on tainted nodes by default")
+}
+
+func TestAgentReconcileCopiesBundleFromServerNamespace(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Namespace = "spire"
+	serverBundle := reconciler.spireBundleDeployment(server, "spire")
+	serverBundle.Data = map[string]string{"bundle.crt": "certificate"}
+	agent := spireAgentFor(server, "workloads")
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, serverBundle, agent).WithStatusSubresource(agent).Build()
+	r := &SpireAgentReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(1)}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(agent)})
+	assert.NoError(t, err)
+
+	bundle := &corev1.ConfigMap{}
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: "spire-agent-agent-bundle", Namespace: "workloads"}, bundle))
+	assert.Equal(t, "certificate", bundle.Data["bundle.crt"])
+
+	daemonSet := &appsv1.DaemonSet{}
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: "spire-agent", Namespace: "workloads"}, daemonSet))
+	assert.Equal(t, "spire-agent-agent-bundle", daemonSet.Spec.Template.Spec.Volumes[1].ConfigMap.Name)
+}
+
+func TestAgentNamedAfterServerKeepsServerObjects(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	serverConfig := reconciler.spireConfigMapDeployment(server, "default", nil)
+	serverAccount := reconciler.createServiceAccount(server, "default")
+	agent := spireAgentFor(server, "default")
+	agent.Name = server.Name
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, serverConfig, serverAccount, agent).WithStatusSubresource(agent).Build()
+	r := &SpireAgentReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(1)}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(agent)})
+	assert.NoError(t, err)
+
+	configMap := &corev1.ConfigMap{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(serverConfig), configMap))
+	assert.Equal(t, serverConfig.Data, configMap.Data, "the agent should not overwrite the server configuration")
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: "valid-spire-server-agent-config", Namespace: "default"}, configMap))
+	assert.Contains(t, configMap.Data, "agent.conf")
+
+	serviceAccount := &corev1.ServiceAccount{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(serverAccount), serviceAccount))
+	assert.Equal(t, serverApp, serviceAccount.Labels[nameLabel])
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: "valid-spire-server-agent", Namespace: "default"}, serviceAccount))
+}
+
+func TestSpireAgentsForServerAndBundle(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Namespace = "spire"
+	local := spireAgentFor(server, "spire")
+	remote := spireAgentFor(server, "workloads")
+	other := spireAgentFor(mockSpireServer, "default")
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(local, remote, other).Build()
+	r := &SpireAgentReconciler{Client: c, Scheme: testScheme}
+
+	assert.ElementsMatch(t, []reconcile.Request{
+		{NamespacedName: client.ObjectKeyFromObject(local)},
+		{NamespacedName: client.ObjectKeyFromObject(remote)},
+	}, r.spireAgentsForServer(ctx, server))
+
+	assert.Equal(t, []reconcile.Request{{NamespacedName: client.ObjectKeyFromObject(remote)}},
+		r.spireAgentsForBundle(ctx, reconciler.spireBundleDeployment(server, "spire")))
+	assert.Empty(t, r.spireAgentsForBundle(ctx, reconciler.createServiceAccount(server, "spire")))
+
+	otherServer := server.DeepCopy()
+	otherServer.Name = "other-spire-server"
+	assert.Empty(t, r.spireAgentsForBundle(ctx, reconciler.spireBundleDeployment(otherServer, "spire")))
+}
+
+func TestDaemonSetUsesConfiguredImages(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+	agent := spireAgentFor(server, "default")
+	r := &SpireAgentReconciler{Images: Images{AgentImage: "registry.example.com/spire-agent",
+		InitImage: "registry.example.com/wait-for-it:latest"}}
+
+	podSpec := r.agentDaemonSetDeployment(agent, server, "default").Spec.Template.Spec
+	assert.Equal(t, "registry.example.com/spire-agent:"+DefaultVersion, podSpec.Containers[0].Image)
+	assert.Equal(t, "registry.example.com/wait-for-it:latest", podSpec.InitContainers[0].Image)
+
+	server.Spec.Version = "1.6.3"
+	podSpec = r.agentDaemonSetDeployment(agent, server, "default").Spec.Template.Spec
+	assert.Equal(t, "registry.example.com/spire-agent:1.6.3", podSpec.Containers[0].Image,
+		"agents should follow the version of their server")
+
+	agent.Spec.Version = "1.6.2"
+	agent.Spec.ImagePullPolicy = corev1.PullIfNotPresent
+	agent.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry-credentials"}}
+	podSpec = r.agentDaemonSetDeployment(agent, server, "default").Spec.Template.Spec
+	assert.Equal(t, "registry.example.com/spire-agent:1.6.2", podSpec.Containers[0].Image)
+	assert.Equal(t, corev1.PullIfNotPresent, podSpec.Containers[0].ImagePullPolicy)
+	assert.Equal(t, corev1.PullIfNotPresent, podSpec.InitContainers[0].ImagePullPolicy)
+	assert.Equal(t, agent.Spec.ImagePullSecrets, podSpec.ImagePullSecrets)
+}
+
+func TestAgentUpgradeWaitsForServer(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Spec.Version = "1.6.3"
+	server.Status.Version = "1.5.1"
+	server.Status.TargetVersion = "1.6.3"
+	agent := spireAgentFor(server, "default")
+	agent.Status.Version = "1.5.1"
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, agent).WithStatusSubresource(server, agent).Build()
+	r := &SpireAgentReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(1)}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(agent)})
+	assert.NoError(t, err)
+
+	daemonSet := &appsv1.DaemonSet{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(agent), daemonSet))
+	assert.Equal(t, "ghcr.io/spiffe/spire-agent:1.5.1", daemonSet.Spec.Template.Spec.Containers[0].Image)
+
+	reconciled := &spirev1.SpireAgent{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(agent), reconciled))
+	assert.Equal(t, "1.6.3", reconciled.Status.TargetVersion)
+	condition := meta.FindStatusCondition(reconciled.Status.Conditions, spirev1.ConditionProgressing)
+	assert.NotNil(t, condition)
+	assert.Equal(t, spirev1.ReasonWaitingForServer, condition.Reason)
+
+	server.Status.Version = "1.6.3"
+	assert.NoError(t, c.Status().Update(ctx, server))
+
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(agent)})
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(agent), daemonSet))
+	assert.Equal(t, "ghcr.io/spiffe/spire-agent:1.6.3", daemonSet.Spec.Template.Spec.Containers[0].Image)
+}
+
+func TestAgentRefusesVersionNewerThanServer(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Spec.Version = "1.5.1"
+	agent := spireAgentFor(server, "default")
+	agent.Spec.Version = "1.6.3"
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, agent).WithStatusSubresource(agent).Build()
+	r := &SpireAgentReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(1)}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(agent)})
+	assert.NoError(t, err)
+
+	reconciled := &spirev1.SpireAgent{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(agent), reconciled))
+	condition := meta.FindStatusCondition(reconciled.Status.Conditions, spirev1.ConditionConfigValid)
+	assert.NotNil(t, condition)
+	assert.Equal(t, spirev1.ReasonUnsupportedUpgrade, condition.Reason)
+	assert.Contains(t, condition.Message, "cannot be newer than its server")
+}
+
+func TestConfigChangeRollsDaemonSet(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	agent := spireAgentFor(server, "default")
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, agent).WithStatusSubresource(agent).Build()
+	r := &SpireAgentReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(1)}
+
+	configHash := func() string {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(agent)})
+		assert.NoError(t, err)
+
+		daemonSet := &appsv1.DaemonSet{}
+		assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(agent), daemonSet))
+		return daemonSet.Spec.Template.Annotations[configHashAnnotation]
+	}
+
+	initial := configHash()
+	assert.NotEmpty(t, initial)
+	assert.Equal(t, initial, configHash())
+
+	// the agent configuration holds the port of its server
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), server))
+	server.Spec.Port = 9090
+	assert.NoError(t, c.Update(ctx, server))
+	assert.NotEqual(t, initial, configHash())
+}
+
+func TestDaemonSetSchedulesAgentPods(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+	agent := spireAgentFor(server, "default")
+	agent.Spec.Resources = corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+		Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+	}
+	agent.Spec.NodeSelector = map[string]string{"kubernetes.io/os": "linux"}
+	agent.Spec.Tolerations = []corev1.Toleration{{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists}}
+	agent.Spec.PriorityClassName = "system-node-critical"
+
+	podSpec := agentReconciler.agentDaemonSetDeployment(agent, server, "default").Spec.Template.Spec
+	assert.Equal(t, agent.Spec.Resources, podSpec.Containers[0].Resources)
+	assert.Equal(t, agent.Spec.NodeSelector, podSpec.NodeSelector)
+	assert.Equal(t, agent.Spec.Tolerations, podSpec.Tolerations)
+	assert.Equal(t, "system-node-critical", podSpec.PriorityClassName)
+}
+
+func TestDaemonSetKeepsDiskKeysOnNodes(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+	agent := spireAgentFor(server, "default")
+
+	podSpec := agentReconciler.agentDaemonSetDeployment(agent, server, "default").Spec.Template.Spec
+	for _, volume := range podSpec.Volumes {
+		assert.NotEqual(t, "spire-agent-data", volume.Name, "keys in memory need no volume")
+	}
+
+	agent.Spec.KeyManager = &spirev1.AgentKeyManager{Disk: &spirev1.AgentDiskKeyManager{}}
+
+	podSpec = agentReconciler.agentDaemonSetDeployment(agent, server, "default").Spec.Template.Spec
+	volume := podSpec.Volumes[len(podSpec.Volumes)-1]
+	assert.Equal(t, "spire-agent-data", volume.Name)
+	assert.Equal(t, "/var/lib/spire-agent/default/"+agent.Name, volume.HostPath.Path)
+	assert.Contains(t, podSpec.Containers[0].VolumeMounts,
+		corev1.VolumeMount{Name: "spire-agent-data", MountPath: "/run/spire/data"})
+}
+
+func TestDaemonSetProjectsPsatToken(t *testing.T) {
+	server := createSpireServer("example.org", 8081, []spirev1.NodeAttestor{{Name: "k8s_psat"}}, "disk", 1)
+	agent := spireAgentFor(server, "default")
+
+	podSpec := agentReconciler.agentDaemonSetDeployment(agent, server, "default").Spec.Template.Spec
+	for _, volume := range podSpec.Volumes {
+		assert.NotEqual(t, "spire-agent-token", volume.Name, "k8s_sat reads the token of the service account")
+	}
+
+	agent.Spec.NodeAttestor.Name = "k8s_psat"
+	server.Spec.NodeAttestors[0].Kubernetes = &spirev1.KubernetesNodeAttestor{
+		Audience:  []string{"spire-production"},
+		TokenPath: "/var/run/secrets/spire/token",
+	}
+
+	podSpec = agentReconciler.agentDaemonSetDeployment(agent, server, "default").Spec.Template.Spec
+	volume := podSpec.Volumes[len(podSpec.Volumes)-1]
+	assert.Equal(t, "spire-agent-token", volume.Name)
+	projection := volume.Projected.Sources[0].ServiceAccountToken
+	assert.Equal(t, "spire-production", projection.Audience)
+	assert.Equal(t, "token", projection.Path)
+	assert.Contains(t, podSpec.Containers[0].VolumeMounts,
+		corev1.VolumeMount{Name: "spire-agent-token", MountPath: "/var/run/secrets/spire", ReadOnly: true})
+}
+
+func TestDaemonSetMountsTPM(t *testing.T) {
+	server := createSpireServer("example.org", 8081, []spirev1.NodeAttestor{{Name: "tpm_devid"}}, "disk", 1)
+	agent := spireAgentFor(server, "default")
+	agent.Spec.NodeAttestor = spirev1.NodeAttestor{
+		Name:     "tpm_devid",
+		TPMDevID: &spirev1.TPMDevIDNodeAttestor{DevIDHostPath: "/etc/spire-agent/devid"},
+	}
+
+	podSpec := agentReconciler.agentDaemonSetDeployment(agent, server, "default").Spec.Template.Spec
+	volumes := podSpec.Volumes[len(podSpec.Volumes)-2:]
+	assert.Equal(t, "/etc/spire-agent/devid", volumes[0].HostPath.Path, "each node has its own DevID")
+	assert.Equal(t, "/dev/tpmrm0", volumes[1].HostPath.Path)
+	container := podSpec.Containers[0]
+	assert.Contains(t, container.VolumeMounts,
+		corev1.VolumeMount{Name: "tpm-devid", MountPath: "/run/spire/nodeattestor/tpm_devid", ReadOnly: true})
+	assert.Contains(t, container.VolumeMounts, corev1.VolumeMount{Name: "tpm", MountPath: "/dev/tpmrm0"})
+	assert.Nil(t, container.SecurityContext, "only the TPM device is mounted")
+}
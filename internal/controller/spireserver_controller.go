@@ -18,44 +18,69 @@ package controller
 
 import (
 	"context"
-	"errors"
-	"fmt"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
-	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+	"github.com/glcp/spire-k8s-operator/internal/spireconfig"
 	"github.com/go-logr/logr"
 )
 
 // SpireServerReconciler reconciles a SpireServer object
 type SpireServerReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Images deployed for resources that do not set their own
+	Images Images
+
+	// APIReader reads objects the cache does not hold, such as those of
+	// earlier versions of the operator, defaults to the Client
+	APIReader client.Reader
 }
 
-var (
-	serverNodeAttestors []spirev1.NodeAttestor
-	serverPort          int
+const (
+	// healthCheckInterval is how often the health of a SPIRE server that is
+	// not ready yet is evaluated again
+	healthCheckInterval = 5 * time.Second
+
+	// readyHealthCheckInterval is how often the health of a ready SPIRE server
+	// is evaluated again
+	readyHealthCheckInterval = 30 * time.Second
 )
 
 //+kubebuilder:rbac:groups=spire.hpe.com,resources=spireservers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=spire.hpe.com,resources=spireservers/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=spire.hpe.com,resources=spireservers/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=spire.hpe.com,resources=spireagents,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=serviceaccounts;configmaps;services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings;clusterroles;clusterrolebindings,verbs=get;list;watch;create;update;patch;delete;bind;escalate
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -76,104 +101,256 @@ func (r *SpireServerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// fetching SPIRE Server instance
 	if err := r.Get(ctx, req.NamespacedName, spireserver); err != nil {
 		if apiErrors.IsNotFound(err) {
-			logger.Error(err, "SPIRE server not found.")
-			return ctrl.Result{}, err
+			// owned objects are garbage collected by Kubernetes
+			logger.Info("SPIRE server not found, it must have been deleted.")
+			return ctrl.Result{}, nil
 		}
 
 		logger.Error(err, "Failed to get SPIRE Server instance.")
 		return ctrl.Result{}, err
 	}
 
-	if err := validateYaml(spireserver); err != nil {
-		if errDelete := r.Delete(ctx, spireserver); errDelete != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to delete old instance of CRD: %w, original error: %v", errDelete, err)
+	status := spireserver.Status.DeepCopy()
+
+	if !spireserver.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalize(ctx, spireserver, logger)
+	}
+
+	if controllerutil.AddFinalizer(spireserver, cleanupFinalizer) {
+		if err := r.Update(ctx, spireserver); err != nil {
+			logger.Error(err, "Failed to add finalizer to SPIRE Server instance.")
+			return ctrl.Result{}, err
 		}
+	}
+
+	// objects left under the names of earlier versions would keep running
+	// alongside the ones generated now
+	if err := removeLegacyComponents(ctx, r.Client, r.APIReader, spireserver, legacyServerComponents(spireserver), logger); err != nil {
+		logger.Error(err, "Failed to remove legacy objects of SPIRE Server instance.")
+		return ctrl.Result{}, err
+	}
+
+	// the defaulting webhook may not be deployed, the defaults are applied to
+	// the in-memory copy only so the stored spec is left as the user wrote it
+	spireserver.Default()
+
+	// an invalid spec is left in place for the user to fix, a change to it
+	// triggers a new reconcile
+	if err := validateYaml(spireserver); err != nil {
+		logger.Info("Invalid SPIRE Server spec, skipping reconcile.", "reason", err.Error())
+		reportInvalidSpec(r.Recorder, spireserver, &spireserver.Status.Conditions, spirev1.ReasonInvalidSpec, err)
+		return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, spireserver, status, &spireserver.Status)
+	}
+
+	// the running servers are left alone rather than moved to a version they
+	// cannot be upgraded to
+	targetVersion := r.Images.version(spireserver.Spec.Version)
+	if err := checkUpgrade(spireserver.Status.Version, targetVersion); err != nil {
+		logger.Info("Unsupported SPIRE Server upgrade, skipping reconcile.", "reason", err.Error())
+		reportInvalidSpec(r.Recorder, spireserver, &spireserver.Status.Conditions, spirev1.ReasonUnsupportedUpgrade, err)
+		return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, spireserver, status, &spireserver.Status)
+	}
+	spireserver.Status.TargetVersion = targetVersion
 
+	setCondition(&spireserver.Status.Conditions, spireserver.Generation, spirev1.ConditionConfigValid,
+		metav1.ConditionTrue, spirev1.ReasonValid, "spec is valid")
+
+	agentServiceAccounts, err := r.agentServiceAccounts(ctx, spireserver)
+	if err != nil {
+		logger.Error(err, "Failed to list SPIRE Agents.")
 		return ctrl.Result{}, err
 	}
 
-	serverPort = spireserver.Spec.Port
+	serviceAccount := r.createServiceAccount(spireserver, req.Namespace)
 
-	serviceAccount := r.createServiceAccount(req.Namespace)
+	bundle := r.spireBundleDeployment(spireserver, req.Namespace)
 
-	bundle := r.spireBundleDeployment(req.Namespace)
+	roles := r.spireRoleDeployment(spireserver, req.Namespace)
 
-	roles := r.spireRoleDeployment(req.Namespace)
+	roleBinding := r.spireRoleBindingDeployment(spireserver, req.Namespace)
 
-	roleBinding := r.spireRoleBindingDeployment(req.Namespace)
+	clusterRoles := r.spireClusterRoleDeployment(spireserver, req.Namespace)
 
-	clusterRoles := r.spireClusterRoleDeployment(req.Namespace)
+	clusterRoleBinding := r.spireClusterRoleBindingDeployment(spireserver, req.Namespace)
 
-	clusterRoleBinding := r.spireClusterRoleBindingDeployment(req.Namespace)
+	serverConfigMap := r.spireConfigMapDeployment(spireserver, req.Namespace, agentServiceAccounts)
 
-	serverConfigMap := r.spireConfigMapDeployment(spireserver, req.Namespace)
+	spireStatefulSet := r.spireStatefulSetDeployment(spireserver, req.Namespace)
+	stampConfigHash(&spireStatefulSet.Spec.Template, serverConfigMap)
 
-	spireStatefulSet := r.spireStatefulSetDeployment(spireserver.Spec.Replicas, req.Namespace)
+	// the pods are stopped while a SpireServerRestore replaces their data
+	if spireserver.Annotations[restoreAnnotation] != "" {
+		stopped := int32(0)
+		spireStatefulSet.Spec.Replicas = &stopped
+	}
 
-	spireService := r.spireServiceDeployment(spireserver.Spec.Port, req.Namespace)
+	spireService := r.spireServiceDeployment(spireserver, req.Namespace)
 
-	components := map[string]interface{}{
-		"serviceAccount":     serviceAccount,
-		"bundle":             bundle,
-		"role":               roles,
-		"clusterRole":        clusterRoles,
-		"roleBinging":        roleBinding,
-		"clusterRoleBinding": clusterRoleBinding,
-		"serverConfigMap":    serverConfigMap,
-		"spireStatefulSet":   spireStatefulSet,
-		"spireService":       spireService,
+	components := []component{
+		{"serviceAccount", serviceAccount},
+		{"bundle", bundle},
+		{"role", roles},
+		{"clusterRole", clusterRoles},
+		{"roleBinding", roleBinding},
+		{"clusterRoleBinding", clusterRoleBinding},
+		{"serverConfigMap", serverConfigMap},
+		{"spireStatefulSet", spireStatefulSet},
+		{"spireService", spireService},
 	}
 
-	for key, value := range components {
-		err := r.Create(ctx, value.(client.Object))
-		result, createError := checkIfFailToCreate(err, key, logger)
-		if createError != nil {
-			err = createError
-			return result, err
+	// the managed database comes first, so that it is starting by the time
+	// the server looks for it
+	var dataStore *appsv1.StatefulSet
+	if spireserver.Spec.ManagedDataStore != nil {
+		dataStoreSecret, err := r.managedDataStoreSecret(spireserver, req.Namespace)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		dataStore = r.managedDataStoreStatefulSet(spireserver, req.Namespace)
+
+		components = append([]component{
+			{"dataStoreSecret", dataStoreSecret},
+			{"dataStoreService", r.managedDataStoreService(spireserver, req.Namespace)},
+			{"dataStore", dataStore},
+		}, components...)
+	}
+
+	if err := reconcileComponents(ctx, r.Client, r.Scheme, spireserver, components, logger); err != nil {
+		setReconcileFailedCondition(&spireserver.Status.Conditions, spireserver.Generation, err)
+		if statusErr := updateStatusIfChanged(ctx, r.Client, spireserver, status, &spireserver.Status); statusErr != nil {
+			logger.Error(statusErr, "Failed to update SPIRE Server status.")
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	if spireserver.Spec.ManagedDataStore == nil {
+		if err := r.removeManagedDataStore(ctx, spireserver, logger); err != nil {
+			logger.Error(err, "Failed to remove the managed datastore of SPIRE Server.")
+			return ctrl.Result{}, err
 		}
 	}
-	return healthCheck(r, ctx, spireserver, spireStatefulSet)
-}
 
-func checkIfFailToCreate(err error, name string, logger logr.Logger) (ctrl.Result, error) {
+	if err := r.expandDataVolumes(ctx, spireserver, logger); err != nil {
+		logger.Error(err, "Failed to expand SPIRE Server volumes.")
+		return ctrl.Result{}, err
+	}
+
+	if dataStore != nil {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(dataStore), dataStore); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	setDataStoreCondition(spireserver, dataStore)
+
+	result, err := healthCheck(r, ctx, spireserver, spireStatefulSet)
 	if err != nil {
-		logger.Error(err, "Failed to create", "Name", name)
+		return ctrl.Result{}, err
+	}
+
+	// agents wait for the version to be recorded before they are upgraded, so
+	// it is only recorded once every replica runs it
+	if meta.IsStatusConditionFalse(spireserver.Status.Conditions, spirev1.ConditionProgressing) {
+		spireserver.Status.Version = targetVersion
 	}
-	return ctrl.Result{}, err
+
+	spireserver.Status.ObservedGeneration = spireserver.Generation
+
+	return result, updateStatusIfChanged(ctx, r.Client, spireserver, status, &spireserver.Status)
 }
 
-func validateYaml(s *spirev1.SpireServer) error {
-	invalidTrustDomain := false
-	checkTrustDomain(s.Spec.TrustDomain, &invalidTrustDomain)
+// finalize removes the cluster-scoped objects created for the SPIRE server and
+// its trust bundle, then releases the SpireServer.
+func (r *SpireServerReconciler) finalize(ctx context.Context, s *spirev1.SpireServer, logger logr.Logger) error {
+	if !controllerutil.ContainsFinalizer(s, cleanupFinalizer) {
+		return nil
+	}
+
+	components := []component{
+		{"clusterRoleBinding", r.spireClusterRoleBindingDeployment(s, s.Namespace)},
+		{"clusterRole", r.spireClusterRoleDeployment(s, s.Namespace)},
+		{"bundle", r.spireBundleDeployment(s, s.Namespace)},
+	}
+
+	if err := deleteComponents(ctx, r.Client, components, logger); err != nil {
+		return reportCleanupBlocked(ctx, r.Client, s, &s.Status.Conditions, err)
+	}
+
+	controllerutil.RemoveFinalizer(s, cleanupFinalizer)
+	return r.Update(ctx, s)
+}
 
-	if invalidTrustDomain {
-		return errors.New("trust domain is invalid")
+// expandDataVolumes grows the PersistentVolumeClaims of the SPIRE server pods
+// to the size in its spec. The claim templates of the StatefulSet cannot be
+// changed, so claims created later are expanded on the next reconcile.
+func (r *SpireServerReconciler) expandDataVolumes(ctx context.Context, s *spirev1.SpireServer, logger logr.Logger) error {
+	storage := s.Spec.Storage
+	if storage.EmptyDir != nil {
+		return nil
 	}
 
-	if (strings.Compare("sqlite3", strings.ToLower(s.Spec.DataStore)) == 0) && (s.Spec.Replicas > 1) {
-		return errors.New("cannot have more than 1 replica with sqlite3 database")
+	claims := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, claims, client.InNamespace(s.Namespace),
+		client.MatchingLabels(selectorLabels(serverApp, s.Name))); err != nil {
+		return err
 	}
 
-	serverNodeAttestors = s.Spec.NodeAttestors
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if !strings.HasPrefix(claim.Name, serverDataClaimPrefix(s.Name)) {
+			continue
+		}
+
+		requested := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+		if requested.Cmp(*storage.Size) >= 0 {
+			continue
+		}
+
+		patch := client.MergeFrom(claim.DeepCopy())
+		if claim.Spec.Resources.Requests == nil {
+			claim.Spec.Resources.Requests = corev1.ResourceList{}
+		}
+		claim.Spec.Resources.Requests[corev1.ResourceStorage] = *storage.Size
+		if err := r.Patch(ctx, claim, patch); err != nil {
+			return err
+		}
+		logger.Info("Expanding SPIRE Server volume.", "PersistentVolumeClaim", claim.Name,
+			"From", requested.String(), "To", storage.Size.String())
+	}
 
 	return nil
 }
 
-func checkTrustDomain(trustDomain string, invalidTrustDomain *bool) {
-	defer func() {
-		if err := recover(); err != nil {
-			*invalidTrustDomain = true
+func validateYaml(s *spirev1.SpireServer) error {
+	// the same checks run in the validating webhook, they are repeated here
+	// for clusters where the webhook is not deployed
+	return s.ValidateSpec()
+}
+
+// agentServiceAccounts returns the service accounts of the SPIRE agents that
+// connect to the SPIRE server as namespace:name pairs, which the server must
+// allow.
+func (r *SpireServerReconciler) agentServiceAccounts(ctx context.Context, s *spirev1.SpireServer) ([]string, error) {
+	agents := &spirev1.SpireAgentList{}
+	if err := r.List(ctx, agents); err != nil {
+		return nil, err
+	}
+
+	var serviceAccounts []string
+	for _, agent := range agents.Items {
+		if agent.ServerKey() == client.ObjectKeyFromObject(s) {
+			serviceAccounts = append(serviceAccounts, agent.Namespace+":"+agentServiceAccountName(agent.Name))
 		}
-	}()
+	}
 
-	spiffeid.RequireTrustDomainFromString(trustDomain)
-	*invalidTrustDomain = false
+	return serviceAccounts, nil
 }
 
-func (r *SpireServerReconciler) spireClusterRoleBindingDeployment(namespace string) *rbacv1.ClusterRoleBinding {
+func (r *SpireServerReconciler) spireClusterRoleBindingDeployment(s *spirev1.SpireServer,
+	namespace string) *rbacv1.ClusterRoleBinding {
 	subject := rbacv1.Subject{
 		Kind:      "ServiceAccount",
-		Name:      "spire-server",
+		Name:      serverServiceAccountName(s.Name),
 		Namespace: namespace,
 	}
 
@@ -183,7 +360,8 @@ func (r *SpireServerReconciler) spireClusterRoleBindingDeployment(namespace stri
 			APIVersion: "rbac.authorization.k8s.io/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "spire-server-trust-role-binding",
+			Name:   serverClusterRoleBindingName(s.Name, namespace),
+			Labels: componentLabels(serverApp, s.Name),
 		},
 		Subjects: []rbacv1.Subject{
 			subject,
@@ -191,16 +369,16 @@ func (r *SpireServerReconciler) spireClusterRoleBindingDeployment(namespace stri
 		RoleRef: rbacv1.RoleRef{
 			APIGroup: "rbac.authorization.k8s.io",
 			Kind:     "ClusterRole",
-			Name:     "spire-server-trust-role",
+			Name:     serverClusterRoleName(s.Name, namespace),
 		},
 	}
 	return clusterRoleBinding
 }
 
-func (r *SpireServerReconciler) spireRoleBindingDeployment(namespace string) *rbacv1.RoleBinding {
+func (r *SpireServerReconciler) spireRoleBindingDeployment(s *spirev1.SpireServer, namespace string) *rbacv1.RoleBinding {
 	subject := rbacv1.Subject{
 		Kind:      "ServiceAccount",
-		Name:      "spire-server",
+		Name:      serverServiceAccountName(s.Name),
 		Namespace: namespace,
 	}
 
@@ -210,8 +388,9 @@ func (r *SpireServerReconciler) spireRoleBindingDeployment(namespace string) *rb
 			APIVersion: "rbac.authorization.k8s.io/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "spire-server-configmap-role-binding",
+			Name:      serverRoleName(s.Name) + "-binding",
 			Namespace: namespace,
+			Labels:    componentLabels(serverApp, s.Name),
 		},
 		Subjects: []rbacv1.Subject{
 			subject,
@@ -219,18 +398,26 @@ func (r *SpireServerReconciler) spireRoleBindingDeployment(namespace string) *rb
 		RoleRef: rbacv1.RoleRef{
 			APIGroup: "rbac.authorization.k8s.io",
 			Kind:     "Role",
-			Name:     "spire-server-configmap-role",
+			Name:     serverRoleName(s.Name),
 		},
 	}
 	return roleBinding
 
 }
 
-func (r *SpireServerReconciler) spireClusterRoleDeployment(namespace string) *rbacv1.ClusterRole {
-	rules := rbacv1.PolicyRule{
+func (r *SpireServerReconciler) spireClusterRoleDeployment(s *spirev1.SpireServer, namespace string) *rbacv1.ClusterRole {
+	rules := []rbacv1.PolicyRule{{
 		Verbs:     []string{"create"},
 		Resources: []string{"tokenreviews"},
 		APIGroups: []string{"authentication.k8s.io"},
+	}}
+	// k8s_psat looks up the pods and nodes of the agents
+	if s.NodeAttestor("k8s_psat") != nil {
+		rules = append(rules, rbacv1.PolicyRule{
+			Verbs:     []string{"get"},
+			Resources: []string{"pods", "nodes"},
+			APIGroups: []string{""},
+		})
 	}
 
 	clusterRole := &rbacv1.ClusterRole{
@@ -239,16 +426,15 @@ func (r *SpireServerReconciler) spireClusterRoleDeployment(namespace string) *rb
 			APIVersion: "rbac.authorization.k8s.io/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "spire-server-trust-role",
-		},
-		Rules: []rbacv1.PolicyRule{
-			rules,
+			Name:   serverClusterRoleName(s.Name, namespace),
+			Labels: componentLabels(serverApp, s.Name),
 		},
+		Rules: rules,
 	}
 	return clusterRole
 }
 
-func (r *SpireServerReconciler) spireRoleDeployment(namespace string) *rbacv1.Role {
+func (r *SpireServerReconciler) spireRoleDeployment(s *spirev1.SpireServer, namespace string) *rbacv1.Role {
 	rules := rbacv1.PolicyRule{
 		Verbs:     []string{"patch", "get", "list"},
 		Resources: []string{"configmaps"},
@@ -261,34 +447,34 @@ func (r *SpireServerReconciler) spireRoleDeployment(namespace string) *rbacv1.Ro
 			APIVersion: "rbac.authorization.k8s.io/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "spire-server-configmap-role",
+			Name:      serverRoleName(s.Name),
 			Namespace: namespace,
+			Labels:    componentLabels(serverApp, s.Name),
 		},
-		Rules: []rbacv1.PolicyRule{
-			rules,
-		},
+		Rules: append([]rbacv1.PolicyRule{rules}, upstreamAuthorityRules(s)...),
 	}
 	return serverRole
 }
 
-func (r *SpireServerReconciler) spireBundleDeployment(namespace string) *corev1.ConfigMap {
+func (r *SpireServerReconciler) spireBundleDeployment(s *spirev1.SpireServer, namespace string) *corev1.ConfigMap {
 	bundle := &corev1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ConfigMap",
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "spire-bundle",
+			Name:      serverBundleName(s.Name),
 			Namespace: namespace,
+			Labels:    componentLabels(serverApp, s.Name),
 		},
 	}
 	return bundle
 }
 
-func (r *SpireServerReconciler) spireStatefulSetDeployment(replicas int, namespace string) *appsv1.StatefulSet {
+func (r *SpireServerReconciler) spireStatefulSetDeployment(s *spirev1.SpireServer, namespace string) *appsv1.StatefulSet {
 	// need to pass in the user desired specs like number of replicas, desired Vols to be mounted, probings,etc.. here
-	var numReplicas int32 = int32(replicas)
-	labelSelector := metav1.LabelSelector{MatchLabels: map[string]string{"app": "spire-server"}}
+	var numReplicas int32 = int32(s.Spec.Replicas)
+	labelSelector := metav1.LabelSelector{MatchLabels: selectorLabels(serverApp, s.Name)}
 	volMount1 := corev1.VolumeMount{
 		Name:      "spire-config",
 		MountPath: "/run/spire/config",
@@ -303,6 +489,7 @@ func (r *SpireServerReconciler) spireStatefulSetDeployment(replicas int, namespa
 		ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
 			Path: "/live", Port: intstr.IntOrString{IntVal: 8080}}},
 		FailureThreshold:    2,
+		SuccessThreshold:    1,
 		InitialDelaySeconds: 15,
 		PeriodSeconds:       60,
 		TimeoutSeconds:      3,
@@ -311,44 +498,90 @@ func (r *SpireServerReconciler) spireStatefulSetDeployment(replicas int, namespa
 		ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
 			Path: "/ready", Port: intstr.IntOrString{IntVal: 8080}}},
 		InitialDelaySeconds: 5,
+		TimeoutSeconds:      1,
 		PeriodSeconds:       5,
+		SuccessThreshold:    1,
+		FailureThreshold:    3,
 	}
 	podVolume := corev1.Volume{
 		Name: "spire-config",
 		VolumeSource: corev1.VolumeSource{
 			ConfigMap: &corev1.ConfigMapVolumeSource{
-				LocalObjectReference: corev1.LocalObjectReference{Name: "spire-config-map"},
+				LocalObjectReference: corev1.LocalObjectReference{Name: serverConfigMapName(s.Name)},
 			},
 		},
 	}
+	tlsVolumes, tlsMounts := dataStoreVolumes(s)
+	upstreamVolumes, upstreamMounts := upstreamAuthorityVolumes(s)
+	attestorVolumes, attestorMounts := nodeAttestorVolumes(s)
+	args := []string{"-config", "/run/spire/config/server.conf"}
+	env := append(append(dataStoreEnv(s), keyManagerEnvVars(s)...), nodeAttestorEnvVars(s)...)
+	if referencesEnv(env) {
+		// the configuration is only expanded when some value is read from
+		// the environment. Datastore connection strings containing $ are
+		// passed through it themselves so that the expansion leaves them as
+		// written
+		args = append(args, "-expandEnv")
+	}
 	containerSpec := corev1.Container{
-		Name:           "spire-server",
-		Image:          "ghcr.io/spiffe/spire-server:1.5.1",
-		Args:           []string{"-config", "/run/spire/config/server.conf"},
-		Ports:          []corev1.ContainerPort{{ContainerPort: 8081}},
-		VolumeMounts:   []corev1.VolumeMount{volMount1, volMount2},
-		LivenessProbe:  &livenessProbe,
-		ReadinessProbe: &readinessProbe,
+		Name:            "spire-server",
+		Image:           r.Images.serverImage(s.Spec.Image, s.Spec.Version),
+		ImagePullPolicy: s.Spec.ImagePullPolicy,
+		Args:            args,
+		Env:             env,
+		Ports:           []corev1.ContainerPort{{Name: "grpc", ContainerPort: int32(s.Spec.Port)}},
+		Resources:       s.Spec.Resources,
+		VolumeMounts:    append(append(append([]corev1.VolumeMount{volMount1, volMount2}, tlsMounts...), upstreamMounts...), attestorMounts...),
+		LivenessProbe:   &livenessProbe,
+		ReadinessProbe:  &readinessProbe,
+	}
+	var initContainers []corev1.Container
+	if s.Spec.ManagedDataStore != nil {
+		initContainers = append(initContainers, corev1.Container{
+			Name:            "wait-for-datastore",
+			Image:           r.Images.initImage(),
+			ImagePullPolicy: s.Spec.ImagePullPolicy,
+			Args:            []string{"-t", "30", managedDataStoreAddress(s, namespace)},
+		})
 	}
 	podSpec := corev1.PodSpec{
-		ServiceAccountName: "spire-server",
+		ServiceAccountName: serverServiceAccountName(s.Name),
+		ImagePullSecrets:   s.Spec.ImagePullSecrets,
+		InitContainers:     initContainers,
 		Containers:         []corev1.Container{containerSpec},
-		Volumes:            []corev1.Volume{podVolume},
-	}
-
-	volClaimTemplate := corev1.PersistentVolumeClaim{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "spire-data",
-			Namespace: namespace,
-		},
-		Spec: corev1.PersistentVolumeClaimSpec{
-			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
-			Resources: corev1.ResourceRequirements{
-				Requests: map[corev1.ResourceName]resource.Quantity{
-					corev1.ResourceStorage: resource.MustParse("1Gi"),
+		Volumes:            append(append(append([]corev1.Volume{podVolume}, tlsVolumes...), upstreamVolumes...), attestorVolumes...),
+	}
+	schedulePods(&podSpec, s.Spec.PodScheduling, selectorLabels(serverApp, s.Name))
+
+	storage := s.Spec.Storage
+	if storage == nil {
+		// the spec has not been through the defaulting webhook
+		defaulted := s.DeepCopy()
+		defaulted.Default()
+		storage = defaulted.Spec.Storage
+	}
+	var volClaimTemplates []corev1.PersistentVolumeClaim
+	if storage.EmptyDir != nil {
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name:         "spire-data",
+			VolumeSource: corev1.VolumeSource{EmptyDir: storage.EmptyDir},
+		})
+	} else {
+		volClaimTemplates = append(volClaimTemplates, corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "spire-data",
+				Namespace: namespace,
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      storage.AccessModes,
+				StorageClassName: storage.StorageClassName,
+				Resources: corev1.ResourceRequirements{
+					Requests: map[corev1.ResourceName]resource.Quantity{
+						corev1.ResourceStorage: *storage.Size,
+					},
 				},
 			},
-		},
+		})
 	}
 	statefulSetSpec := appsv1.StatefulSetSpec{
 		Replicas: &numReplicas,
@@ -356,11 +589,11 @@ func (r *SpireServerReconciler) spireStatefulSetDeployment(replicas int, namespa
 		Template: corev1.PodTemplateSpec{
 			ObjectMeta: metav1.ObjectMeta{
 				Namespace: namespace,
-				Labels:    map[string]string{"app": "spire-server"},
+				Labels:    componentLabels(serverApp, s.Name),
 			},
 			Spec: podSpec,
 		},
-		VolumeClaimTemplates: []corev1.PersistentVolumeClaim{volClaimTemplate},
+		VolumeClaimTemplates: volClaimTemplates,
 	}
 	spireStatefulSet := &appsv1.StatefulSet{
 		TypeMeta: metav1.TypeMeta{
@@ -368,21 +601,22 @@ func (r *SpireServerReconciler) spireStatefulSetDeployment(replicas int, namespa
 			APIVersion: "apps/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "spire-server",
+			Name:      s.Name,
 			Namespace: namespace,
-			Labels:    map[string]string{"app": "spire-server"},
+			Labels:    componentLabels(serverApp, s.Name),
 		},
 		Spec: statefulSetSpec,
 	}
 	return spireStatefulSet
 }
 
-func (r *SpireServerReconciler) spireServiceDeployment(port int, namespace string) *corev1.Service {
+func (r *SpireServerReconciler) spireServiceDeployment(s *spirev1.SpireServer, namespace string) *corev1.Service {
 	// need to pass in the user desired specs like port type,ports,selectors here
+	port := s.Spec.Port
 	serviceSpec := corev1.ServiceSpec{
 		Type:     corev1.ServiceType("NodePort"),
-		Ports:    []corev1.ServicePort{{Name: "grpc", Port: int32(port), Protocol: corev1.Protocol("TCP")}},
-		Selector: map[string]string{"app": "spire-server"},
+		Ports:    []corev1.ServicePort{{Name: "grpc", Port: int32(port), TargetPort: intstr.FromInt(port), Protocol: corev1.Protocol("TCP")}},
+		Selector: selectorLabels(serverApp, s.Name),
 	}
 	spireService := &corev1.Service{
 		TypeMeta: metav1.TypeMeta{
@@ -390,8 +624,9 @@ func (r *SpireServerReconciler) spireServiceDeployment(port int, namespace strin
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "spire-service",
+			Name:      s.Name,
 			Namespace: namespace,
+			Labels:    componentLabels(serverApp, s.Name),
 		},
 		Spec: serviceSpec,
 	}
@@ -399,37 +634,23 @@ func (r *SpireServerReconciler) spireServiceDeployment(port int, namespace strin
 }
 
 // CreateServiceAccount creates a service account for the SPIRE server.
-func (r *SpireServerReconciler) createServiceAccount(namespace string) *corev1.ServiceAccount {
+func (r *SpireServerReconciler) createServiceAccount(s *spirev1.SpireServer, namespace string) *corev1.ServiceAccount {
 	serviceAccount := &corev1.ServiceAccount{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ServiceAccount",
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "spire-server",
+			Name:      serverServiceAccountName(s.Name),
 			Namespace: namespace,
+			Labels:    componentLabels(serverApp, s.Name),
 		},
 	}
 	return serviceAccount
 }
 
-func (r *SpireServerReconciler) spireConfigMapDeployment(s *spirev1.SpireServer, namespace string) *corev1.ConfigMap {
-	nodeAttestorsConfig := ""
-
-	for _, nodeAttestor := range s.Spec.NodeAttestors {
-		if strings.Compare(string(nodeAttestor.Name), "join_token") == 0 {
-			nodeAttestorsConfig += joinTokenNodeAttestor()
-		} else if strings.Compare(string(nodeAttestor.Name), "k8s_sat") == 0 {
-			nodeAttestorsConfig += k8sSatNodeAttestor(namespace)
-		} else if strings.Compare(string(nodeAttestor.Name), "k8s_psat") == 0 {
-			nodeAttestorsConfig += k8sPsatNodeAttestor(namespace)
-		}
-	}
-
-	config := serverCreation(strconv.Itoa(s.Spec.Port), s.Spec.TrustDomain) +
-		plugins(nodeAttestorsConfig, s.Spec.KeyStorage, namespace, s.Spec.DataStore, s.Spec.ConnectionString) +
-		healthChecks()
-
+func (r *SpireServerReconciler) spireConfigMapDeployment(s *spirev1.SpireServer, namespace string,
+	agentServiceAccounts []string) *corev1.ConfigMap {
 	configMap := &corev1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ConfigMap",
@@ -437,166 +658,238 @@ func (r *SpireServerReconciler) spireConfigMapDeployment(s *spirev1.SpireServer,
 		},
 
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "spire-config-map",
+			Name:      serverConfigMapName(s.Name),
 			Namespace: namespace,
+			Labels:    componentLabels(serverApp, s.Name),
 		},
 
 		Data: map[string]string{
-			"server.conf": config,
+			"server.conf": serverConfig(s, namespace, agentServiceAccounts).Render(),
 		},
 	}
 
 	return configMap
 }
 
-func k8sSatNodeAttestor(namespace string) string {
-	return `
+// serverConfig models the server.conf of a SPIRE server deployed in namespace
+// and trusting the given agent service accounts.
+func serverConfig(s *spirev1.SpireServer, namespace string, agentServiceAccounts []string) spireconfig.ServerConfig {
+	allowList := serviceAccountAllowList(agentServiceAccounts)
 
-	NodeAttestor "k8s_sat" {
-		plugin_data {
-			clusters = {
-				"demo-cluster" = {
-					use_token_review_api_validation = true
-					service_account_allow_list = ["` + namespace + `:spire-agent"]
-				}
-			}
+	plugins := []spireconfig.Plugin{sqlDataStore(s)}
+
+	for _, nodeAttestor := range s.Spec.NodeAttestors {
+		switch nodeAttestor.Name {
+		case "join_token":
+			plugins = append(plugins, joinTokenNodeAttestor())
+		case "k8s_sat":
+			plugins = append(plugins, k8sSatNodeAttestor(s.NodeAttestor(nodeAttestor.Name).Kubernetes, allowList))
+		case "k8s_psat":
+			plugins = append(plugins, k8sPsatNodeAttestor(s.NodeAttestor(nodeAttestor.Name).Kubernetes, allowList))
+		case "x509pop":
+			plugins = append(plugins, x509popNodeAttestor())
+		case "tpm_devid":
+			plugins = append(plugins, tpmDevIDNodeAttestor())
+		case "aws_iid":
+			plugins = append(plugins, awsIIDNodeAttestor(nodeAttestor.AWSIID))
+		case "gcp_iit":
+			plugins = append(plugins, gcpIITNodeAttestor(nodeAttestor.GCPIIT))
+		case "azure_msi":
+			plugins = append(plugins, azureMSINodeAttestor(s.NodeAttestor(nodeAttestor.Name).AzureMSI))
 		}
-	}`
-}
+	}
 
-func k8sPsatNodeAttestor(namespace string) string {
-	return `
+	plugins = append(plugins, serverKeyManager(s))
+	if upstream := upstreamAuthority(s, namespace); upstream != nil {
+		plugins = append(plugins, *upstream)
+	}
+	plugins = append(plugins, spireconfig.Plugin{
+		Type: "Notifier",
+		Name: "k8sbundle",
+		Data: spireconfig.Data{
+			"namespace":  namespace,
+			"config_map": serverBundleName(s.Name),
+		},
+	})
+
+	ca := s.Spec.CA
+	if ca == nil || ca.KeyType == "" || ca.Subject == nil {
+		// the spec has not been through the defaulting webhook
+		defaulted := s.DeepCopy()
+		defaulted.Default()
+		ca = defaulted.Spec.CA
+	}
+
+	return spireconfig.ServerConfig{
+		Server: spireconfig.Server{
+			BindAddress: "0.0.0.0",
+			BindPort:    s.Spec.Port,
+			SocketPath:  "/tmp/spire-server/private/api.sock",
+			TrustDomain: s.Spec.TrustDomain,
+			DataDir:     "/run/spire/data",
+			LogLevel:    "DEBUG",
+			CAKeyType:   ca.KeyType,
+			CASubject: &spireconfig.CASubject{
+				Country:      ca.Subject.Country,
+				Organization: ca.Subject.Organization,
+				CommonName:   ca.Subject.CommonName,
+			},
+			CATTL:              durationString(ca.TTL),
+			DefaultX509SVIDTTL: durationString(ca.X509SVIDTTL),
+			DefaultJWTSVIDTTL:  durationString(ca.JWTSVIDTTL),
+			JWTIssuer:          ca.JWTIssuer,
+		},
+		Plugins:      plugins,
+		HealthChecks: healthChecks(),
+	}
+}
 
-	NodeAttestor "k8s_psat" {
-		plugin_data {
-			clusters = {
-				"cluster" = {
-					service_account_allow_list = ["` + namespace + `:spire-agent"]
-				}
-			}
-		}
-	}`
+// durationString formats an optional duration of the spec for SPIRE, which
+// leaves empty durations to its defaults.
+func durationString(d *metav1.Duration) string {
+	if d == nil {
+		return ""
+	}
+	return d.Duration.String()
 }
 
-func joinTokenNodeAttestor() string {
-	return `
+// serviceAccountAllowList sorts the service accounts of the SPIRE agents
+// referencing the server for the allow list of the Kubernetes node attestors.
+func serviceAccountAllowList(agentServiceAccounts []string) []string {
+	serviceAccounts := append([]string{}, agentServiceAccounts...)
+	sort.Strings(serviceAccounts)
 
-	NodeAttestor "join_token" {
-		plugin_data {
+	return serviceAccounts
+}
 
+// clusterAllowList adds the service accounts allowed by the settings of a
+// Kubernetes node attestor to those of the SPIRE agents.
+func clusterAllowList(settings *spirev1.KubernetesNodeAttestor, allowList []string) []string {
+	if len(settings.ServiceAccountAllowList) == 0 {
+		return allowList
+	}
+
+	seen := map[string]bool{}
+	var serviceAccounts []string
+	for _, serviceAccount := range append(append([]string{}, allowList...), settings.ServiceAccountAllowList...) {
+		if !seen[serviceAccount] {
+			seen[serviceAccount] = true
+			serviceAccounts = append(serviceAccounts, serviceAccount)
 		}
-	}`
+	}
+
+	return serviceAccountAllowList(serviceAccounts)
 }
 
-func serverCreation(bindingPort string, trustDomain string) string {
-	return `
-	server {
-		bind_address = "0.0.0.0"
-		bind_port = "` + bindingPort + `"
-		socket_path = "/tmp/spire-server/private/api.sock"
-		trust_domain = "` + trustDomain + `"
-		data_dir = "/run/spire/data"
-		log_level = "DEBUG"
-		ca_key_type = "rsa-2048"
-	
-		ca_subject = {
-			country = ["US"],
-			organization = ["SPIFFE"],
-			common_name = "",
-		}
-	}`
+func k8sSatNodeAttestor(settings *spirev1.KubernetesNodeAttestor, allowList []string) spireconfig.Plugin {
+	return spireconfig.Plugin{
+		Type: "NodeAttestor",
+		Name: "k8s_sat",
+		Data: spireconfig.Data{
+			"clusters": spireconfig.Data{
+				settings.Cluster: spireconfig.Data{
+					"use_token_review_api_validation": true,
+					"service_account_allow_list":      clusterAllowList(settings, allowList),
+				},
+			},
+		},
+	}
 }
 
-func plugins(nodeAttestorsConfig string, keyStorage string, namespace string, datastore string, connectionString string) string {
-	return `
+func k8sPsatNodeAttestor(settings *spirev1.KubernetesNodeAttestor, allowList []string) spireconfig.Plugin {
+	cluster := spireconfig.Data{
+		"service_account_allow_list": clusterAllowList(settings, allowList),
+		"audience":                   settings.Audience,
+	}
+	if len(settings.AllowedNodeLabelKeys) > 0 {
+		cluster["allowed_node_label_keys"] = settings.AllowedNodeLabelKeys
+	}
+	if len(settings.AllowedPodLabelKeys) > 0 {
+		cluster["allowed_pod_label_keys"] = settings.AllowedPodLabelKeys
+	}
 
-	plugins {
-		DataStore "sql" {
-			plugin_data {
-			  database_type = "` + datastore + `"
-			  connection_string = "` + connectionString + `"
-			}
-		}` +
-		nodeAttestorsConfig + `
-	
-		KeyManager "` + keyStorage + `" {
-			plugin_data {
-				keys_path = "/run/spire/data/keys.json"
-			}
-		}
-	
-		Notifier "k8sbundle" {
-			plugin_data {
-				namespace = "` + namespace + `"
-			}
-		}
-	}`
+	return spireconfig.Plugin{
+		Type: "NodeAttestor",
+		Name: "k8s_psat",
+		Data: spireconfig.Data{
+			"clusters": spireconfig.Data{settings.Cluster: cluster},
+		},
+	}
 }
 
-func healthChecks() string {
-	return `
+func joinTokenNodeAttestor() spireconfig.Plugin {
+	return spireconfig.Plugin{Type: "NodeAttestor", Name: "join_token"}
+}
 
-health_checks {
-	listener_enabled = true
-	bind_address = "0.0.0.0"
-	bind_port = "8080"
-	live_path = "/live"
-	ready_path = "/ready"
-}`
+// healthChecks is the health_checks block of both SPIRE servers and agents,
+// matching the probes of their containers.
+func healthChecks() spireconfig.HealthChecks {
+	return spireconfig.HealthChecks{
+		ListenerEnabled: true,
+		BindAddress:     "0.0.0.0",
+		BindPort:        8080,
+		LivePath:        "/live",
+		ReadyPath:       "/ready",
+	}
 }
 
+// healthCheck evaluates the health of the SPIRE server pods once and asks for
+// the SPIRE server to be reconciled again after a delay. Changes to the pods
+// trigger a reconcile on their own, so the delay only bounds how stale the
+// health can get. The status is updated in memory only.
 func healthCheck(r *SpireServerReconciler, ctx context.Context, s *spirev1.SpireServer,
 	statefulSet *appsv1.StatefulSet) (ctrl.Result, error) {
-	quit := make(chan bool, 1)
-
-	ticker := time.NewTicker(5 * time.Second)
 	var podList corev1.PodList
 
-	for {
-		select {
-		case <-quit:
-			ticker.Stop()
-			return ctrl.Result{}, nil
+	if err := r.List(ctx, &podList, client.InNamespace(statefulSet.Namespace),
+		client.MatchingLabels(statefulSet.Spec.Selector.MatchLabels)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	statCount := make(map[string]int)
+
+	for _, pod := range podList.Items {
+		valid := false
 
-		case <-ticker.C:
-			statCount := make(map[string]int)
+		for _, condition := range pod.Status.Conditions {
+			if condition.Status == "True" {
+				valid = true
+				updateStatusMap(statCount, condition.Type)
 
-			if err := r.List(ctx, &podList); err != nil {
-				return ctrl.Result{}, err
+				if condition.Type == "Ready" {
+					break
+				}
 			}
+		}
 
-			for _, pod := range podList.Items {
-				valid := false
+		if !valid {
+			statCount["err"]++
+		}
+	}
 
-				if strings.Contains(pod.Name, statefulSet.Name) {
-					for _, condition := range pod.Status.Conditions {
-						if condition.Status == "True" {
-							valid = true
-							updateStatusMap(statCount, condition.Type)
+	replicas := int(*statefulSet.Spec.Replicas)
+	updateHealth(statCount, s, replicas)
 
-							if condition.Type == "Ready" {
-								break
-							}
-						}
-					}
+	liveStatefulSet := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(statefulSet), liveStatefulSet); err != nil {
+		return ctrl.Result{}, err
+	}
 
-					if !valid {
-						statCount["err"]++
-					}
-				}
-			}
+	workload := statefulSetStatus(liveStatefulSet, statefulSet)
+	workload.failing = s.Status.Health == "ERROR"
 
-			replicas := int(*statefulSet.Spec.Replicas)
-			err := updateHealth(statCount, s, replicas, ctx, r)
+	s.Status.Replicas = workload.desired
+	s.Status.ReadyReplicas = workload.ready
+	setWorkloadConditions(&s.Status.Conditions, s.Generation, workload)
 
-			if err != nil {
-				return ctrl.Result{}, err
-			}
-		}
+	if s.Status.Health == "READY" {
+		return ctrl.Result{RequeueAfter: readyHealthCheckInterval}, nil
 	}
+
+	return ctrl.Result{RequeueAfter: healthCheckInterval}, nil
 }
 
-func updateHealth(statCount map[string]int, s *spirev1.SpireServer, replicas int, ctx context.Context, r *SpireServerReconciler) error {
+func updateHealth(statCount map[string]int, s *spirev1.SpireServer, replicas int) {
 	if statCount["err"] > 0 {
 		s.Status.Health = "ERROR"
 	} else if statCount["ready"] == replicas {
@@ -606,12 +899,6 @@ func updateHealth(statCount map[string]int, s *spirev1.SpireServer, replicas int
 	} else {
 		s.Status.Health = "INITIALIZING"
 	}
-
-	if err := r.Status().Update(ctx, s); err != nil {
-		return err
-	}
-
-	return nil
 }
 
 func updateStatusMap(statCount map[string]int, podConditionType corev1.PodConditionType) {
@@ -628,5 +915,40 @@ func updateStatusMap(statCount map[string]int, podConditionType corev1.PodCondit
 func (r *SpireServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&spirev1.SpireServer{}).
+		Owns(&corev1.ServiceAccount{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&corev1.Service{}).
+		Owns(&rbacv1.Role{}).
+		Owns(&rbacv1.RoleBinding{}).
+		Owns(&appsv1.StatefulSet{}).
+		// the cache only holds the pods generated by the operator, see
+		// CacheOptions
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(spireServersForPod)).
+		Watches(&spirev1.SpireAgent{}, handler.EnqueueRequestsFromMapFunc(spireServerForAgent)).
 		Complete(r)
 }
+
+// spireServerForAgent maps a SPIRE agent to the SPIRE server it references so
+// that the server allows agents from a new namespace.
+func spireServerForAgent(ctx context.Context, agent client.Object) []reconcile.Request {
+	a, ok := agent.(*spirev1.SpireAgent)
+	if !ok {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: a.ServerKey()}}
+}
+
+// spireServersForPod maps a SPIRE server pod to the SpireServer it runs so
+// that its health is refreshed when the pod changes.
+func spireServersForPod(ctx context.Context, pod client.Object) []reconcile.Request {
+	labels := pod.GetLabels()
+	if labels[nameLabel] != serverApp || labels[instanceLabel] == "" {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{
+		Name:      labels[instanceLabel],
+		Namespace: pod.GetNamespace(),
+	}}}
+}
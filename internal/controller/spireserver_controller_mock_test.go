@@ -4,12 +4,22 @@ import (
 	"context"
 	"testing"
 
-	// "sigs.k8s.io/controller-runtime/pkg/client/fake"
 	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
 	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 var reconciler = &SpireServerReconciler{
@@ -65,15 +75,15 @@ func createSpireServer(trustDomain string, port int, nodeAttestors []spirev1.Nod
 func TestSpireserverController(t *testing.T) {
 	spireserver := &spirev1.SpireServer{}
 	spireServiceNamespace := "test-namespace"
-	spireServiceAccount := reconciler.createServiceAccount(spireServiceNamespace)
-	bundle := reconciler.spireBundleDeployment(spireServiceNamespace)
-	roles := reconciler.spireRoleDeployment(spireServiceNamespace)
-	roleBinding := reconciler.spireRoleBindingDeployment(spireServiceNamespace)
-	clusterRoles := reconciler.spireClusterRoleDeployment(spireServiceNamespace)
-	clusterRoleBinding := reconciler.spireClusterRoleBindingDeployment(spireServiceNamespace)
-	serverConfigMap := reconciler.spireConfigMapDeployment(spireserver, spireServiceNamespace)
-	spireStatefulSet := reconciler.spireStatefulSetDeployment(2, spireServiceNamespace)
-	spireService := reconciler.spireServiceDeployment(8081, spireServiceNamespace)
+	spireServiceAccount := reconciler.createServiceAccount(spireserver, spireServiceNamespace)
+	bundle := reconciler.spireBundleDeployment(spireserver, spireServiceNamespace)
+	roles := reconciler.spireRoleDeployment(spireserver, spireServiceNamespace)
+	roleBinding := reconciler.spireRoleBindingDeployment(spireserver, spireServiceNamespace)
+	clusterRoles := reconciler.spireClusterRoleDeployment(spireserver, spireServiceNamespace)
+	clusterRoleBinding := reconciler.spireClusterRoleBindingDeployment(spireserver, spireServiceNamespace)
+	serverConfigMap := reconciler.spireConfigMapDeployment(spireserver, spireServiceNamespace, nil)
+	spireStatefulSet := reconciler.spireStatefulSetDeployment(spireserver, spireServiceNamespace)
+	spireService := reconciler.spireServiceDeployment(spireserver, spireServiceNamespace)
 
 	// Call the method you want to test
 	// Assert the expected behavior
@@ -108,83 +118,83 @@ func TestSpireserverController(t *testing.T) {
 }
 
 func TestValidNameSpaceConfigMap(t *testing.T) {
-	configMap := reconciler.spireConfigMapDeployment(mockSpireServer, "default")
+	configMap := reconciler.spireConfigMapDeployment(mockSpireServer, "default", nil)
 	assert.Equal(t, configMap.Namespace, "default", "Namespaces should be the same.")
 }
 
 func TestInvalidNameSpaceConfigMap(t *testing.T) {
-	configMap := reconciler.spireConfigMapDeployment(mockSpireServer, "namespace1")
+	configMap := reconciler.spireConfigMapDeployment(mockSpireServer, "namespace1", nil)
 	assert.NotEqual(t, configMap.Namespace, "namespace2", "Namespaces should not be the same.")
 }
 
 func TestEmptyNameSpaceConfigMap(t *testing.T) {
-	configMap := reconciler.spireConfigMapDeployment(mockSpireServer, "")
+	configMap := reconciler.spireConfigMapDeployment(mockSpireServer, "", nil)
 	assert.Equal(t, configMap.Namespace, "", "Namespace should be empty.")
 }
 
 func TestValidConfigMapSingleAttestor(t *testing.T) {
-	configMap := reconciler.spireConfigMapDeployment(mockSpireServer, "default")
+	configMap := reconciler.spireConfigMapDeployment(mockSpireServer, "default", nil)
 
 	assert.Contains(t, configMap.Data["server.conf"], "NodeAttestor \"k8s_sat\"")
 
 	assert.Contains(t, configMap.Data["server.conf"], "trust_domain = \"example.org\"")
-	assert.Contains(t, configMap.Data["server.conf"], "bind_port = \"8081\"")
+	assert.Contains(t, configMap.Data["server.conf"], "bind_port = 8081")
 	assert.Contains(t, configMap.Data["server.conf"], "KeyManager \"disk\"")
 }
 
 func TestValidConfigMapMultipleAttestors(t *testing.T) {
 	mockSpireServer2 := createSpireServer("example.org", 8081, []spirev1.NodeAttestor{{Name: "k8s_sat"}, {Name: "join_token"}, {Name: "k8s_psat"}}, "disk", 1)
 
-	configMap := reconciler.spireConfigMapDeployment(mockSpireServer2, "default")
+	configMap := reconciler.spireConfigMapDeployment(mockSpireServer2, "default", nil)
 
 	assert.Contains(t, configMap.Data["server.conf"], "NodeAttestor \"k8s_sat\"")
 	assert.Contains(t, configMap.Data["server.conf"], "NodeAttestor \"join_token\"")
 	assert.Contains(t, configMap.Data["server.conf"], "NodeAttestor \"k8s_psat\"")
 
 	assert.Contains(t, configMap.Data["server.conf"], "trust_domain = \"example.org\"")
-	assert.Contains(t, configMap.Data["server.conf"], "bind_port = \"8081\"")
+	assert.Contains(t, configMap.Data["server.conf"], "bind_port = 8081")
 	assert.Contains(t, configMap.Data["server.conf"], "KeyManager \"disk\"")
 }
 
 func TestValidNameSpaceServiceAccount(t *testing.T) {
 	spireServiceNamespace := "sameNameSpace"
-	serviceAccount := reconciler.createServiceAccount(spireServiceNamespace)
+	serviceAccount := reconciler.createServiceAccount(mockSpireServer, spireServiceNamespace)
 	assert.Equal(t, serviceAccount.Namespace, spireServiceNamespace, "Namespaces should be the same.")
 }
 
 func TestInvalidNameSpaceServiceAccount(t *testing.T) {
 	spireServiceNamespace := "namespace1"
-	serviceAccount := reconciler.createServiceAccount("namespace2")
+	serviceAccount := reconciler.createServiceAccount(mockSpireServer, "namespace2")
 	assert.NotEqual(t, serviceAccount.Namespace, spireServiceNamespace, "Namespaces should not be the same.")
 }
 
 func TestEmptyNameSpaceServiceAccount(t *testing.T) {
-	serviceAccount := reconciler.createServiceAccount("")
+	serviceAccount := reconciler.createServiceAccount(mockSpireServer, "")
 	assert.Equal(t, serviceAccount.Namespace, "", "Namespaces should be empty.")
 }
 
 func TestValidTrustBundle(t *testing.T) {
 	spireServiceNamespace := "sameNameSpace"
-	bundle := reconciler.spireBundleDeployment(spireServiceNamespace)
+	bundle := reconciler.spireBundleDeployment(mockSpireServer, spireServiceNamespace)
 	assert.Equal(t, bundle.Namespace, spireServiceNamespace, "Namespaces should be the same.")
 }
 
 func TestInvalidNameSpaceTrustBundle(t *testing.T) {
 	spireServiceNamespace := "namespace1"
-	bundle := reconciler.spireBundleDeployment("namespace2")
+	bundle := reconciler.spireBundleDeployment(mockSpireServer, "namespace2")
 	assert.NotEqual(t, bundle.Namespace, spireServiceNamespace, "Namespaces should not be the same.")
 }
 
 func TestEmptyNameSpaceTrustBundle(t *testing.T) {
-	bundle := reconciler.spireBundleDeployment("")
+	bundle := reconciler.spireBundleDeployment(mockSpireServer, "")
 	assert.Equal(t, bundle.Namespace, "", "Namespaces should be empty.")
 }
 
 func TestValidNameSpaceRoles(t *testing.T) {
-	roles := reconciler.spireRoleDeployment("default")
+	roles := reconciler.spireRoleDeployment(mockSpireServer, "default")
 	assert.Equal(t, roles.Namespace, "default")
 	assert.Equal(t, roles.Kind, "Role")
-	assert.Equal(t, roles.Name, "spire-server-configmap-role")
+	assert.Equal(t, roles.Name, "valid-spire-server-configmap-role")
 	assert.Equal(t, roles.APIVersion, "rbac.authorization.k8s.io/v1")
 	assert.Equal(t, roles.Rules[0].Verbs, []string{"patch", "get", "list"})
 	assert.Equal(t, roles.Rules[0].Resources, []string{"configmaps"})
@@ -192,79 +202,709 @@ func TestValidNameSpaceRoles(t *testing.T) {
 }
 
 func TestInvalidNameSpaceRoles(t *testing.T) {
-	roles := reconciler.spireRoleDeployment("default1")
+	roles := reconciler.spireRoleDeployment(mockSpireServer, "default1")
 	assert.NotEqual(t, roles.Namespace, "default2")
 }
 
 func TestEmptyNameSpaceRoles(t *testing.T) {
-	roles := reconciler.spireRoleDeployment("")
+	roles := reconciler.spireRoleDeployment(mockSpireServer, "")
 	assert.Equal(t, roles.Namespace, "")
 }
 
 func TestValidNameSpaceRoleBinding(t *testing.T) {
-	roleBinding := reconciler.spireRoleBindingDeployment("default")
+	roleBinding := reconciler.spireRoleBindingDeployment(mockSpireServer, "default")
 	assert.Equal(t, roleBinding.Namespace, "default")
 	assert.Equal(t, roleBinding.Kind, "RoleBinding")
 	assert.Equal(t, roleBinding.APIVersion, "rbac.authorization.k8s.io/v1")
-	assert.Equal(t, roleBinding.Name, "spire-server-configmap-role-binding")
+	assert.Equal(t, roleBinding.Name, "valid-spire-server-configmap-role-binding")
 	assert.Equal(t, roleBinding.RoleRef.Kind, "Role")
-	assert.Equal(t, roleBinding.RoleRef.Name, "spire-server-configmap-role")
+	assert.Equal(t, roleBinding.RoleRef.Name, "valid-spire-server-configmap-role")
 	assert.Equal(t, roleBinding.RoleRef.APIGroup, "rbac.authorization.k8s.io")
 	assert.Equal(t, roleBinding.Subjects[0].Kind, "ServiceAccount")
-	assert.Equal(t, roleBinding.Subjects[0].Name, "spire-server")
+	assert.Equal(t, roleBinding.Subjects[0].Name, "valid-spire-server-server")
 	assert.Equal(t, roleBinding.Subjects[0].Namespace, "default")
 }
 
 func TestInvalidNameSpaceRoleBinding(t *testing.T) {
-	roleBinding := reconciler.spireRoleBindingDeployment("default1")
+	roleBinding := reconciler.spireRoleBindingDeployment(mockSpireServer, "default1")
 	assert.NotEqual(t, roleBinding.Namespace, "default2")
 }
 
 func TestEmptyNameSpaceRoleBinding(t *testing.T) {
-	roleBinding := reconciler.spireRoleBindingDeployment("")
+	roleBinding := reconciler.spireRoleBindingDeployment(mockSpireServer, "")
 	assert.Equal(t, roleBinding.Namespace, "")
 }
 
 func TestValidNameSpaceClusterRoles(t *testing.T) {
-	clusterRoles := reconciler.spireClusterRoleDeployment("default")
+	clusterRoles := reconciler.spireClusterRoleDeployment(mockSpireServer, "default")
 	assert.Equal(t, clusterRoles.Namespace, "")
 	assert.Equal(t, clusterRoles.Kind, "ClusterRole")
-	assert.Equal(t, clusterRoles.Name, "spire-server-trust-role")
+	assert.Equal(t, clusterRoles.Name, "valid-spire-server-trust-role-default")
 	assert.Equal(t, clusterRoles.APIVersion, "rbac.authorization.k8s.io/v1")
 	assert.Equal(t, clusterRoles.Rules[0].Verbs, []string{"create"})
 	assert.Equal(t, clusterRoles.Rules[0].Resources, []string{"tokenreviews"})
 	assert.Equal(t, clusterRoles.Rules[0].APIGroups, []string{"authentication.k8s.io"})
 }
 
+func TestClusterRoleLetsPsatReadAgentPods(t *testing.T) {
+	assert.Len(t, reconciler.spireClusterRoleDeployment(mockSpireServer, "default").Rules, 1)
+
+	server := createSpireServer("example.org", 8081, []spirev1.NodeAttestor{{Name: "k8s_psat"}}, "disk", 1)
+	clusterRole := reconciler.spireClusterRoleDeployment(server, "default")
+	assert.Equal(t, rbacv1.PolicyRule{
+		Verbs:     []string{"get"},
+		Resources: []string{"pods", "nodes"},
+		APIGroups: []string{""},
+	}, clusterRole.Rules[1])
+}
+
 func TestInvalidNameSpaceClusterRoles(t *testing.T) {
-	clusterRoles := reconciler.spireClusterRoleDeployment("default1")
+	clusterRoles := reconciler.spireClusterRoleDeployment(mockSpireServer, "default1")
 	assert.Equal(t, clusterRoles.Namespace, "")
 }
 
 func TestEmptyNameSpaceClusterRoles(t *testing.T) {
-	clusterRoles := reconciler.spireClusterRoleDeployment("")
+	clusterRoles := reconciler.spireClusterRoleDeployment(mockSpireServer, "")
 	assert.Equal(t, clusterRoles.Namespace, "")
 }
 
 func TestValidNameSpaceClusterRoleBinding(t *testing.T) {
-	clusterRoleBinding := reconciler.spireClusterRoleBindingDeployment("default")
+	clusterRoleBinding := reconciler.spireClusterRoleBindingDeployment(mockSpireServer, "default")
 	assert.Equal(t, clusterRoleBinding.Kind, "ClusterRoleBinding")
 	assert.Equal(t, clusterRoleBinding.APIVersion, "rbac.authorization.k8s.io/v1")
-	assert.Equal(t, clusterRoleBinding.Name, "spire-server-trust-role-binding")
+	assert.Equal(t, clusterRoleBinding.Name, "valid-spire-server-trust-role-binding-default")
 	assert.Equal(t, clusterRoleBinding.RoleRef.Kind, "ClusterRole")
-	assert.Equal(t, clusterRoleBinding.RoleRef.Name, "spire-server-trust-role")
+	assert.Equal(t, clusterRoleBinding.RoleRef.Name, "valid-spire-server-trust-role-default")
 	assert.Equal(t, clusterRoleBinding.RoleRef.APIGroup, "rbac.authorization.k8s.io")
 	assert.Equal(t, clusterRoleBinding.Subjects[0].Kind, "ServiceAccount")
-	assert.Equal(t, clusterRoleBinding.Subjects[0].Name, "spire-server")
+	assert.Equal(t, clusterRoleBinding.Subjects[0].Name, "valid-spire-server-server")
 	assert.Equal(t, clusterRoleBinding.Subjects[0].Namespace, "default")
 }
 
 func TestInvalidNameSpaceClusterRoleBinding(t *testing.T) {
-	clusterRoleBinding := reconciler.spireClusterRoleBindingDeployment("default1")
+	clusterRoleBinding := reconciler.spireClusterRoleBindingDeployment(mockSpireServer, "default1")
 	assert.Equal(t, clusterRoleBinding.Namespace, "")
 }
 
 func TestEmptyNameSpaceClusterRoleBinding(t *testing.T) {
-	clusterRoleBinding := reconciler.spireClusterRoleBindingDeployment("")
+	clusterRoleBinding := reconciler.spireClusterRoleBindingDeployment(mockSpireServer, "")
 	assert.Equal(t, clusterRoleBinding.Namespace, "")
 }
+
+func spireServerPod(name string, namespace string, conditions ...corev1.PodConditionType) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    selectorLabels(serverApp, mockSpireServer.Name),
+		},
+	}
+	for _, condition := range conditions {
+		pod.Status.Conditions = append(pod.Status.Conditions, corev1.PodCondition{Type: condition, Status: "True"})
+	}
+	return pod
+}
+
+func TestReconcileRequeuesHealthCheck(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server).WithStatusSubresource(server).Build()
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme}
+
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)})
+	assert.NoError(t, err)
+	assert.Equal(t, healthCheckInterval, result.RequeueAfter)
+
+	reconciled := &spirev1.SpireServer{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), reconciled))
+	assert.Equal(t, "INITIALIZING", reconciled.Status.Health)
+	assert.Equal(t, reconciled.Generation, reconciled.Status.ObservedGeneration)
+	assert.True(t, meta.IsStatusConditionTrue(reconciled.Status.Conditions, spirev1.ConditionConfigValid))
+	assert.True(t, meta.IsStatusConditionFalse(reconciled.Status.Conditions, spirev1.ConditionAvailable))
+	assert.True(t, meta.IsStatusConditionTrue(reconciled.Status.Conditions, spirev1.ConditionProgressing))
+	assert.Contains(t, reconciled.Finalizers, cleanupFinalizer)
+}
+
+func TestReconcileReportsInvalidSpec(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Spec.DataStore = "sqlite3"
+	server.Spec.Replicas = 3
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server).WithStatusSubresource(server).Build()
+	recorder := record.NewFakeRecorder(1)
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme, Recorder: recorder}
+
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)})
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	invalid := &spirev1.SpireServer{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), invalid), "invalid SpireServer should be kept")
+	condition := meta.FindStatusCondition(invalid.Status.Conditions, spirev1.ConditionConfigValid)
+	assert.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, spirev1.ReasonInvalidSpec, condition.Reason)
+	assert.Contains(t, condition.Message, "cannot have more than 1 replica with sqlite3 database")
+	event := <-recorder.Events
+	assert.Contains(t, event, "Warning InvalidSpec")
+	assert.Contains(t, event, "cannot have more than 1 replica with sqlite3 database")
+
+	err = c.Get(ctx, types.NamespacedName{Name: server.Name, Namespace: server.Namespace}, &appsv1.StatefulSet{})
+	assert.True(t, apiErrors.IsNotFound(err), "no child resources should be created for an invalid spec")
+}
+
+func TestHealthCheckReady(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	statefulSet := reconciler.spireStatefulSetDeployment(server, server.Namespace)
+	liveStatefulSet := statefulSet.DeepCopy()
+	liveStatefulSet.Generation = 1
+	liveStatefulSet.Status = appsv1.StatefulSetStatus{ObservedGeneration: 1, Replicas: 1, ReadyReplicas: 1, UpdatedReplicas: 1}
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, liveStatefulSet,
+			spireServerPod("spire-server-0", server.Namespace, corev1.PodScheduled, corev1.PodInitialized, corev1.PodReady),
+			spireServerPod("spire-server-0", "other-namespace")).
+		WithStatusSubresource(server).Build()
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme}
+
+	result, err := healthCheck(r, ctx, server, statefulSet)
+	assert.NoError(t, err)
+	assert.Equal(t, readyHealthCheckInterval, result.RequeueAfter)
+	assert.Equal(t, "READY", server.Status.Health)
+	assert.Equal(t, int32(1), server.Status.Replicas)
+	assert.Equal(t, int32(1), server.Status.ReadyReplicas)
+	assert.True(t, meta.IsStatusConditionTrue(server.Status.Conditions, spirev1.ConditionAvailable))
+	assert.True(t, meta.IsStatusConditionFalse(server.Status.Conditions, spirev1.ConditionProgressing))
+	assert.True(t, meta.IsStatusConditionFalse(server.Status.Conditions, spirev1.ConditionDegraded))
+}
+
+func TestHealthCheckError(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	statefulSet := reconciler.spireStatefulSetDeployment(server, server.Namespace)
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, statefulSet, spireServerPod("spire-server-0", server.Namespace)).
+		WithStatusSubresource(server).Build()
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme}
+
+	result, err := healthCheck(r, ctx, server, statefulSet)
+	assert.NoError(t, err)
+	assert.Equal(t, healthCheckInterval, result.RequeueAfter)
+	assert.Equal(t, "ERROR", server.Status.Health)
+	assert.True(t, meta.IsStatusConditionFalse(server.Status.Conditions, spirev1.ConditionAvailable))
+	assert.True(t, meta.IsStatusConditionTrue(server.Status.Conditions, spirev1.ConditionDegraded))
+}
+
+func TestSpireServersForPod(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+
+	requests := spireServersForPod(ctx, spireServerPod("valid-spire-server-0", server.Namespace))
+	assert.Equal(t, []reconcile.Request{{NamespacedName: client.ObjectKeyFromObject(server)}}, requests)
+
+	requests = spireServersForPod(ctx, spireServerPod("valid-spire-server-0", "other-namespace"))
+	assert.Equal(t, "other-namespace", requests[0].Namespace)
+
+	assert.Empty(t, spireServersForPod(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "client", Namespace: server.Namespace}}))
+	assert.Empty(t, spireServersForPod(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "spire-agent-x", Namespace: server.Namespace,
+		Labels: selectorLabels(agentApp, server.Name)}}))
+}
+
+func TestServerConfigAllowsReferencingAgents(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+		spireAgentFor(server, "workloads"),
+		spireAgentFor(server, "default"),
+		spireAgentFor(&spirev1.SpireServer{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}}, "other"),
+	).Build()
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme}
+
+	agentServiceAccounts, err := r.agentServiceAccounts(ctx, server)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"workloads:spire-agent-agent", "default:spire-agent-agent"}, agentServiceAccounts)
+
+	configMap := reconciler.spireConfigMapDeployment(server, "default", agentServiceAccounts)
+	assert.Contains(t, configMap.Data["server.conf"],
+		`service_account_allow_list = ["default:spire-agent-agent", "workloads:spire-agent-agent"]`)
+}
+
+func TestServersSideBySide(t *testing.T) {
+	ctx := context.Background()
+	first := mockSpireServer.DeepCopy()
+	second := mockSpireServer.DeepCopy()
+	second.Name = "other-spire-server"
+	second.Spec.TrustDomain = "example.com"
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(first, second).WithStatusSubresource(first, second).Build()
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme}
+
+	for _, server := range []*spirev1.SpireServer{first, second} {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)})
+		assert.NoError(t, err)
+	}
+
+	for _, server := range []*spirev1.SpireServer{first, second} {
+		configMap := &corev1.ConfigMap{}
+		assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: server.Name + "-server-config", Namespace: "default"}, configMap))
+		assert.Contains(t, configMap.Data["server.conf"], `trust_domain = "`+server.Spec.TrustDomain+`"`)
+		assert.Contains(t, configMap.Data["server.conf"], `config_map = "`+server.Name+`-bundle"`)
+
+		statefulSet := &appsv1.StatefulSet{}
+		assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), statefulSet))
+		assert.Equal(t, server.Name, statefulSet.Spec.Selector.MatchLabels[instanceLabel])
+		assert.Equal(t, managedBy, statefulSet.Labels[managedByLabel])
+
+		clusterRole := &rbacv1.ClusterRole{}
+		assert.NoError(t, c.Get(ctx, types.NamespacedName{Name: server.Name + "-trust-role-default"}, clusterRole))
+	}
+}
+
+func TestSpireServerForAgent(t *testing.T) {
+	agent := spireAgentFor(mockSpireServer, "workloads")
+
+	assert.Equal(t, []reconcile.Request{{NamespacedName: client.ObjectKeyFromObject(mockSpireServer)}},
+		spireServerForAgent(context.Background(), agent))
+}
+
+func TestStatefulSetUsesConfiguredImage(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+
+	r := &SpireServerReconciler{Images: Images{ServerImage: "registry.example.com/spire-server", Version: "1.6.3"}}
+	container := r.spireStatefulSetDeployment(server, "default").Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "registry.example.com/spire-server:1.6.3", container.Image)
+
+	server.Spec.Image = "registry.example.com/team/spire-server"
+	server.Spec.Version = "1.7.0"
+	server.Spec.ImagePullPolicy = corev1.PullAlways
+	server.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry-credentials"}}
+	podSpec := r.spireStatefulSetDeployment(server, "default").Spec.Template.Spec
+	assert.Equal(t, "registry.example.com/team/spire-server:1.7.0", podSpec.Containers[0].Image)
+	assert.Equal(t, corev1.PullAlways, podSpec.Containers[0].ImagePullPolicy)
+	assert.Equal(t, server.Spec.ImagePullSecrets, podSpec.ImagePullSecrets)
+}
+
+func TestReconcileRecordsVersionOnceRolledOut(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Spec.Version = "1.6.3"
+	statefulSet := reconciler.spireStatefulSetDeployment(server, server.Namespace)
+	statefulSet.Spec.Template.Spec.Containers[0].Image = "ghcr.io/spiffe/spire-server:1.6.3"
+	statefulSet.Generation = 1
+	statefulSet.Status = appsv1.StatefulSetStatus{ObservedGeneration: 1, Replicas: 1, ReadyReplicas: 1, UpdatedReplicas: 1}
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, statefulSet).WithStatusSubresource(server).Build()
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)})
+	assert.NoError(t, err)
+
+	reconciled := &spirev1.SpireServer{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), reconciled))
+	assert.Equal(t, "1.6.3", reconciled.Status.TargetVersion)
+	assert.Equal(t, "1.6.3", reconciled.Status.Version)
+}
+
+func TestReconcileRefusesVersionSkip(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Spec.Version = "1.7.0"
+	server.Status.Version = "1.5.1"
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server).WithStatusSubresource(server).Build()
+	recorder := record.NewFakeRecorder(1)
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme, Recorder: recorder}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)})
+	assert.NoError(t, err)
+
+	reconciled := &spirev1.SpireServer{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), reconciled))
+	condition := meta.FindStatusCondition(reconciled.Status.Conditions, spirev1.ConditionConfigValid)
+	assert.NotNil(t, condition)
+	assert.Equal(t, spirev1.ReasonUnsupportedUpgrade, condition.Reason)
+	assert.Equal(t, "1.5.1", reconciled.Status.Version)
+	assert.Contains(t, <-recorder.Events, "Warning UnsupportedUpgrade")
+
+	err = c.Get(ctx, client.ObjectKeyFromObject(server), &appsv1.StatefulSet{})
+	assert.True(t, apiErrors.IsNotFound(err), "servers should not be moved to an unsupported version")
+}
+
+func TestConfigChangeRollsStatefulSet(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(server).WithStatusSubresource(server).Build()
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme}
+
+	configHash := func() string {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)})
+		assert.NoError(t, err)
+
+		statefulSet := &appsv1.StatefulSet{}
+		assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), statefulSet))
+		return statefulSet.Spec.Template.Annotations[configHashAnnotation]
+	}
+
+	initial := configHash()
+	assert.NotEmpty(t, initial)
+	assert.Equal(t, initial, configHash())
+
+	// a new agent is added to the allow list of the server configuration
+	assert.NoError(t, c.Create(ctx, spireAgentFor(server, "workloads")))
+	assert.NotEqual(t, initial, configHash())
+}
+
+func TestStatefulSetReadsDatastoreSecret(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+	container := reconciler.spireStatefulSetDeployment(server, "default").Spec.Template.Spec.Containers[0]
+	assert.Empty(t, container.Env)
+	assert.NotContains(t, container.Args, "-expandEnv")
+
+	server.Spec.DataStore = "postgres"
+	server.Spec.DataStoreSecretRef = &spirev1.DataStoreSecretReference{Name: "datastore"}
+	server.Default()
+
+	// postgres reads the credentials from its own variables, which need no
+	// quoting in the connection string
+	container = reconciler.spireStatefulSetDeployment(server, "default").Spec.Template.Spec.Containers[0]
+	assert.NotContains(t, container.Args, "-expandEnv")
+	assert.Len(t, container.Env, 4)
+	assert.Equal(t, "PGPASSWORD", container.Env[2].Name)
+	assert.Equal(t, &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "datastore"}, Key: "password",
+	}, container.Env[2].ValueFrom.SecretKeyRef)
+
+	configMap := reconciler.spireConfigMapDeployment(server, "default", nil)
+	assert.NotContains(t, configMap.Data["server.conf"], "password")
+
+	server.Spec.DataStore = "mysql"
+	container = reconciler.spireStatefulSetDeployment(server, "default").Spec.Template.Spec.Containers[0]
+	assert.Contains(t, container.Args, "-expandEnv")
+	assert.Equal(t, "SPIRE_DATASTORE_PASSWORD", container.Env[2].Name)
+
+	configMap = reconciler.spireConfigMapDeployment(server, "default", nil)
+	assert.Contains(t, configMap.Data["server.conf"], `${SPIRE_DATASTORE_USER}:${SPIRE_DATASTORE_PASSWORD}@tcp(`)
+}
+
+func TestStatefulSetPassesConnectionStringWithDollarThroughEnv(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+	server.Spec.DataStore = "postgres"
+	server.Spec.ConnectionString = "host=db user=spire password=pa$word"
+	server.Spec.DataStoreOptions = &spirev1.DataStoreOptions{ReadOnlyConnectionString: "host=replica"}
+
+	container := reconciler.spireStatefulSetDeployment(server, "default").Spec.Template.Spec.Containers[0]
+	assert.Contains(t, container.Args, "-expandEnv")
+	assert.Equal(t, []corev1.EnvVar{{Name: "SPIRE_DATASTORE_CONNECTION_STRING",
+		Value: "host=db user=spire password=pa$$word"}}, container.Env,
+		"the value should be escaped for Kubernetes, which expands $(VAR) in env values")
+
+	serverConf := reconciler.spireConfigMapDeployment(server, "default", nil).Data["server.conf"]
+	assert.Contains(t, serverConf, `connection_string = "${SPIRE_DATASTORE_CONNECTION_STRING}"`)
+	assert.Contains(t, serverConf, `ro_connection_string = "host=replica"`)
+}
+
+func TestStatefulSetMountsDatastoreCertificates(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+	server.Spec.DataStore = "mysql"
+	server.Spec.ConnectionString = "spire@tcp(mysql:3306)/spire"
+	server.Spec.DataStoreOptions = &spirev1.DataStoreOptions{
+		TLS: &spirev1.DataStoreTLS{
+			RootCASecretRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "mysql-ca"}, Key: "ca.pem"},
+			ClientCertSecretName: "mysql-client",
+		},
+		ReadOnlyConnectionStringSecretRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "mysql"}, Key: "replica"},
+	}
+
+	podSpec := reconciler.spireStatefulSetDeployment(server, "default").Spec.Template.Spec
+	assert.Len(t, podSpec.Volumes, 3)
+	assert.Equal(t, "mysql-ca", podSpec.Volumes[1].Secret.SecretName)
+	assert.Equal(t, []corev1.KeyToPath{{Key: "ca.pem", Path: "ca.crt"}}, podSpec.Volumes[1].Secret.Items)
+	assert.Equal(t, "mysql-client", podSpec.Volumes[2].Secret.SecretName)
+	assert.Contains(t, podSpec.Containers[0].VolumeMounts,
+		corev1.VolumeMount{Name: "datastore-client", MountPath: "/run/spire/datastore/client", ReadOnly: true})
+	assert.Equal(t, "SPIRE_DATASTORE_RO_CONNECTION_STRING", podSpec.Containers[0].Env[0].Name)
+	assert.Contains(t, podSpec.Containers[0].Args, "-expandEnv")
+}
+
+func TestStatefulSetPointsPostgresToCertificates(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+	server.Spec.DataStore = "postgres"
+	server.Spec.DataStoreSecretRef = &spirev1.DataStoreSecretReference{Name: "datastore"}
+	server.Spec.DataStoreOptions = &spirev1.DataStoreOptions{
+		TLS: &spirev1.DataStoreTLS{
+			RootCASecretRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "postgres-ca"}, Key: "ca.crt"},
+			ClientCertSecretName: "postgres-client",
+		},
+		ReadOnlyConnectionString: "postgres://replica/spire",
+	}
+	server.Default()
+
+	// the variables apply to the read-only connection string as well, which
+	// may be a URL that parameters cannot be appended to
+	env := reconciler.spireStatefulSetDeployment(server, "default").Spec.Template.Spec.Containers[0].Env
+	assert.Contains(t, env, corev1.EnvVar{Name: "PGSSLMODE", Value: "verify-full"})
+	assert.Contains(t, env, corev1.EnvVar{Name: "PGSSLROOTCERT", Value: "/run/spire/datastore/ca/ca.crt"})
+	assert.Contains(t, env, corev1.EnvVar{Name: "PGSSLCERT", Value: "/run/spire/datastore/client/tls.crt"})
+	assert.Contains(t, env, corev1.EnvVar{Name: "PGSSLKEY", Value: "/run/spire/datastore/client/tls.key"})
+
+	serverConf := reconciler.spireConfigMapDeployment(server, "default", nil).Data["server.conf"]
+	assert.Contains(t, serverConf, `ro_connection_string = "postgres://replica/spire"`)
+}
+
+func TestReconcileDeploysManagedDatastore(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Spec.Replicas = 3
+	server.Spec.ManagedDataStore = &spirev1.ManagedDataStore{}
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(server).WithStatusSubresource(server).Build()
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme}
+	key := types.NamespacedName{Name: "valid-spire-server-datastore", Namespace: "default"}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)})
+	assert.NoError(t, err)
+
+	secret := &corev1.Secret{}
+	assert.NoError(t, c.Get(ctx, key, secret))
+	assert.Equal(t, "valid-spire-server-datastore.default.svc", string(secret.Data["host"]))
+	password := secret.Data["password"]
+	assert.Len(t, password, 48)
+
+	service := &corev1.Service{}
+	assert.NoError(t, c.Get(ctx, key, service))
+	assert.Equal(t, int32(5432), service.Spec.Ports[0].Port)
+
+	dataStore := &appsv1.StatefulSet{}
+	assert.NoError(t, c.Get(ctx, key, dataStore))
+	assert.Equal(t, "postgres:15", dataStore.Spec.Template.Spec.Containers[0].Image)
+	assert.Equal(t, dataStoreApp, dataStore.Spec.Selector.MatchLabels[nameLabel])
+
+	statefulSet := &appsv1.StatefulSet{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), statefulSet))
+	podSpec := statefulSet.Spec.Template.Spec
+	assert.Equal(t, []string{"-t", "30", "valid-spire-server-datastore.default.svc:5432"}, podSpec.InitContainers[0].Args)
+	assert.Equal(t, "valid-spire-server-datastore", podSpec.Containers[0].Env[0].ValueFrom.SecretKeyRef.Name)
+
+	reconciled := &spirev1.SpireServer{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), reconciled))
+	condition := meta.FindStatusCondition(reconciled.Status.Conditions, spirev1.ConditionDataStoreReady)
+	assert.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+
+	dataStore.Status.ReadyReplicas = 1
+	assert.NoError(t, c.Status().Update(ctx, dataStore))
+
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)})
+	assert.NoError(t, err)
+
+	// the generated password is kept
+	assert.NoError(t, c.Get(ctx, key, secret))
+	assert.Equal(t, password, secret.Data["password"])
+
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), reconciled))
+	assert.True(t, meta.IsStatusConditionTrue(reconciled.Status.Conditions, spirev1.ConditionDataStoreReady))
+}
+
+func TestReconcileRemovesManagedDatastore(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Spec.ManagedDataStore = &spirev1.ManagedDataStore{}
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(server).WithStatusSubresource(server).Build()
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(10)}
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)}
+	key := types.NamespacedName{Name: "valid-spire-server-datastore", Namespace: "default"}
+
+	_, err := r.Reconcile(ctx, request)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Get(ctx, key, &appsv1.StatefulSet{}))
+
+	// the server moves to a database of its own
+	assert.NoError(t, c.Get(ctx, request.NamespacedName, server))
+	server.Spec.ManagedDataStore = nil
+	server.Spec.ConnectionString = "postgres://spire@postgres/spire"
+	assert.NoError(t, c.Update(ctx, server))
+
+	_, err = r.Reconcile(ctx, request)
+	assert.NoError(t, err)
+
+	for _, obj := range []client.Object{&appsv1.StatefulSet{}, &corev1.Service{}, &corev1.Secret{}} {
+		err := c.Get(ctx, key, obj)
+		assert.True(t, apiErrors.IsNotFound(err), "the managed datastore %T should be deleted", obj)
+	}
+
+	// a Secret of the same name the server does not control is left alone
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	assert.NoError(t, c.Create(ctx, secret))
+
+	_, err = r.Reconcile(ctx, request)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Get(ctx, key, secret))
+}
+
+func TestStatefulSetExposesServerPort(t *testing.T) {
+	container := reconciler.spireStatefulSetDeployment(serverWithPort(9443), "default").Spec.Template.Spec.Containers[0]
+	assert.Equal(t, []corev1.ContainerPort{{Name: "grpc", ContainerPort: 9443}}, container.Ports)
+}
+
+func TestServerStorageSettings(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+	size := resource.MustParse("10Gi")
+	class := "fast-ssd"
+	server.Spec.Storage = &spirev1.ServerStorage{
+		Size:             &size,
+		StorageClassName: &class,
+		AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOncePod},
+	}
+
+	claim := reconciler.spireStatefulSetDeployment(server, "default").Spec.VolumeClaimTemplates[0]
+	assert.Equal(t, "spire-data", claim.Name)
+	assert.Equal(t, &class, claim.Spec.StorageClassName)
+	assert.Equal(t, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOncePod}, claim.Spec.AccessModes)
+	assert.Equal(t, "10Gi", claim.Spec.Resources.Requests.Storage().String())
+
+	limit := resource.MustParse("256Mi")
+	server.Spec.Storage = &spirev1.ServerStorage{EmptyDir: &corev1.EmptyDirVolumeSource{SizeLimit: &limit}}
+
+	statefulSet := reconciler.spireStatefulSetDeployment(server, "default")
+	assert.Empty(t, statefulSet.Spec.VolumeClaimTemplates)
+	volumes := statefulSet.Spec.Template.Spec.Volumes
+	assert.Equal(t, "spire-data", volumes[len(volumes)-1].Name)
+	assert.Equal(t, &limit, volumes[len(volumes)-1].EmptyDir.SizeLimit)
+}
+
+func TestReconcileExpandsServerVolumes(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	size := resource.MustParse("5Gi")
+	server.Spec.Storage = &spirev1.ServerStorage{Size: &size}
+	claim := func(name string, size string, labels map[string]string) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: server.Namespace, Labels: labels},
+			Spec: corev1.PersistentVolumeClaimSpec{Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+			}},
+		}
+	}
+	labels := selectorLabels(serverApp, server.Name)
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server,
+			claim("spire-data-valid-spire-server-0", "1Gi", labels),
+			claim("spire-data-valid-spire-server-1", "8Gi", labels),
+			claim("other-data-valid-spire-server-0", "1Gi", labels),
+			claim("spire-data-other-spire-server-0", "1Gi", selectorLabels(serverApp, "other-spire-server"))).
+		WithStatusSubresource(server).Build()
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)})
+	assert.NoError(t, err)
+
+	for name, expected := range map[string]string{
+		"spire-data-valid-spire-server-0": "5Gi",
+		"spire-data-valid-spire-server-1": "8Gi",
+		"other-data-valid-spire-server-0": "1Gi",
+		"spire-data-other-spire-server-0": "1Gi",
+	} {
+		live := &corev1.PersistentVolumeClaim{}
+		assert.NoError(t, c.Get(ctx, client.ObjectKey{Name: name, Namespace: server.Namespace}, live))
+		assert.Equal(t, expected, live.Spec.Resources.Requests.Storage().String(), name)
+	}
+}
+
+func TestServerSchedulingSettings(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+	server.Spec.Resources = corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+	}
+	server.Spec.NodeSelector = map[string]string{"node-role.kubernetes.io/infra": ""}
+	server.Spec.Tolerations = []corev1.Toleration{{Key: "infra", Operator: corev1.TolerationOpExists}}
+	server.Spec.Affinity = &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{}}
+	server.Spec.PriorityClassName = "spire-critical"
+	zones := &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "identity"}}
+	server.Spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{
+		{MaxSkew: 1, TopologyKey: corev1.LabelTopologyZone, WhenUnsatisfiable: corev1.DoNotSchedule},
+		{MaxSkew: 1, TopologyKey: corev1.LabelHostname, WhenUnsatisfiable: corev1.ScheduleAnyway, LabelSelector: zones},
+	}
+
+	podSpec := reconciler.spireStatefulSetDeployment(server, "default").Spec.Template.Spec
+	assert.Equal(t, server.Spec.Resources, podSpec.Containers[0].Resources)
+	assert.Equal(t, server.Spec.NodeSelector, podSpec.NodeSelector)
+	assert.Equal(t, server.Spec.Tolerations, podSpec.Tolerations)
+	assert.Equal(t, server.Spec.Affinity, podSpec.Affinity)
+	assert.Equal(t, "spire-critical", podSpec.PriorityClassName)
+	assert.Equal(t, selectorLabels(serverApp, server.Name), podSpec.TopologySpreadConstraints[0].LabelSelector.MatchLabels,
+		"constraints without a selector should spread the pods of the server")
+	assert.Equal(t, zones, podSpec.TopologySpreadConstraints[1].LabelSelector)
+	assert.Nil(t, server.Spec.TopologySpreadConstraints[0].LabelSelector, "the spec should be left unchanged")
+}
+
+func TestServerUpstreamAuthority(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+	server.Spec.UpstreamAuthority = &spirev1.UpstreamAuthority{
+		Disk: &spirev1.DiskUpstreamAuthority{SecretName: "upstream-ca"},
+	}
+
+	podSpec := reconciler.spireStatefulSetDeployment(server, "default").Spec.Template.Spec
+	volume := podSpec.Volumes[len(podSpec.Volumes)-1]
+	assert.Equal(t, "upstream-ca", volume.Secret.SecretName)
+	assert.Equal(t, []corev1.KeyToPath{{Key: "tls.crt", Path: "tls.crt"}, {Key: "tls.key", Path: "tls.key"}},
+		volume.Secret.Items)
+	assert.Contains(t, podSpec.Containers[0].VolumeMounts,
+		corev1.VolumeMount{Name: "upstream-ca", MountPath: "/run/spire/upstream/ca", ReadOnly: true})
+	assert.Len(t, reconciler.spireRoleDeployment(server, "default").Rules, 1)
+
+	server.Spec.UpstreamAuthority = &spirev1.UpstreamAuthority{
+		CertManager: &spirev1.CertManagerUpstreamAuthority{IssuerRef: spirev1.IssuerReference{Name: "corporate-ca"}},
+	}
+
+	rules := reconciler.spireRoleDeployment(server, "default").Rules
+	assert.Equal(t, []string{"certificaterequests"}, rules[1].Resources)
+	assert.Equal(t, []string{"cert-manager.io"}, rules[1].APIGroups)
+	podSpec = reconciler.spireStatefulSetDeployment(server, "default").Spec.Template.Spec
+	for _, volume := range podSpec.Volumes {
+		assert.Nil(t, volume.Secret, "cert-manager is reached through the API server")
+	}
+}
+
+func TestServerKeyManagerPluginSettings(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+	server.Spec.KeyManager = &spirev1.ServerKeyManager{Plugin: &spirev1.PluginKeyManager{
+		Name:            "gcp_kms",
+		ConfigSecretRef: spirev1.PluginConfigSecretReference{Name: "gcp-kms", Keys: []string{"key_ring"}},
+	}}
+
+	container := reconciler.spireStatefulSetDeployment(server, "default").Spec.Template.Spec.Containers[0]
+	assert.Contains(t, container.Args, "-expandEnv")
+	assert.Equal(t, []corev1.EnvVar{secretEnv("SPIRE_KEYMANAGER_KEY_RING", secretKey("gcp-kms", "key_ring"))},
+		container.Env)
+
+	server.Spec.KeyManager = &spirev1.ServerKeyManager{Disk: &spirev1.DiskKeyManager{KeysPath: "keys/server.json"}}
+
+	container = reconciler.spireStatefulSetDeployment(server, "default").Spec.Template.Spec.Containers[0]
+	assert.NotContains(t, container.Args, "-expandEnv")
+	assert.Equal(t, "/run/spire/data/keys/server.json", serverKeyManager(server).Data["keys_path"])
+}
+
+func TestServerNodeAttestorSecrets(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+	server.Spec.NodeAttestors = []spirev1.NodeAttestor{
+		{Name: "x509pop", X509PoP: &spirev1.X509PoPNodeAttestor{CABundleSecretRef: secretKey("x509pop-ca", "ca.crt")}},
+		{Name: "aws_iid", AWSIID: &spirev1.AWSIIDNodeAttestor{CredentialsSecretName: "aws-credentials"}},
+	}
+
+	podSpec := reconciler.spireStatefulSetDeployment(server, "default").Spec.Template.Spec
+	volume := podSpec.Volumes[len(podSpec.Volumes)-1]
+	assert.Equal(t, "x509pop-ca", volume.Secret.SecretName)
+	assert.Equal(t, []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}}, volume.Secret.Items)
+	container := podSpec.Containers[0]
+	assert.Contains(t, container.VolumeMounts,
+		corev1.VolumeMount{Name: "x509pop-ca", MountPath: "/run/spire/nodeattestor/x509pop", ReadOnly: true})
+	assert.Contains(t, container.Args, "-expandEnv")
+	assert.Equal(t, []corev1.EnvVar{
+		secretEnv("SPIRE_NODEATTESTOR_AWS_IID_ACCESS_KEY_ID", secretKey("aws-credentials", "access_key_id")),
+		secretEnv("SPIRE_NODEATTESTOR_AWS_IID_SECRET_ACCESS_KEY", secretKey("aws-credentials", "secret_access_key")),
+	}, container.Env)
+}
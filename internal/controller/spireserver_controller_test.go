@@ -9,6 +9,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -597,7 +598,7 @@ var _ = Describe("SpireServer controller", func() {
 				Spec: spirev1.SpireServerSpec{
 					TrustDomain:   "example.org",
 					Port:          8081,
-					NodeAttestors: []spirev1.NodeAttestor{{Name: "k8s_sat"}, {Name: "aws_iid"}},
+					NodeAttestors: []spirev1.NodeAttestor{{Name: "k8s_sat"}, {Name: "not_an_attestor"}},
 					KeyStorage:    "disk",
 					Replicas:      1,
 				},
@@ -724,7 +725,7 @@ var _ = Describe("SpireServer controller", func() {
 		BeforeEach(func() {
 			spireServer = &spirev1.SpireServer{
 				TypeMeta:   serverTypeMeta,
-				ObjectMeta: serverObjectMeta,
+				ObjectMeta: metav1.ObjectMeta{Name: "defaulted-spire-server", Namespace: "default"},
 				Spec: spirev1.SpireServerSpec{
 					TrustDomain:      "example.org",
 					Port:             8081,
@@ -735,14 +736,14 @@ var _ = Describe("SpireServer controller", func() {
 					ConnectionString: "",
 				},
 			}
-			Expect(k8sClient.Create(ctx, spireServer)).ShouldNot(Succeed())
+			Expect(k8sClient.Create(ctx, spireServer)).Should(Succeed())
 		})
-		It("should not create the CRD instance", func() {
+		It("should create the CRD instance and default the connection string", func() {
 			serverLookupKey := types.NamespacedName{Name: spireServer.Name, Namespace: spireServer.Namespace}
 			createdSpireServer := &spirev1.SpireServer{}
 			Eventually(func() bool {
 				err := k8sClient.Get(ctx, serverLookupKey, createdSpireServer)
-				return err != nil
+				return err == nil && meta.IsStatusConditionTrue(createdSpireServer.Status.Conditions, spirev1.ConditionConfigValid)
 			}, timeout, interval).Should(BeTrue())
 		})
 	})
@@ -752,7 +753,7 @@ var _ = Describe("SpireServer controller", func() {
 		BeforeEach(func() {
 			spireServer = &spirev1.SpireServer{
 				TypeMeta:   serverTypeMeta,
-				ObjectMeta: serverObjectMeta,
+				ObjectMeta: metav1.ObjectMeta{Name: "invalid-spire-server", Namespace: "default"},
 				Spec: spirev1.SpireServerSpec{
 					TrustDomain:      "example.org",
 					Port:             8081,
@@ -765,12 +766,12 @@ var _ = Describe("SpireServer controller", func() {
 			}
 			Expect(k8sClient.Create(ctx, spireServer)).Should(Succeed())
 		})
-		It("should delete the CRD instance created", func() {
+		It("should keep the CRD instance and report it as invalid", func() {
 			serverLookupKey := types.NamespacedName{Name: spireServer.Name, Namespace: spireServer.Namespace}
 			createdSpireServer := &spirev1.SpireServer{}
 			Eventually(func() bool {
 				err := k8sClient.Get(ctx, serverLookupKey, createdSpireServer)
-				return err != nil
+				return err == nil && meta.IsStatusConditionFalse(createdSpireServer.Status.Conditions, spirev1.ConditionConfigValid)
 			}, timeout, interval).Should(BeTrue())
 		})
 	})
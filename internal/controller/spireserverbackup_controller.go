@@ -0,0 +1,497 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+	"github.com/go-logr/logr"
+)
+
+// SpireServerBackupReconciler reconciles a SpireServerBackup object
+type SpireServerBackupReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Images deployed for resources that do not set their own
+	Images Images
+}
+
+//+kubebuilder:rbac:groups=spire.hpe.com,resources=spireserverbackups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=spire.hpe.com,resources=spireserverbackups/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=spire.hpe.com,resources=spireserverbackups/finalizers,verbs=update
+//+kubebuilder:rbac:groups=spire.hpe.com,resources=spireservers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=core,resources=serviceaccounts;secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch;delete;bind;escalate
+
+// Reconcile takes the backups of a SPIRE server, either once with a Job or on
+// a schedule with a CronJob, and reports the latest of them.
+func (r *SpireServerBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.Log.WithValues("SpireServerBackup", req.NamespacedName)
+
+	backup := &spirev1.SpireServerBackup{}
+	if err := r.Get(ctx, req.NamespacedName, backup); err != nil {
+		if apiErrors.IsNotFound(err) {
+			// the Jobs are garbage collected, the backups they took are kept
+			logger.Info("SPIRE server backup not found, it must have been deleted.")
+			return ctrl.Result{}, nil
+		}
+
+		logger.Error(err, "Failed to get SPIRE server backup instance.")
+		return ctrl.Result{}, err
+	}
+
+	status := backup.Status.DeepCopy()
+	backup.Default()
+
+	if err := backup.ValidateSpec(); err != nil {
+		logger.Info("Invalid SPIRE server backup spec, skipping reconcile.", "reason", err.Error())
+		reportInvalidSpec(r.Recorder, backup, &backup.Status.Conditions, spirev1.ReasonInvalidSpec, err)
+		return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, backup, status, &backup.Status)
+	}
+
+	server := &spirev1.SpireServer{}
+	if err := r.Get(ctx, backup.ServerKey(), server); err != nil {
+		if !apiErrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		// a new reconcile is triggered once the server is created
+		setCondition(&backup.Status.Conditions, backup.Generation, spirev1.ConditionConfigValid,
+			metav1.ConditionFalse, spirev1.ReasonServerNotFound, fmt.Sprintf("SPIRE server %s not found", backup.ServerKey()))
+		return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, backup, status, &backup.Status)
+	}
+	server.Default()
+
+	if err := backup.ValidateServer(server); err != nil {
+		logger.Info("SPIRE server cannot be backed up, skipping reconcile.", "reason", err.Error())
+		reportInvalidSpec(r.Recorder, backup, &backup.Status.Conditions, spirev1.ReasonInvalidSpec, err)
+		return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, backup, status, &backup.Status)
+	}
+
+	setCondition(&backup.Status.Conditions, backup.Generation, spirev1.ConditionConfigValid,
+		metav1.ConditionTrue, spirev1.ReasonValid, "spec is valid")
+
+	var components []component
+	if backup.Spec.Destination.Secret != nil {
+		components = append(components,
+			component{"uploaderServiceAccount", r.backupUploaderServiceAccount(backup)},
+			component{"uploaderRole", r.backupUploaderRole(backup)},
+			component{"uploaderRoleBinding", r.backupUploaderRoleBinding(backup)},
+		)
+	}
+
+	cronJob := r.backupCronJob(backup, server)
+	if backup.Spec.Schedule != "" {
+		components = append(components, component{"backupCronJob", cronJob})
+	} else {
+		components = append(components, component{"backupJob", r.backupJob(backup, server)})
+	}
+
+	if err := reconcileComponents(ctx, r.Client, r.Scheme, backup, components, logger); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// the schedule was removed, backups are only taken once
+	if backup.Spec.Schedule == "" {
+		if err := deleteComponents(ctx, r.Client, []component{{"backupCronJob", cronJob}}, logger); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	jobs := &batchv1.JobList{}
+	if err := r.List(ctx, jobs, client.InNamespace(backup.Namespace),
+		client.MatchingLabels(selectorLabels(backupApp, backup.Name))); err != nil {
+		return ctrl.Result{}, err
+	}
+	setBackupStatus(backup, jobs.Items)
+
+	if backup.Spec.Destination.Secret != nil {
+		if err := r.pruneBackupSecrets(ctx, backup, logger); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	backup.Status.ObservedGeneration = backup.Generation
+
+	return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, backup, status, &backup.Status)
+}
+
+// backupJob returns the Job taking the single backup of a SpireServerBackup
+// without a schedule.
+func (r *SpireServerBackupReconciler) backupJob(b *spirev1.SpireServerBackup, s *spirev1.SpireServer) *batchv1.Job {
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      b.Name,
+			Namespace: b.Namespace,
+			Labels:    componentLabels(backupApp, b.Name),
+		},
+		Spec: r.backupJobSpec(b, s),
+	}
+}
+
+// backupCronJob returns the CronJob taking the backups of a SpireServerBackup
+// on its schedule.
+func (r *SpireServerBackupReconciler) backupCronJob(b *spirev1.SpireServerBackup,
+	s *spirev1.SpireServer) *batchv1.CronJob {
+	suspend := b.Spec.Suspend
+
+	return &batchv1.CronJob{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "CronJob",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      b.Name,
+			Namespace: b.Namespace,
+			Labels:    componentLabels(backupApp, b.Name),
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:          b.Spec.Schedule,
+			Suspend:           &suspend,
+			ConcurrencyPolicy: batchv1.ForbidConcurrent,
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: componentLabels(backupApp, b.Name)},
+				Spec:       r.backupJobSpec(b, s),
+			},
+		},
+	}
+}
+
+// backupJobSpec returns the Job writing a backup to the destination of the
+// SpireServerBackup. Backups are named after the Job taking them.
+func (r *SpireServerBackupReconciler) backupJobSpec(b *spirev1.SpireServerBackup,
+	s *spirev1.SpireServer) batchv1.JobSpec {
+	image := backupImage(r.Images, b, s)
+	backupName := corev1.EnvVar{Name: backupNameEnv, ValueFrom: &corev1.EnvVarSource{
+		FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.labels['job-name']"},
+	}}
+
+	podSpec := corev1.PodSpec{
+		RestartPolicy:    corev1.RestartPolicyNever,
+		ImagePullSecrets: s.Spec.ImagePullSecrets,
+	}
+
+	if claim := b.Spec.Destination.PersistentVolumeClaim; claim != nil {
+		// the backup only takes the place of an older one once it is
+		// complete
+		script := "set -e\n" +
+			`dir="` + backupDir + `/$` + backupNameEnv + `"` + "\n" +
+			`out="$dir.partial"` + "\n" +
+			`rm -rf "$out" && mkdir -p "$out"` + "\n" +
+			backupScript(s) +
+			`rm -rf "$dir" && mv "$out" "$dir"` + "\n" +
+			pruneBackupsScript(b)
+
+		container := backupToolContainer("backup", image, s, script)
+		container.Env = append(container.Env, backupName)
+		podSpec.Containers = []corev1.Container{container}
+		podSpec.Volumes = backupPodVolumes(s, corev1.Volume{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: claim.ClaimName,
+			}},
+		})
+	} else {
+		// the backup is taken into an empty directory, which is then stored
+		// in a Secret
+		container := backupToolContainer("backup", image, s, "set -e\nout="+backupDir+"\n"+backupScript(s))
+		podSpec.InitContainers = []corev1.Container{container}
+		podSpec.Containers = []corev1.Container{{
+			Name:            "upload",
+			Image:           r.Images.kubectlImage(),
+			ImagePullPolicy: s.Spec.ImagePullPolicy,
+			Command:         []string{"/bin/sh", "-c", uploadBackupScript(b)},
+			Env:             []corev1.EnvVar{backupName},
+			VolumeMounts:    []corev1.VolumeMount{{Name: "backup", MountPath: backupDir, ReadOnly: true}},
+		}}
+		podSpec.ServiceAccountName = backupUploaderName(b.Name)
+		podSpec.Volumes = backupPodVolumes(s, corev1.Volume{
+			Name:         "backup",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+	}
+
+	// the volume of the server pod can only be mounted on its node, which
+	// may be tainted
+	if mountsServerData(s) {
+		podSpec.Tolerations = s.Spec.Tolerations
+		podSpec.Affinity = &corev1.Affinity{PodAffinity: &corev1.PodAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{
+					"statefulset.kubernetes.io/pod-name": s.Name + "-0",
+				}},
+				TopologyKey: corev1.LabelHostname,
+			}},
+		}}
+	}
+
+	return batchv1.JobSpec{
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: componentLabels(backupApp, b.Name)},
+			Spec:       podSpec,
+		},
+	}
+}
+
+// pruneBackupsScript returns the shell script deleting the backups of the
+// SpireServerBackup from its volume, newest first, past its retention.
+func pruneBackupsScript(b *spirev1.SpireServerBackup) string {
+	// scheduled backups are named after the CronJob with a numeric suffix
+	pattern := "^" + backupDir + "/" + strings.ReplaceAll(b.Name, ".", `\.`) + "(-[0-9]+)?$"
+
+	return "ls -1dt " + backupDir + "/* | grep -E " + shellQuote(pattern) +
+		" | tail -n +" + strconv.Itoa(int(b.Spec.Retention)+1) + " | xargs -r rm -rf\n"
+}
+
+// uploadBackupScript returns the shell script storing the backup in a Secret
+// labelled as a backup of the SpireServerBackup.
+func uploadBackupScript(b *spirev1.SpireServerBackup) string {
+	labels := componentLabels(backupApp, b.Name)
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	label := ""
+	for _, key := range keys {
+		label += " " + shellQuote(key+"="+labels[key])
+	}
+
+	return "set -e\n" +
+		`kubectl create secret generic "$` + backupNameEnv + `" --from-file=` + backupDir + " --dry-run=client -o yaml |\n" +
+		"  kubectl label --local -f - -o yaml" + label + " |\n" +
+		"  kubectl create -f -\n"
+}
+
+func (r *SpireServerBackupReconciler) backupUploaderServiceAccount(b *spirev1.SpireServerBackup) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ServiceAccount",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backupUploaderName(b.Name),
+			Namespace: b.Namespace,
+			Labels:    componentLabels(backupApp, b.Name),
+		},
+	}
+}
+
+// backupUploaderRole allows the Jobs of the SpireServerBackup to store
+// backups in Secrets.
+func (r *SpireServerBackupReconciler) backupUploaderRole(b *spirev1.SpireServerBackup) *rbacv1.Role {
+	return &rbacv1.Role{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Role",
+			APIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backupUploaderName(b.Name),
+			Namespace: b.Namespace,
+			Labels:    componentLabels(backupApp, b.Name),
+		},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups: []string{""},
+			Resources: []string{"secrets"},
+			Verbs:     []string{"create"},
+		}},
+	}
+}
+
+func (r *SpireServerBackupReconciler) backupUploaderRoleBinding(b *spirev1.SpireServerBackup) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "RoleBinding",
+			APIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backupUploaderName(b.Name),
+			Namespace: b.Namespace,
+			Labels:    componentLabels(backupApp, b.Name),
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      "ServiceAccount",
+			Name:      backupUploaderName(b.Name),
+			Namespace: b.Namespace,
+		}},
+		RoleRef: rbacv1.RoleRef{
+			Kind:     "Role",
+			Name:     backupUploaderName(b.Name),
+			APIGroup: "rbac.authorization.k8s.io",
+		},
+	}
+}
+
+// setBackupStatus reports the latest successful backup taken by jobs and
+// whether the latest backup to finish succeeded.
+func setBackupStatus(b *spirev1.SpireServerBackup, jobs []batchv1.Job) {
+	var latest *batchv1.Job
+	var latestAt time.Time
+
+	for i := range jobs {
+		job := &jobs[i]
+		finished, succeeded, at := jobResult(job)
+		if !finished {
+			continue
+		}
+
+		if succeeded && (b.Status.LastBackupTime == nil || at.After(b.Status.LastBackupTime.Time)) {
+			b.Status.LastBackup = job.Name
+			b.Status.LastBackupTime = &metav1.Time{Time: at}
+		}
+
+		if latest == nil || at.After(latestAt) {
+			latest, latestAt = job, at
+		}
+	}
+
+	if latest == nil {
+		return
+	}
+
+	if _, succeeded, _ := jobResult(latest); succeeded {
+		setCondition(&b.Status.Conditions, b.Generation, spirev1.ConditionBackupSucceeded, metav1.ConditionTrue,
+			spirev1.ReasonBackupSucceeded, fmt.Sprintf("backup %s succeeded", latest.Name))
+	} else {
+		setCondition(&b.Status.Conditions, b.Generation, spirev1.ConditionBackupSucceeded, metav1.ConditionFalse,
+			spirev1.ReasonBackupFailed, fmt.Sprintf("backup %s failed, see the logs of its Job", latest.Name))
+	}
+}
+
+// jobResult reports whether the Job finished, whether it succeeded and when
+// it finished.
+func jobResult(job *batchv1.Job) (finished bool, succeeded bool, at time.Time) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobComplete:
+			if job.Status.CompletionTime != nil {
+				return true, true, job.Status.CompletionTime.Time
+			}
+			return true, true, condition.LastTransitionTime.Time
+		case batchv1.JobFailed:
+			return true, false, condition.LastTransitionTime.Time
+		}
+	}
+
+	return false, false, time.Time{}
+}
+
+// pruneBackupSecrets deletes the Secrets holding backups of the
+// SpireServerBackup, newest first, past its retention.
+func (r *SpireServerBackupReconciler) pruneBackupSecrets(ctx context.Context, b *spirev1.SpireServerBackup,
+	logger logr.Logger) error {
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.InNamespace(b.Namespace),
+		client.MatchingLabels(selectorLabels(backupApp, b.Name))); err != nil {
+		return err
+	}
+
+	sort.Slice(secrets.Items, func(i, j int) bool {
+		x, y := secrets.Items[i], secrets.Items[j]
+		if !x.CreationTimestamp.Equal(&y.CreationTimestamp) {
+			return y.CreationTimestamp.Before(&x.CreationTimestamp)
+		}
+		return x.Name > y.Name
+	})
+
+	var expired []component
+	for i := int(b.Spec.Retention); i < len(secrets.Items); i++ {
+		expired = append(expired, component{"backupSecret", &secrets.Items[i]})
+	}
+
+	return deleteComponents(ctx, r.Client, expired, logger)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SpireServerBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&spirev1.SpireServerBackup{}).
+		Owns(&batchv1.CronJob{}).
+		Owns(&corev1.ServiceAccount{}).
+		Owns(&rbacv1.Role{}).
+		Owns(&rbacv1.RoleBinding{}).
+		Watches(&batchv1.Job{}, handler.EnqueueRequestsFromMapFunc(spireServerBackupForJob)).
+		Watches(&spirev1.SpireServer{}, handler.EnqueueRequestsFromMapFunc(r.spireServerBackupsForServer)).
+		Complete(r)
+}
+
+// spireServerBackupForJob maps a Job, whether created for a SpireServerBackup
+// or by its CronJob, to the SpireServerBackup so that its status is refreshed.
+func spireServerBackupForJob(ctx context.Context, job client.Object) []reconcile.Request {
+	labels := job.GetLabels()
+	if labels[nameLabel] != backupApp || labels[instanceLabel] == "" {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{
+		Name:      labels[instanceLabel],
+		Namespace: job.GetNamespace(),
+	}}}
+}
+
+// spireServerBackupsForServer maps a SPIRE server to the SpireServerBackups
+// backing it up, so that their Jobs follow the changes to its datastore.
+func (r *SpireServerBackupReconciler) spireServerBackupsForServer(ctx context.Context,
+	server client.Object) []reconcile.Request {
+	backups := &spirev1.SpireServerBackupList{}
+	if err := r.List(ctx, backups, client.InNamespace(server.GetNamespace())); err != nil {
+		log.Log.Error(err, "Failed to list SPIRE server backups.", "SpireServer", client.ObjectKeyFromObject(server))
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, backup := range backups.Items {
+		if backup.Spec.ServerRef.Name == server.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&backup)})
+		}
+	}
+
+	return requests
+}
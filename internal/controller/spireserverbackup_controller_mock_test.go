@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+)
+
+func createSpireServerBackup(destination spirev1.BackupDestination) *spirev1.SpireServerBackup {
+	return &spirev1.SpireServerBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-backup", Namespace: "default"},
+		Spec: spirev1.SpireServerBackupSpec{
+			ServerRef:   corev1.LocalObjectReference{Name: mockSpireServer.Name},
+			Destination: destination,
+		},
+	}
+}
+
+var claimDestination = spirev1.BackupDestination{
+	PersistentVolumeClaim: &spirev1.PersistentVolumeClaimDestination{ClaimName: "spire-backups"},
+}
+
+func TestBackupTakesSingleBackupToVolume(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	backup := createSpireServerBackup(claimDestination)
+	backup.Spec.Retention = 3
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, backup).WithStatusSubresource(backup).Build()
+	r := &SpireServerBackupReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(backup)})
+	assert.NoError(t, err)
+
+	job := &batchv1.Job{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(backup), job))
+	podSpec := job.Spec.Template.Spec
+	assert.Equal(t, DefaultSQLiteImage, podSpec.Containers[0].Image)
+	script := podSpec.Containers[0].Command[2]
+	assert.Contains(t, script, `sqlite3 '/run/spire/data/datastore.sqlite3' ".backup '$out/datastore.sqlite3'"`)
+	assert.Contains(t, script, `cp '/run/spire/data/keys.json' "$out/keys.json"`)
+	assert.Contains(t, script, `grep -E '^/backup/spire-backup(-[0-9]+)?$' | tail -n +4 | xargs -r rm -rf`)
+	assert.Equal(t, "spire-backups", podSpec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	assert.Equal(t, "spire-data-valid-spire-server-0", podSpec.Volumes[1].PersistentVolumeClaim.ClaimName)
+	assert.Equal(t, "valid-spire-server-0", podSpec.Affinity.PodAffinity.
+		RequiredDuringSchedulingIgnoredDuringExecution[0].LabelSelector.MatchLabels["statefulset.kubernetes.io/pod-name"])
+
+	err = c.Get(ctx, client.ObjectKeyFromObject(backup), &batchv1.CronJob{})
+	assert.True(t, apiErrors.IsNotFound(err), "backups without a schedule are taken once")
+
+	reconciled := &spirev1.SpireServerBackup{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(backup), reconciled))
+	assert.True(t, meta.IsStatusConditionTrue(reconciled.Status.Conditions, spirev1.ConditionConfigValid))
+}
+
+func TestBackupSchedulesBackupsToSecrets(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Spec.DataStore = "postgres"
+	server.Spec.KeyStorage = "memory"
+	server.Spec.DataStoreSecretRef = &spirev1.DataStoreSecretReference{Name: "datastore"}
+	backup := createSpireServerBackup(spirev1.BackupDestination{Secret: &spirev1.SecretDestination{}})
+	backup.Spec.Schedule = "0 3 * * *"
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, backup).WithStatusSubresource(backup).Build()
+	r := &SpireServerBackupReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(backup)})
+	assert.NoError(t, err)
+
+	cronJob := &batchv1.CronJob{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(backup), cronJob))
+	assert.Equal(t, "0 3 * * *", cronJob.Spec.Schedule)
+	assert.Equal(t, batchv1.ForbidConcurrent, cronJob.Spec.ConcurrencyPolicy)
+	assert.Equal(t, backupApp, cronJob.Spec.JobTemplate.Labels[nameLabel])
+
+	podSpec := cronJob.Spec.JobTemplate.Spec.Template.Spec
+	assert.Equal(t, "spire-backup-uploader", podSpec.ServiceAccountName)
+	assert.Nil(t, podSpec.Affinity, "keys in memory are not backed up")
+	dump := podSpec.InitContainers[0]
+	assert.Equal(t, spirev1.DefaultPostgresImage, dump.Image)
+	assert.Contains(t, dump.Command[2], `pg_dump --clean --if-exists --no-owner -f "$out/datastore.sql"`)
+	assert.Contains(t, dump.Env, secretEnv("PGPASSWORD", secretKey("datastore", "password")))
+	upload := podSpec.Containers[0]
+	assert.Equal(t, DefaultKubectlImage, upload.Image)
+	assert.Contains(t, upload.Command[2], `kubectl create secret generic "$BACKUP_NAME" --from-file=/backup`)
+	assert.Contains(t, upload.Command[2], `'app.kubernetes.io/instance=spire-backup'`)
+	assert.NotNil(t, podSpec.Volumes[0].EmptyDir)
+
+	role := &rbacv1.Role{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKey{Name: "spire-backup-uploader", Namespace: "default"}, role))
+	assert.Equal(t, []string{"create"}, role.Rules[0].Verbs)
+}
+
+func TestBackupRejectsMySQLConnectionString(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Spec.DataStore = "mysql"
+	server.Spec.ConnectionString = "spire:secret@tcp(mysql:3306)/spire"
+	backup := createSpireServerBackup(claimDestination)
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, backup).WithStatusSubresource(backup).Build()
+	r := &SpireServerBackupReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(backup)})
+	assert.NoError(t, err)
+
+	reconciled := &spirev1.SpireServerBackup{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(backup), reconciled))
+	condition := meta.FindStatusCondition(reconciled.Status.Conditions, spirev1.ConditionConfigValid)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Contains(t, condition.Message, "dataStoreSecretRef or managedDataStore")
+
+	err = c.Get(ctx, client.ObjectKeyFromObject(backup), &batchv1.Job{})
+	assert.True(t, apiErrors.IsNotFound(err))
+}
+
+func TestDataStoreToolEnvOfMySQLConnectionString(t *testing.T) {
+	server := mockSpireServer.DeepCopy()
+	server.Spec.DataStore = "mysql"
+	server.Spec.ConnectionString = "spire:secret@tcp(mysql:3306)/spire"
+
+	assert.Empty(t, dataStoreToolEnv(server))
+}
+
+func finishedJob(name string, condition batchv1.JobConditionType, at time.Time) batchv1.Job {
+	job := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	job.Status.Conditions = []batchv1.JobCondition{{
+		Type:               condition,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Time{Time: at},
+	}}
+	if condition == batchv1.JobComplete {
+		job.Status.CompletionTime = &metav1.Time{Time: at}
+	}
+
+	return job
+}
+
+func TestBackupStatusReportsLatestBackups(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	backup := createSpireServerBackup(claimDestination)
+
+	setBackupStatus(backup, []batchv1.Job{
+		finishedJob("spire-backup-3", batchv1.JobComplete, now.Add(-2*time.Hour)),
+		finishedJob("spire-backup-2", batchv1.JobComplete, now.Add(-3*time.Hour)),
+		finishedJob("spire-backup-4", batchv1.JobFailed, now.Add(-time.Hour)),
+		{ObjectMeta: metav1.ObjectMeta{Name: "spire-backup-5"}},
+	})
+
+	assert.Equal(t, "spire-backup-3", backup.Status.LastBackup)
+	assert.True(t, backup.Status.LastBackupTime.Time.Equal(now.Add(-2*time.Hour)))
+	condition := meta.FindStatusCondition(backup.Status.Conditions, spirev1.ConditionBackupSucceeded)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Contains(t, condition.Message, "spire-backup-4")
+
+	setBackupStatus(backup, []batchv1.Job{finishedJob("spire-backup-6", batchv1.JobComplete, now)})
+
+	assert.Equal(t, "spire-backup-6", backup.Status.LastBackup)
+	assert.True(t, meta.IsStatusConditionTrue(backup.Status.Conditions, spirev1.ConditionBackupSucceeded))
+}
+
+func TestBackupPrunesSecretsPastRetention(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	backup := createSpireServerBackup(spirev1.BackupDestination{Secret: &spirev1.SecretDestination{}})
+	backup.Spec.Retention = 2
+
+	var objects []client.Object
+	for i, name := range []string{"spire-backup-1", "spire-backup-2", "spire-backup-3"} {
+		objects = append(objects, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			Labels:            componentLabels(backupApp, backup.Name),
+			CreationTimestamp: metav1.Time{Time: now.Add(time.Duration(i) * time.Hour)},
+		}})
+	}
+	// secrets of other backups are left alone
+	objects = append(objects, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:      "other-backup-1",
+		Namespace: "default",
+		Labels:    componentLabels(backupApp, "other-backup"),
+	}})
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(objects...).Build()
+	r := &SpireServerBackupReconciler{Client: c, Scheme: testScheme}
+
+	assert.NoError(t, r.pruneBackupSecrets(ctx, backup, ctrl.Log))
+
+	secrets := &corev1.SecretList{}
+	assert.NoError(t, c.List(ctx, secrets))
+	var names []string
+	for _, secret := range secrets.Items {
+		names = append(names, secret.Name)
+	}
+	assert.ElementsMatch(t, []string{"spire-backup-2", "spire-backup-3", "other-backup-1"}, names)
+}
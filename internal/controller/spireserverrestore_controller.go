@@ -0,0 +1,344 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+)
+
+// SpireServerRestoreReconciler reconciles a SpireServerRestore object
+type SpireServerRestoreReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Images deployed for resources that do not set their own
+	Images Images
+}
+
+// restoreAnnotation is set on a SpireServer to the name of the
+// SpireServerRestore replacing its data, which stops its pods meanwhile.
+const restoreAnnotation = "spire.hpe.com/restore"
+
+// restoreCheckInterval is how often a restore waiting for the pods of its
+// SPIRE server to stop, or for another restore to finish, checks again
+const restoreCheckInterval = 5 * time.Second
+
+// restoreScaleDownTimeout is how long a restore waits for the pods of its
+// SPIRE server to stop before it fails, starting the server again
+const restoreScaleDownTimeout = 10 * time.Minute
+
+//+kubebuilder:rbac:groups=spire.hpe.com,resources=spireserverrestores,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=spire.hpe.com,resources=spireserverrestores/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=spire.hpe.com,resources=spireserverrestores/finalizers,verbs=update
+//+kubebuilder:rbac:groups=spire.hpe.com,resources=spireservers,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=spire.hpe.com,resources=spireserverbackups,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile stops the SPIRE server, restores its datastore and keys from a
+// backup with a Job, then starts the server again.
+func (r *SpireServerRestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.Log.WithValues("SpireServerRestore", req.NamespacedName)
+
+	restore := &spirev1.SpireServerRestore{}
+	if err := r.Get(ctx, req.NamespacedName, restore); err != nil {
+		if apiErrors.IsNotFound(err) {
+			logger.Info("SPIRE server restore not found, it must have been deleted.")
+			return ctrl.Result{}, nil
+		}
+
+		logger.Error(err, "Failed to get SPIRE server restore instance.")
+		return ctrl.Result{}, err
+	}
+
+	status := restore.Status.DeepCopy()
+
+	// the server is started again when a restore is deleted before it is over
+	if !restore.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(restore, cleanupFinalizer) {
+			return ctrl.Result{}, nil
+		}
+		if err := r.releaseServer(ctx, restore); err != nil {
+			return ctrl.Result{}, reportCleanupBlocked(ctx, r.Client, restore, &restore.Status.Conditions, err)
+		}
+
+		controllerutil.RemoveFinalizer(restore, cleanupFinalizer)
+		return ctrl.Result{}, r.Update(ctx, restore)
+	}
+
+	if restore.Finished() {
+		return ctrl.Result{}, r.releaseServer(ctx, restore)
+	}
+
+	if controllerutil.AddFinalizer(restore, cleanupFinalizer) {
+		if err := r.Update(ctx, restore); err != nil {
+			logger.Error(err, "Failed to add finalizer to SPIRE server restore instance.")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if restore.Status.Phase == "" {
+		restore.Status.Phase = spirev1.RestorePending
+	}
+
+	server := &spirev1.SpireServer{}
+	if err := r.Get(ctx, restore.ServerKey(), server); err != nil {
+		if !apiErrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		setCondition(&restore.Status.Conditions, restore.Generation, spirev1.ConditionConfigValid,
+			metav1.ConditionFalse, spirev1.ReasonServerNotFound, fmt.Sprintf("SPIRE server %s not found", restore.ServerKey()))
+		return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, restore, status, &restore.Status)
+	}
+	deployed := server.DeepCopy()
+	deployed.Default()
+
+	backup := &spirev1.SpireServerBackup{}
+	if err := r.Get(ctx, restore.BackupKey(), backup); err != nil {
+		if !apiErrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		setCondition(&restore.Status.Conditions, restore.Generation, spirev1.ConditionConfigValid,
+			metav1.ConditionFalse, spirev1.ReasonBackupNotFound,
+			fmt.Sprintf("SPIRE server backup %s not found", restore.BackupKey()))
+		return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, restore, status, &restore.Status)
+	}
+	backup.Default()
+
+	if err := backup.ValidateServer(deployed); err != nil {
+		logger.Info("SPIRE server cannot be restored, skipping reconcile.", "reason", err.Error())
+		reportInvalidSpec(r.Recorder, restore, &restore.Status.Conditions, spirev1.ReasonInvalidSpec, err)
+		return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, restore, status, &restore.Status)
+	}
+
+	// the backup is chosen once, later backups do not change the restore
+	backupName := firstNonEmpty(restore.Status.BackupName, restore.Spec.BackupName, backup.Status.LastBackup)
+	if backupName == "" {
+		setCondition(&restore.Status.Conditions, restore.Generation, spirev1.ConditionConfigValid,
+			metav1.ConditionFalse, spirev1.ReasonBackupNotFound,
+			fmt.Sprintf("SPIRE server backup %s has not taken a backup yet", backup.Name))
+		return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, restore, status, &restore.Status)
+	}
+	restore.Status.BackupName = backupName
+
+	setCondition(&restore.Status.Conditions, restore.Generation, spirev1.ConditionConfigValid,
+		metav1.ConditionTrue, spirev1.ReasonValid, "spec is valid")
+
+	if holder := server.Annotations[restoreAnnotation]; holder != "" && holder != restore.Name {
+		r.Recorder.Event(restore, corev1.EventTypeNormal, spirev1.ReasonServerBusy,
+			fmt.Sprintf("waiting for restore %s of SPIRE server %s to finish", holder, server.Name))
+		return ctrl.Result{RequeueAfter: restoreCheckInterval},
+			updateStatusIfChanged(ctx, r.Client, restore, status, &restore.Status)
+	}
+
+	if restore.Status.Phase == spirev1.RestorePending {
+		if err := r.holdServer(ctx, restore, server); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		logger.Info("Stopping SPIRE server for restore.", "SpireServer", server.Name, "Backup", backupName)
+		restore.Status.Phase = spirev1.RestoreScalingDown
+		restore.Status.StartTime = &metav1.Time{Time: time.Now()}
+	}
+
+	if restore.Status.Phase == spirev1.RestoreScalingDown {
+		stopped, err := r.serverStopped(ctx, server)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !stopped && restore.Status.StartTime != nil &&
+			time.Since(restore.Status.StartTime.Time) > restoreScaleDownTimeout {
+			restore.Status.Phase = spirev1.RestoreFailed
+			restore.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+			r.Recorder.Event(restore, corev1.EventTypeWarning, "RestoreFailed",
+				fmt.Sprintf("the pods of SPIRE server %s did not stop within %s", server.Name, restoreScaleDownTimeout))
+
+			if err := r.releaseServer(ctx, restore); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, restore, status, &restore.Status)
+		}
+		if !stopped {
+			return ctrl.Result{RequeueAfter: restoreCheckInterval},
+				updateStatusIfChanged(ctx, r.Client, restore, status, &restore.Status)
+		}
+
+		restore.Status.Phase = spirev1.RestoreRestoring
+	}
+
+	job := r.restoreJob(restore, backup, deployed)
+	if err := reconcileComponents(ctx, r.Client, r.Scheme, restore, []component{{"restoreJob", job}},
+		logger); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.Get(ctx, client.ObjectKeyFromObject(job), job); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if finished, succeeded, at := jobResult(job); finished {
+		restore.Status.CompletionTime = &metav1.Time{Time: at}
+
+		if succeeded {
+			restore.Status.Phase = spirev1.RestoreSucceeded
+			r.Recorder.Event(restore, corev1.EventTypeNormal, "Restored",
+				fmt.Sprintf("restored backup %s into SPIRE server %s", backupName, server.Name))
+		} else {
+			restore.Status.Phase = spirev1.RestoreFailed
+			r.Recorder.Event(restore, corev1.EventTypeWarning, "RestoreFailed",
+				fmt.Sprintf("failed to restore backup %s into SPIRE server %s, see the logs of Job %s",
+					backupName, server.Name, job.Name))
+		}
+
+		if err := r.releaseServer(ctx, restore); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{}, updateStatusIfChanged(ctx, r.Client, restore, status, &restore.Status)
+}
+
+// holdServer marks the SPIRE server as being restored, so that its pods are
+// stopped.
+func (r *SpireServerRestoreReconciler) holdServer(ctx context.Context, restore *spirev1.SpireServerRestore,
+	server *spirev1.SpireServer) error {
+	patch := client.MergeFrom(server.DeepCopy())
+	if server.Annotations == nil {
+		server.Annotations = map[string]string{}
+	}
+	server.Annotations[restoreAnnotation] = restore.Name
+
+	return r.Patch(ctx, server, patch)
+}
+
+// releaseServer starts the SPIRE server again if the restore stopped it.
+func (r *SpireServerRestoreReconciler) releaseServer(ctx context.Context, restore *spirev1.SpireServerRestore) error {
+	server := &spirev1.SpireServer{}
+	if err := r.Get(ctx, restore.ServerKey(), server); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if server.Annotations[restoreAnnotation] != restore.Name {
+		return nil
+	}
+
+	patch := client.MergeFrom(server.DeepCopy())
+	delete(server.Annotations, restoreAnnotation)
+
+	return r.Patch(ctx, server, patch)
+}
+
+// serverStopped reports whether every pod of the SPIRE server is gone.
+func (r *SpireServerRestoreReconciler) serverStopped(ctx context.Context, server *spirev1.SpireServer) (bool, error) {
+	statefulSet := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(server), statefulSet); err != nil {
+		if apiErrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	scaledDown := statefulSet.Spec.Replicas != nil && *statefulSet.Spec.Replicas == 0
+	return scaledDown && statefulSet.Status.Replicas == 0, nil
+}
+
+// restoreJob returns the Job loading the backup into the datastore of the
+// SPIRE server, whose spec has been defaulted.
+func (r *SpireServerRestoreReconciler) restoreJob(restore *spirev1.SpireServerRestore,
+	b *spirev1.SpireServerBackup, s *spirev1.SpireServer) *batchv1.Job {
+	backupName := restore.Status.BackupName
+
+	var source corev1.Volume
+	in := backupPath(backupName)
+	if claim := b.Spec.Destination.PersistentVolumeClaim; claim != nil {
+		source = corev1.Volume{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: claim.ClaimName,
+				ReadOnly:  true,
+			}},
+		}
+	} else {
+		in = backupDir
+		source = corev1.Volume{
+			Name:         "backup",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: backupName}},
+		}
+	}
+
+	script := "set -e\nin=" + shellQuote(in) + "\n" + restoreScript(s)
+	container := backupToolContainer("restore", backupImage(r.Images, b, s), s, script)
+
+	podSpec := corev1.PodSpec{
+		RestartPolicy:    corev1.RestartPolicyNever,
+		ImagePullSecrets: s.Spec.ImagePullSecrets,
+		Containers:       []corev1.Container{container},
+		Volumes:          backupPodVolumes(s, source),
+	}
+
+	// the volume of the server is attached to the nodes its pods run on
+	if mountsServerData(s) {
+		podSpec.NodeSelector = s.Spec.NodeSelector
+		podSpec.Tolerations = s.Spec.Tolerations
+	}
+
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      restore.Name,
+			Namespace: restore.Namespace,
+			Labels:    componentLabels(restoreApp, restore.Name),
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: componentLabels(restoreApp, restore.Name)},
+				Spec:       podSpec,
+			},
+		},
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SpireServerRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&spirev1.SpireServerRestore{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
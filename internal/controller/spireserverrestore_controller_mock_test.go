@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+)
+
+func createSpireServerRestore() *spirev1.SpireServerRestore {
+	return &spirev1.SpireServerRestore{
+		ObjectMeta: metav1.ObjectMeta{Name: "spire-restore", Namespace: "default"},
+		Spec: spirev1.SpireServerRestoreSpec{
+			ServerRef: corev1.LocalObjectReference{Name: mockSpireServer.Name},
+			BackupRef: corev1.LocalObjectReference{Name: "spire-backup"},
+		},
+	}
+}
+
+func TestRestoreStopsServerWhileRestoring(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	backup := createSpireServerBackup(claimDestination)
+	backup.Status.LastBackup = "spire-backup-28000000"
+	restore := createSpireServerRestore()
+	replicas := int32(1)
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: server.Name, Namespace: server.Namespace},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+		Status:     appsv1.StatefulSetStatus{Replicas: 1},
+	}
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, backup, restore, statefulSet).WithStatusSubresource(backup, restore).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &SpireServerRestoreReconciler{Client: c, Scheme: testScheme, Recorder: recorder}
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(restore)}
+
+	// the server pods are still running
+	result, err := r.Reconcile(ctx, request)
+	assert.NoError(t, err)
+	assert.Equal(t, restoreCheckInterval, result.RequeueAfter)
+
+	held := &spirev1.SpireServer{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), held))
+	assert.Equal(t, restore.Name, held.Annotations[restoreAnnotation])
+
+	reconciled := &spirev1.SpireServerRestore{}
+	assert.NoError(t, c.Get(ctx, request.NamespacedName, reconciled))
+	assert.Equal(t, spirev1.RestoreScalingDown, reconciled.Status.Phase)
+	assert.Equal(t, "spire-backup-28000000", reconciled.Status.BackupName)
+	assert.NotNil(t, reconciled.Status.StartTime)
+	assert.Contains(t, reconciled.Finalizers, cleanupFinalizer)
+
+	// the server reconciler stops the pods
+	stopped := int32(0)
+	statefulSet.Spec.Replicas = &stopped
+	assert.NoError(t, c.Update(ctx, statefulSet))
+	statefulSet.Status.Replicas = 0
+	assert.NoError(t, c.Status().Update(ctx, statefulSet))
+
+	_, err = r.Reconcile(ctx, request)
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.Get(ctx, request.NamespacedName, reconciled))
+	assert.Equal(t, spirev1.RestoreRestoring, reconciled.Status.Phase)
+
+	job := &batchv1.Job{}
+	assert.NoError(t, c.Get(ctx, request.NamespacedName, job))
+	container := job.Spec.Template.Spec.Containers[0]
+	assert.Contains(t, container.Command[2], "in='/backup/spire-backup-28000000'")
+	assert.Contains(t, container.Command[2], `cp "$in/datastore.sqlite3" '/run/spire/data/datastore.sqlite3.restore'`)
+	assert.Contains(t, container.Command[2], `cp "$in/keys.json" '/run/spire/data/keys.json'`)
+	assert.True(t, job.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ReadOnly)
+	assert.Nil(t, job.Spec.Template.Spec.Affinity)
+
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	job.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+	assert.NoError(t, c.Status().Update(ctx, job))
+
+	_, err = r.Reconcile(ctx, request)
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.Get(ctx, request.NamespacedName, reconciled))
+	assert.Equal(t, spirev1.RestoreSucceeded, reconciled.Status.Phase)
+	assert.NotNil(t, reconciled.Status.CompletionTime)
+
+	released := &spirev1.SpireServer{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), released))
+	assert.NotContains(t, released.Annotations, restoreAnnotation)
+}
+
+func TestRestoreFailsWhenServerDoesNotStop(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Annotations = map[string]string{restoreAnnotation: "spire-restore"}
+	backup := createSpireServerBackup(claimDestination)
+	backup.Status.LastBackup = "spire-backup-28000000"
+	restore := createSpireServerRestore()
+	restore.Status.Phase = spirev1.RestoreScalingDown
+	restore.Status.StartTime = &metav1.Time{Time: time.Now().Add(-restoreScaleDownTimeout - time.Minute)}
+	replicas := int32(1)
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: server.Name, Namespace: server.Namespace},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+		Status:     appsv1.StatefulSetStatus{Replicas: 1},
+	}
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, backup, restore, statefulSet).WithStatusSubresource(backup, restore).Build()
+	r := &SpireServerRestoreReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(10)}
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(restore)}
+
+	result, err := r.Reconcile(ctx, request)
+	assert.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter)
+
+	reconciled := &spirev1.SpireServerRestore{}
+	assert.NoError(t, c.Get(ctx, request.NamespacedName, reconciled))
+	assert.Equal(t, spirev1.RestoreFailed, reconciled.Status.Phase)
+	assert.NotNil(t, reconciled.Status.CompletionTime)
+
+	released := &spirev1.SpireServer{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), released))
+	assert.NotContains(t, released.Annotations, restoreAnnotation)
+
+	assert.Error(t, c.Get(ctx, request.NamespacedName, &batchv1.Job{}), "no restore Job should be created")
+}
+
+func TestRestoreWaitsForBackup(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	backup := createSpireServerBackup(claimDestination)
+	restore := createSpireServerRestore()
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server, backup, restore).WithStatusSubresource(backup, restore).Build()
+	r := &SpireServerRestoreReconciler{Client: c, Scheme: testScheme, Recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(restore)})
+	assert.NoError(t, err)
+
+	reconciled := &spirev1.SpireServerRestore{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(restore), reconciled))
+	assert.Equal(t, spirev1.RestorePending, reconciled.Status.Phase)
+	condition := meta.FindStatusCondition(reconciled.Status.Conditions, spirev1.ConditionConfigValid)
+	assert.Equal(t, spirev1.ReasonBackupNotFound, condition.Reason)
+
+	untouched := &spirev1.SpireServer{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), untouched))
+	assert.NotContains(t, untouched.Annotations, restoreAnnotation)
+}
+
+func TestServerStopsForRestore(t *testing.T) {
+	ctx := context.Background()
+	server := mockSpireServer.DeepCopy()
+	server.Annotations = map[string]string{restoreAnnotation: "spire-restore"}
+	c := fake.NewClientBuilder().WithScheme(testScheme).
+		WithObjects(server).WithStatusSubresource(server).Build()
+	r := &SpireServerReconciler{Client: c, Scheme: testScheme}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)})
+	assert.NoError(t, err)
+
+	statefulSet := &appsv1.StatefulSet{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(server), statefulSet))
+	assert.Equal(t, int32(0), *statefulSet.Spec.Replicas)
+}
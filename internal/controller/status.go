@@ -0,0 +1,159 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+)
+
+// workloadStatus summarises the rollout of the StatefulSet or DaemonSet
+// running the SPIRE pods.
+type workloadStatus struct {
+	desired int32
+	ready   int32
+
+	// rolledOut is true once every pod runs the latest pod template
+	rolledOut bool
+
+	// failing is true when pods are known to be broken rather than starting
+	failing bool
+}
+
+// statefulSetStatus summarises the rollout of the StatefulSet as read from
+// live, which may be a stale copy from the cache: it is only rolled out once
+// its controller has observed written, the StatefulSet the operator last
+// wrote.
+func statefulSetStatus(live *appsv1.StatefulSet, written *appsv1.StatefulSet) workloadStatus {
+	var desired int32 = 1
+	if written.Spec.Replicas != nil {
+		desired = *written.Spec.Replicas
+	}
+
+	generation := max64(live.Generation, written.Generation)
+	return workloadStatus{
+		desired: desired,
+		ready:   live.Status.ReadyReplicas,
+		rolledOut: generation > 0 &&
+			live.Status.ObservedGeneration >= generation &&
+			live.Status.UpdatedReplicas == desired,
+	}
+}
+
+// daemonSetStatus summarises the rollout of the DaemonSet like
+// statefulSetStatus.
+func daemonSetStatus(live *appsv1.DaemonSet, written *appsv1.DaemonSet) workloadStatus {
+	generation := max64(live.Generation, written.Generation)
+	return workloadStatus{
+		desired: live.Status.DesiredNumberScheduled,
+		ready:   live.Status.NumberReady,
+		rolledOut: generation > 0 &&
+			live.Status.ObservedGeneration >= generation &&
+			live.Status.UpdatedNumberScheduled == live.Status.DesiredNumberScheduled,
+	}
+}
+
+func max64(a int64, b int64) int64 {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+// setWorkloadConditions sets the Available, Progressing and Degraded
+// conditions from the rollout of the SPIRE pods.
+func setWorkloadConditions(conditions *[]metav1.Condition, generation int64, w workloadStatus) {
+	readiness := fmt.Sprintf("%d/%d pods ready", w.ready, w.desired)
+	progressing := !w.rolledOut || w.ready < w.desired
+
+	if w.desired > 0 && w.ready >= w.desired {
+		setCondition(conditions, generation, spirev1.ConditionAvailable, metav1.ConditionTrue,
+			spirev1.ReasonReplicasReady, readiness)
+	} else {
+		setCondition(conditions, generation, spirev1.ConditionAvailable, metav1.ConditionFalse,
+			spirev1.ReasonReplicasNotReady, readiness)
+	}
+
+	if !w.rolledOut {
+		setCondition(conditions, generation, spirev1.ConditionProgressing, metav1.ConditionTrue,
+			spirev1.ReasonRollingOut, "pods are being updated")
+	} else if progressing {
+		setCondition(conditions, generation, spirev1.ConditionProgressing, metav1.ConditionTrue,
+			spirev1.ReasonRollingOut, readiness)
+	} else {
+		setCondition(conditions, generation, spirev1.ConditionProgressing, metav1.ConditionFalse,
+			spirev1.ReasonRolloutComplete, readiness)
+	}
+
+	// pods that are still not ready once the rollout is over are not starting up
+	if w.failing || (w.rolledOut && w.ready < w.desired) {
+		setCondition(conditions, generation, spirev1.ConditionDegraded, metav1.ConditionTrue,
+			spirev1.ReasonPodsFailing, readiness)
+	} else {
+		setCondition(conditions, generation, spirev1.ConditionDegraded, metav1.ConditionFalse,
+			spirev1.ReasonAsExpected, readiness)
+	}
+}
+
+// setReconcileFailedCondition marks the resource as degraded because the
+// operator could not create or update the objects it manages.
+func setReconcileFailedCondition(conditions *[]metav1.Condition, generation int64, err error) {
+	setCondition(conditions, generation, spirev1.ConditionDegraded, metav1.ConditionTrue,
+		spirev1.ReasonReconcileFailed, err.Error())
+}
+
+// reportInvalidSpec records why the spec of obj was rejected in its
+// ConfigValid condition and as a warning event.
+func reportInvalidSpec(recorder record.EventRecorder, obj client.Object, conditions *[]metav1.Condition,
+	reason string, validationErr error) {
+	setCondition(conditions, obj.GetGeneration(), spirev1.ConditionConfigValid, metav1.ConditionFalse,
+		reason, validationErr.Error())
+	recorder.Event(obj, corev1.EventTypeWarning, reason, validationErr.Error())
+}
+
+func setCondition(conditions *[]metav1.Condition, generation int64, conditionType string,
+	status metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// updateStatusIfChanged writes the status of obj if current, a pointer to its
+// status, differs from original, the status as it was read.
+func updateStatusIfChanged(ctx context.Context, c client.Client, obj client.Object, original interface{},
+	current interface{}) error {
+	if equality.Semantic.DeepEqual(original, current) {
+		return nil
+	}
+
+	return c.Status().Update(ctx, obj)
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+)
+
+func TestWorkloadConditionsRollingOut(t *testing.T) {
+	var conditions []metav1.Condition
+	setWorkloadConditions(&conditions, 2, workloadStatus{desired: 3, ready: 1})
+
+	assert.True(t, meta.IsStatusConditionFalse(conditions, spirev1.ConditionAvailable))
+	assert.True(t, meta.IsStatusConditionTrue(conditions, spirev1.ConditionProgressing))
+	assert.True(t, meta.IsStatusConditionFalse(conditions, spirev1.ConditionDegraded))
+	assert.Equal(t, int64(2), meta.FindStatusCondition(conditions, spirev1.ConditionAvailable).ObservedGeneration)
+}
+
+func TestWorkloadConditionsAvailable(t *testing.T) {
+	var conditions []metav1.Condition
+	setWorkloadConditions(&conditions, 1, workloadStatus{desired: 3, ready: 3, rolledOut: true})
+
+	assert.True(t, meta.IsStatusConditionTrue(conditions, spirev1.ConditionAvailable))
+	assert.True(t, meta.IsStatusConditionFalse(conditions, spirev1.ConditionProgressing))
+	assert.True(t, meta.IsStatusConditionFalse(conditions, spirev1.ConditionDegraded))
+}
+
+func TestWorkloadConditionsDegradedAfterRollout(t *testing.T) {
+	var conditions []metav1.Condition
+	setWorkloadConditions(&conditions, 1, workloadStatus{desired: 3, ready: 2, rolledOut: true})
+
+	assert.True(t, meta.IsStatusConditionFalse(conditions, spirev1.ConditionAvailable))
+	assert.True(t, meta.IsStatusConditionTrue(conditions, spirev1.ConditionDegraded))
+}
+
+func TestWorkloadConditionsNoPodsDesired(t *testing.T) {
+	var conditions []metav1.Condition
+	setWorkloadConditions(&conditions, 1, workloadStatus{rolledOut: true})
+
+	assert.True(t, meta.IsStatusConditionFalse(conditions, spirev1.ConditionAvailable))
+}
+
+func TestDaemonSetStatus(t *testing.T) {
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Generation: 2},
+		Status: appsv1.DaemonSetStatus{
+			ObservedGeneration:     2,
+			DesiredNumberScheduled: 4,
+			UpdatedNumberScheduled: 4,
+			NumberReady:            3,
+		},
+	}
+
+	w := daemonSetStatus(daemonSet, daemonSet)
+	assert.Equal(t, int32(4), w.desired)
+	assert.Equal(t, int32(3), w.ready)
+	assert.True(t, w.rolledOut)
+
+	daemonSet.Generation = 3
+	assert.False(t, daemonSetStatus(daemonSet, daemonSet).rolledOut)
+}
+
+func TestStatefulSetStatusWaitsForWrittenGeneration(t *testing.T) {
+	replicas := int32(3)
+	// the cache still holds the StatefulSet from before the patch, fully
+	// rolled out on the previous template
+	cached := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Generation: 4},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+		Status:     appsv1.StatefulSetStatus{ObservedGeneration: 4, UpdatedReplicas: 3, ReadyReplicas: 3},
+	}
+	written := cached.DeepCopy()
+	written.Generation = 5
+
+	assert.False(t, statefulSetStatus(cached, written).rolledOut)
+
+	cached.Generation = 5
+	cached.Status.ObservedGeneration = 5
+	cached.Status.UpdatedReplicas = 1
+	assert.False(t, statefulSetStatus(cached, written).rolledOut)
+
+	cached.Status.UpdatedReplicas = 3
+	assert.True(t, statefulSetStatus(cached, written).rolledOut)
+}
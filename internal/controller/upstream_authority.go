@@ -0,0 +1,159 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	spirev1 "github.com/glcp/spire-k8s-operator/api/v1"
+	"github.com/glcp/spire-k8s-operator/internal/spireconfig"
+)
+
+// Files the upstream CA and the certificates of Vault are mounted as
+const (
+	upstreamCertPath    = "/run/spire/upstream/ca/tls.crt"
+	upstreamKeyPath     = "/run/spire/upstream/ca/tls.key"
+	upstreamBundlePath  = "/run/spire/upstream/ca/bundle.crt"
+	vaultCACertPath     = "/run/spire/upstream/vault/ca.crt"
+	serviceAccountToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// upstreamAuthority models the UpstreamAuthority plugin of the SPIRE server,
+// it returns nil when the server is its own root.
+func upstreamAuthority(s *spirev1.SpireServer, namespace string) *spireconfig.Plugin {
+	upstream := s.Spec.UpstreamAuthority
+	if upstream == nil {
+		return nil
+	}
+
+	switch {
+	case upstream.Disk != nil:
+		data := spireconfig.Data{
+			"cert_file_path": upstreamCertPath,
+			"key_file_path":  upstreamKeyPath,
+		}
+		if upstream.Disk.BundleKey != "" {
+			data["bundle_file_path"] = upstreamBundlePath
+		}
+		return &spireconfig.Plugin{Type: "UpstreamAuthority", Name: "disk", Data: data}
+
+	case upstream.CertManager != nil:
+		issuer := upstream.CertManager.IssuerRef
+		data := spireconfig.Data{
+			"issuer_name": issuer.Name,
+			"namespace":   namespace,
+		}
+		if issuer.Kind != "" {
+			data["issuer_kind"] = issuer.Kind
+		}
+		if issuer.Group != "" {
+			data["issuer_group"] = issuer.Group
+		}
+		return &spireconfig.Plugin{Type: "UpstreamAuthority", Name: "cert-manager", Data: data}
+
+	case upstream.Vault != nil:
+		vault := upstream.Vault
+		auth := spireconfig.Data{
+			"k8s_auth_role_name": vault.KubernetesAuth.RoleName,
+			"token_path":         serviceAccountToken,
+		}
+		if vault.KubernetesAuth.MountPoint != "" {
+			auth["k8s_auth_mount_point"] = vault.KubernetesAuth.MountPoint
+		}
+		data := spireconfig.Data{
+			"vault_addr": vault.Address,
+			"k8s_auth":   auth,
+		}
+		if vault.PKIMountPoint != "" {
+			data["pki_mount_point"] = vault.PKIMountPoint
+		}
+		if vault.Namespace != "" {
+			data["namespace"] = vault.Namespace
+		}
+		if vault.CACertSecretRef != nil {
+			data["ca_cert_path"] = vaultCACertPath
+		}
+		return &spireconfig.Plugin{Type: "UpstreamAuthority", Name: "vault", Data: data}
+	}
+
+	return nil
+}
+
+// upstreamAuthorityVolumes returns the volumes holding the upstream CA, or
+// the certificates Vault is verified with, along with their mounts.
+func upstreamAuthorityVolumes(s *spirev1.SpireServer) ([]corev1.Volume, []corev1.VolumeMount) {
+	upstream := s.Spec.UpstreamAuthority
+	if upstream == nil {
+		return nil, nil
+	}
+
+	var volume corev1.Volume
+	var mount corev1.VolumeMount
+	switch {
+	case upstream.Disk != nil:
+		items := []corev1.KeyToPath{
+			{Key: corev1.TLSCertKey, Path: path.Base(upstreamCertPath)},
+			{Key: corev1.TLSPrivateKeyKey, Path: path.Base(upstreamKeyPath)},
+		}
+		if upstream.Disk.BundleKey != "" {
+			items = append(items, corev1.KeyToPath{Key: upstream.Disk.BundleKey, Path: path.Base(upstreamBundlePath)})
+		}
+		volume = corev1.Volume{
+			Name: "upstream-ca",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+				SecretName: upstream.Disk.SecretName,
+				Items:      items,
+			}},
+		}
+		mount = corev1.VolumeMount{Name: "upstream-ca", MountPath: path.Dir(upstreamCertPath), ReadOnly: true}
+
+	case upstream.Vault != nil && upstream.Vault.CACertSecretRef != nil:
+		ref := upstream.Vault.CACertSecretRef
+		volume = corev1.Volume{
+			Name: "vault-ca",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+				SecretName: ref.Name,
+				Items:      []corev1.KeyToPath{{Key: ref.Key, Path: path.Base(vaultCACertPath)}},
+				Optional:   ref.Optional,
+			}},
+		}
+		mount = corev1.VolumeMount{Name: "vault-ca", MountPath: path.Dir(vaultCACertPath), ReadOnly: true}
+
+	default:
+		return nil, nil
+	}
+
+	return []corev1.Volume{volume}, []corev1.VolumeMount{mount}
+}
+
+// upstreamAuthorityRules returns the permissions the SPIRE server needs in its
+// namespace to get its CA signed, cert-manager being reached through the API
+// server.
+func upstreamAuthorityRules(s *spirev1.SpireServer) []rbacv1.PolicyRule {
+	if s.Spec.UpstreamAuthority == nil || s.Spec.UpstreamAuthority.CertManager == nil {
+		return nil
+	}
+
+	return []rbacv1.PolicyRule{{
+		Verbs:     []string{"get", "list", "create", "delete"},
+		Resources: []string{"certificaterequests"},
+		APIGroups: []string{"cert-manager.io"},
+	}}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// spireVersion is a SPIRE release, pre-release suffixes are ignored.
+type spireVersion struct {
+	major int
+	minor int
+	patch int
+}
+
+func parseVersion(version string) (spireVersion, error) {
+	core, _, _ := strings.Cut(version, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return spireVersion{}, fmt.Errorf("version %q is not of the form major.minor.patch", version)
+	}
+
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return spireVersion{}, fmt.Errorf("version %q is not of the form major.minor.patch", version)
+		}
+		numbers[i] = n
+	}
+
+	return spireVersion{major: numbers[0], minor: numbers[1], patch: numbers[2]}, nil
+}
+
+// compare returns -1, 0 or 1 when v is older than, the same as or newer than
+// other.
+func (v spireVersion) compare(other spireVersion) int {
+	for _, diff := range []int{v.major - other.major, v.minor - other.minor, v.patch - other.patch} {
+		if diff < 0 {
+			return -1
+		}
+		if diff > 0 {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// minorsApart returns how many minor versions separate v from other, releases
+// of different major versions are never considered compatible.
+func (v spireVersion) minorsApart(other spireVersion) int {
+	if v.major != other.major {
+		return -1
+	}
+
+	if v.minor > other.minor {
+		return v.minor - other.minor
+	}
+
+	return other.minor - v.minor
+}
+
+// checkUpgrade returns an error when SPIRE cannot move from the running
+// version to the target one, as SPIRE only supports moving one minor version
+// at a time. Nothing is running yet when running is empty.
+func checkUpgrade(running string, target string) error {
+	if running == "" {
+		return nil
+	}
+
+	from, err := parseVersion(running)
+	if err != nil {
+		return err
+	}
+
+	to, err := parseVersion(target)
+	if err != nil {
+		return err
+	}
+
+	if apart := from.minorsApart(to); apart < 0 || apart > 1 {
+		return fmt.Errorf("cannot move from SPIRE %s to %s, versions can only change by one minor version at a time",
+			running, target)
+	}
+
+	return nil
+}
+
+// checkAgentCompatibility returns an error when an agent of the given version
+// cannot connect to a server of the given version: agents may be at most one
+// minor version older than their server and never newer.
+func checkAgentCompatibility(agentVersion string, serverVersion string) error {
+	agent, err := parseVersion(agentVersion)
+	if err != nil {
+		return err
+	}
+
+	server, err := parseVersion(serverVersion)
+	if err != nil {
+		return err
+	}
+
+	if agent.compare(server) > 0 {
+		return fmt.Errorf("SPIRE agent %s cannot be newer than its server %s", agentVersion, serverVersion)
+	}
+
+	if apart := agent.minorsApart(server); apart < 0 || apart > 1 {
+		return fmt.Errorf("SPIRE agent %s must be at most one minor version older than its server %s",
+			agentVersion, serverVersion)
+	}
+
+	return nil
+}
+
+// versionAtLeast reports whether version is the same as or newer than
+// minimum, unparsable versions are never considered recent enough.
+func versionAtLeast(version string, minimum string) bool {
+	v, err := parseVersion(version)
+	if err != nil {
+		return false
+	}
+
+	m, err := parseVersion(minimum)
+	if err != nil {
+		return false
+	}
+
+	return v.compare(m) >= 0
+}
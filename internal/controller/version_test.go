@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckUpgrade(t *testing.T) {
+	tests := []struct {
+		running string
+		target  string
+		valid   bool
+	}{
+		{"", "1.7.0", true},
+		{"1.5.1", "1.5.1", true},
+		{"1.5.1", "1.5.4", true},
+		{"1.5.1", "1.6.3", true},
+		{"1.6.3", "1.5.1", true},
+		{"1.5.1", "1.7.0", false},
+		{"1.7.0", "1.5.1", false},
+		{"1.9.0", "2.0.0", false},
+		{"1.5.1", "latest", false},
+	}
+
+	for _, tt := range tests {
+		err := checkUpgrade(tt.running, tt.target)
+		assert.Equal(t, tt.valid, err == nil, "%s to %s: %v", tt.running, tt.target, err)
+	}
+}
+
+func TestCheckAgentCompatibility(t *testing.T) {
+	assert.NoError(t, checkAgentCompatibility("1.6.3", "1.6.3"))
+	assert.NoError(t, checkAgentCompatibility("1.5.1", "1.6.3"))
+	assert.ErrorContains(t, checkAgentCompatibility("1.6.3", "1.6.2"), "cannot be newer than its server")
+	assert.ErrorContains(t, checkAgentCompatibility("1.4.0", "1.6.3"), "at most one minor version older")
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	assert.True(t, versionAtLeast("1.6.0", "1.6.0"))
+	assert.True(t, versionAtLeast("1.6.0-rc1", "1.5.9"))
+	assert.False(t, versionAtLeast("1.5.9", "1.6.0"))
+	assert.False(t, versionAtLeast("", "1.6.0"))
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package spireconfig models the configuration files of SPIRE servers and
+// agents and renders them as HCL.
+package spireconfig
+
+// ServerConfig is the configuration of a SPIRE server, rendered as server.conf
+type ServerConfig struct {
+	Server       Server
+	Plugins      []Plugin
+	HealthChecks HealthChecks
+}
+
+// AgentConfig is the configuration of a SPIRE agent, rendered as agent.conf
+type AgentConfig struct {
+	Agent        Agent
+	Plugins      []Plugin
+	HealthChecks HealthChecks
+}
+
+// Server is the server block of a SPIRE server configuration. Fields left to
+// their zero value are not rendered, so that SPIRE applies its own defaults.
+type Server struct {
+	BindAddress string
+	BindPort    int
+	SocketPath  string
+	TrustDomain string
+	DataDir     string
+	LogLevel    string
+	CAKeyType   string
+	CASubject   *CASubject
+	CATTL       string
+
+	DefaultX509SVIDTTL string
+	DefaultJWTSVIDTTL  string
+	JWTIssuer          string
+}
+
+// CASubject is the subject of the CA certificates of a SPIRE server
+type CASubject struct {
+	Country      []string
+	Organization []string
+	CommonName   string
+}
+
+// Agent is the agent block of a SPIRE agent configuration. Fields left to
+// their zero value are not rendered, so that SPIRE applies its own defaults.
+type Agent struct {
+	DataDir         string
+	LogLevel        string
+	ServerAddress   string
+	ServerPort      int
+	SocketPath      string
+	TrustBundlePath string
+	TrustDomain     string
+}
+
+// HealthChecks is the health_checks block shared by SPIRE servers and agents
+type HealthChecks struct {
+	ListenerEnabled bool
+	BindAddress     string
+	BindPort        int
+	LivePath        string
+	ReadyPath       string
+}
+
+// Plugin is a SPIRE plugin, such as the k8s_psat NodeAttestor
+type Plugin struct {
+	// Type of the plugin, such as NodeAttestor or KeyManager
+	Type string
+
+	// Name of the plugin implementation, such as k8s_psat or disk
+	Name string
+
+	// Data is the plugin_data of the plugin, which is left out when it is nil
+	// rather than empty
+	Data Data
+}
+
+// Data holds plugin settings. Values are strings, integers, booleans, string
+// slices or nested Data, and are rendered in the order of their keys.
+type Data map[string]interface{}
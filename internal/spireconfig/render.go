@@ -0,0 +1,200 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spireconfig
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Render returns the server configuration as HCL.
+func (c ServerConfig) Render() string {
+	w := &writer{}
+
+	w.block("server", func() {
+		s := c.Server
+		w.optional("bind_address", s.BindAddress)
+		w.optional("bind_port", s.BindPort)
+		w.optional("socket_path", s.SocketPath)
+		w.optional("trust_domain", s.TrustDomain)
+		w.optional("data_dir", s.DataDir)
+		w.optional("log_level", s.LogLevel)
+		w.optional("ca_key_type", s.CAKeyType)
+		if s.CASubject != nil {
+			w.attribute("ca_subject", Data{
+				"country":      s.CASubject.Country,
+				"organization": s.CASubject.Organization,
+				"common_name":  s.CASubject.CommonName,
+			})
+		}
+		w.optional("ca_ttl", s.CATTL)
+		w.optional("default_x509_svid_ttl", s.DefaultX509SVIDTTL)
+		w.optional("default_jwt_svid_ttl", s.DefaultJWTSVIDTTL)
+		w.optional("jwt_issuer", s.JWTIssuer)
+	})
+	w.plugins(c.Plugins)
+	w.healthChecks(c.HealthChecks)
+
+	return w.String()
+}
+
+// Render returns the agent configuration as HCL.
+func (c AgentConfig) Render() string {
+	w := &writer{}
+
+	w.block("agent", func() {
+		a := c.Agent
+		w.optional("data_dir", a.DataDir)
+		w.optional("log_level", a.LogLevel)
+		w.optional("server_address", a.ServerAddress)
+		w.optional("server_port", a.ServerPort)
+		w.optional("socket_path", a.SocketPath)
+		w.optional("trust_bundle_path", a.TrustBundlePath)
+		w.optional("trust_domain", a.TrustDomain)
+	})
+	w.plugins(c.Plugins)
+	w.healthChecks(c.HealthChecks)
+
+	return w.String()
+}
+
+// writer renders HCL blocks and attributes with two-space indentation and a
+// blank line between top-level blocks.
+type writer struct {
+	strings.Builder
+	depth int
+}
+
+func (w *writer) plugins(plugins []Plugin) {
+	w.block("plugins", func() {
+		for _, plugin := range plugins {
+			w.block(plugin.Type+" "+strconv.Quote(plugin.Name), func() {
+				if plugin.Data != nil {
+					w.block("plugin_data", func() {
+						w.data(plugin.Data)
+					})
+				}
+			})
+		}
+	})
+}
+
+func (w *writer) healthChecks(h HealthChecks) {
+	w.block("health_checks", func() {
+		w.optional("listener_enabled", h.ListenerEnabled)
+		w.optional("bind_address", h.BindAddress)
+		w.optional("bind_port", h.BindPort)
+		w.optional("live_path", h.LivePath)
+		w.optional("ready_path", h.ReadyPath)
+	})
+}
+
+func (w *writer) block(header string, body func()) {
+	if w.depth == 0 && w.Len() > 0 {
+		w.WriteString("\n")
+	}
+
+	w.line(header + " {")
+	w.depth++
+	body()
+	w.depth--
+	w.line("}")
+}
+
+// optional renders the attribute unless value is the zero value of its type.
+func (w *writer) optional(name string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return
+		}
+	case int:
+		if v == 0 {
+			return
+		}
+	case bool:
+		if !v {
+			return
+		}
+	}
+
+	w.attribute(name, value)
+}
+
+func (w *writer) attribute(name string, value interface{}) {
+	if data, ok := value.(Data); ok {
+		w.line(key(name) + " = {")
+		w.depth++
+		w.data(data)
+		w.depth--
+		w.line("}")
+		return
+	}
+
+	w.line(key(name) + " = " + literal(value))
+}
+
+func (w *writer) data(data Data) {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		w.attribute(name, data[name])
+	}
+}
+
+func (w *writer) line(s string) {
+	w.WriteString(strings.Repeat("  ", w.depth) + s + "\n")
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// key returns name as an HCL key, quoting it unless it is an identifier.
+func key(name string) string {
+	if identifier.MatchString(name) {
+		return name
+	}
+
+	return strconv.Quote(name)
+}
+
+// literal returns the HCL form of a value. Strings are quoted with Go escape
+// sequences, all of which HCL understands.
+func literal(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case []string:
+		quoted := make([]string, 0, len(v))
+		for _, s := range v {
+			quoted = append(quoted, strconv.Quote(s))
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	default:
+		panic(fmt.Sprintf("spireconfig: unsupported value %v of type %T", value, value))
+	}
+}
@@ -0,0 +1,112 @@
+package spireconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderEscapesStrings(t *testing.T) {
+	config := ServerConfig{
+		Server: Server{TrustDomain: "example.org"},
+		Plugins: []Plugin{{
+			Type: "DataStore",
+			Name: "sql",
+			Data: Data{"connection_string": "password='a\"b\\c'\nhost=db"},
+		}},
+	}
+
+	assert.Contains(t, config.Render(), `connection_string = "password='a\"b\\c'\nhost=db"`)
+}
+
+func TestRenderSortsPluginData(t *testing.T) {
+	config := AgentConfig{
+		Plugins: []Plugin{{
+			Type: "NodeAttestor",
+			Name: "k8s_psat",
+			Data: Data{
+				"token_path": "/var/run/token",
+				"cluster":    "demo",
+				"clusters": Data{
+					"b": Data{"service_account_allow_list": []string{"spire:agent"}},
+					"a": Data{"audience": []string{"spire-server"}},
+				},
+			},
+		}},
+	}
+
+	expected := `agent {
+}
+
+plugins {
+  NodeAttestor "k8s_psat" {
+    plugin_data {
+      cluster = "demo"
+      clusters = {
+        a = {
+          audience = ["spire-server"]
+        }
+        b = {
+          service_account_allow_list = ["spire:agent"]
+        }
+      }
+      token_path = "/var/run/token"
+    }
+  }
+}
+
+health_checks {
+}
+`
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, expected, config.Render())
+	}
+}
+
+func TestRenderQuotesKeysThatAreNotIdentifiers(t *testing.T) {
+	config := AgentConfig{
+		Plugins: []Plugin{{
+			Type: "NodeAttestor",
+			Name: "k8s_sat",
+			Data: Data{"clusters": Data{"prod cluster": Data{}, "demo-cluster": Data{}}},
+		}},
+	}
+
+	rendered := config.Render()
+	assert.Contains(t, rendered, "demo-cluster = {")
+	assert.Contains(t, rendered, `"prod cluster" = {`)
+}
+
+func TestRenderOmitsUnsetFields(t *testing.T) {
+	config := ServerConfig{
+		Server:       Server{TrustDomain: "example.org", BindPort: 8081},
+		HealthChecks: HealthChecks{ListenerEnabled: true},
+	}
+
+	expected := `server {
+  bind_port = 8081
+  trust_domain = "example.org"
+}
+
+plugins {
+}
+
+health_checks {
+  listener_enabled = true
+}
+`
+	assert.Equal(t, expected, config.Render())
+}
+
+func TestRenderOmitsNilPluginData(t *testing.T) {
+	config := AgentConfig{
+		Plugins: []Plugin{
+			{Type: "KeyManager", Name: "memory"},
+			{Type: "WorkloadAttestor", Name: "unix", Data: Data{}},
+		},
+	}
+
+	rendered := config.Render()
+	assert.Contains(t, rendered, "  KeyManager \"memory\" {\n  }\n")
+	assert.Contains(t, rendered, "  WorkloadAttestor \"unix\" {\n    plugin_data {\n    }\n  }\n")
+}